@@ -0,0 +1,257 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja_nodejs/require"
+)
+
+// programKey identifies the compiled program of a script file by its path and modification time.
+type programKey struct {
+	file    string
+	modTime time.Time
+	size    int64
+	name    string
+	strict  bool
+	module  bool // compiled as a module required, in moduleWrapper
+}
+
+type programEntry struct {
+	source  string
+	program *goja.Program
+}
+
+// programCache keeps the programs compiled from the script files and the modules they require,
+// so that the runtimes started again in this process, like the in-process exec children
+// and the workers, do not parse them again.
+type programCache struct {
+	sync.Mutex
+	max     int
+	entries map[programKey]programEntry
+}
+
+var programs = &programCache{max: 256}
+
+func (c *programCache) get(key programKey, source string) (*goja.Program, bool) {
+	c.Lock()
+	defer c.Unlock()
+	e, ok := c.entries[key]
+	if !ok || e.source != source {
+		return nil, false
+	}
+	return e.program, true
+}
+
+func (c *programCache) put(key programKey, source string, program *goja.Program) {
+	c.Lock()
+	defer c.Unlock()
+	if c.entries == nil || len(c.entries) >= c.max {
+		c.entries = make(map[programKey]programEntry)
+	}
+	c.entries[key] = programEntry{source: source, program: program}
+}
+
+// compile compiles the script of the runtime, or returns the program compiled before
+// from the same file if it has not been modified since.
+func (jr *JSRuntime) compile() (*goja.Program, error) {
+	if jr.file == nil {
+		return goja.Compile(jr.Name, jr.Source, jr.Strict)
+	}
+	key := *jr.file
+	key.name, key.strict = jr.Name, jr.Strict
+	if program, ok := programs.get(key, jr.Source); ok {
+		return program, nil
+	}
+	program, err := goja.Compile(jr.Name, jr.Source, jr.Strict)
+	if err != nil {
+		return nil, err
+	}
+	programs.put(key, jr.Source, program)
+	return program, nil
+}
+
+// compiledModuleName is the native module that runs the programs of compileModule.
+const compiledModuleName = "@jsh/compiled"
+
+// compiledModuleSource is the source require() is given for the modules compiled by compileModule.
+// It runs the program with the arguments goja_nodejs calls the module with.
+const compiledModuleSource = `require("` + compiledModuleName + `").call(this, exports, require, module, __filename, __dirname);`
+
+// compileModule returns the source of the module p for require(), src loaded from file.
+// goja_nodejs compiles the modules for each registry, that is for each runtime, so the module
+// is compiled here, in moduleWrapper, or taken from programs if it was compiled before from the
+// same file, and require() is given compiledModuleSource to run it instead.
+// src is returned if the file can not be stat'ed or the module does not compile,
+// for require() to report the error.
+func (jr *JSRuntime) compileModule(p, file string, src []byte) []byte {
+	key := scriptFile(jr.Env.Filesystem(), file)
+	if key == nil || path.Ext(p) == ".json" {
+		return src
+	}
+	key.name, key.module = p, true
+	source := string(src)
+	program, ok := programs.get(*key, source)
+	if !ok {
+		var err error
+		if program, err = goja.Compile(p, moduleWrapper+source+"\n})", false); err != nil {
+			return src
+		}
+		programs.put(*key, source, program)
+	}
+	if jr.compiled == nil {
+		jr.compiled = make(map[string]*goja.Program)
+	}
+	jr.compiled[p] = program
+	return []byte(compiledModuleSource)
+}
+
+// loadCompiledModule is the loader of compiledModuleName. Its exports is the function
+// compiledModuleSource calls, which runs the program of the module named by __filename.
+func (jr *JSRuntime) loadCompiledModule(vm *goja.Runtime, module *goja.Object) {
+	module.Set("exports", func(call goja.FunctionCall) goja.Value {
+		program, ok := jr.compiled[call.Argument(3).String()]
+		if !ok {
+			panic(vm.NewGoError(require.InvalidModuleError))
+		}
+		f, err := vm.RunProgram(program)
+		if err != nil {
+			panic(err)
+		}
+		fn, ok := goja.AssertFunction(f)
+		if !ok {
+			panic(vm.NewGoError(require.InvalidModuleError))
+		}
+		if _, err := fn(call.This, call.Arguments...); err != nil {
+			panic(err)
+		}
+		return goja.Undefined()
+	})
+}
+
+// scriptFile returns the key of the script file loaded from fileSystem,
+// or nil if it can not be stat'ed.
+func scriptFile(fileSystem fs.FS, file string) *programKey {
+	fi, err := fs.Stat(fileSystem, file)
+	if err != nil {
+		return nil
+	}
+	return &programKey{file: file, modTime: fi.ModTime(), size: fi.Size()}
+}
+
+var cacheDir struct {
+	sync.RWMutex
+	path string
+	max  int // the number of files kept in the directory, the least recently used are removed
+}
+
+// DefaultCacheSize is the number of sources the cache directory keeps if SetCacheDir is given none.
+const DefaultCacheSize = 1000
+
+// SetCacheDir sets the directory where the transpiled TypeScript and ES module sources
+// are kept across the processes, an empty dir disables it, as it is by default.
+// The directory keeps the max sources used last, DefaultCacheSize if max is not positive.
+// The compiled programs, including the ones of plain JavaScript files,
+// are cached only in memory, as goja can not serialize them.
+func SetCacheDir(dir string, max int) {
+	if max <= 0 {
+		max = DefaultCacheSize
+	}
+	cacheDir.Lock()
+	defer cacheDir.Unlock()
+	cacheDir.path = dir
+	cacheDir.max = max
+}
+
+func cachePath(key [sha256.Size]byte) string {
+	cacheDir.RLock()
+	defer cacheDir.RUnlock()
+	if cacheDir.path == "" {
+		return ""
+	}
+	return filepath.Join(cacheDir.path, hex.EncodeToString(key[:])+".js")
+}
+
+// readCache returns the source cached on disk for key.
+func readCache(key [sha256.Size]byte) ([]byte, bool) {
+	p := cachePath(key)
+	if p == "" {
+		return nil, false
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, false
+	}
+	// the modification time tells the sources used last
+	now := time.Now()
+	os.Chtimes(p, now, now)
+	return b, true
+}
+
+// writeCache stores b on disk for key. Errors are ignored, as the cache is only an optimization.
+func writeCache(key [sha256.Size]byte, b []byte) {
+	p := cachePath(key)
+	if p == "" {
+		return
+	}
+	dir := filepath.Dir(p)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	f, err := os.CreateTemp(dir, "tmp-*")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), p)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return
+	}
+	evictCache(dir)
+}
+
+// evictCache removes the sources used least recently from dir, down to the max of cacheDir.
+func evictCache(dir string) {
+	cacheDir.RLock()
+	max := cacheDir.max
+	cacheDir.RUnlock()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	type cached struct {
+		name    string
+		modTime time.Time
+	}
+	var files []cached
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".js") {
+			continue
+		}
+		if fi, err := e.Info(); err == nil {
+			files = append(files, cached{e.Name(), fi.ModTime()})
+		}
+	}
+	if len(files) <= max {
+		return
+	}
+	slices.SortFunc(files, func(a, b cached) int { return a.modTime.Compare(b.modTime) })
+	for _, f := range files[:len(files)-max] {
+		os.Remove(filepath.Join(dir, f.name))
+	}
+}
@@ -0,0 +1,174 @@
+package engine
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestProgramCache(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "hello.js")
+	if err := os.WriteFile(script, []byte(`console.println("hello");`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	run := func() *JSRuntime {
+		t.Helper()
+		conf := Config{
+			Args:   []string{"/work/hello.js"},
+			FSTabs: []FSTab{{MountPoint: "/work", Source: dir}},
+			Writer: &bytes.Buffer{},
+			Reader: &bytes.Buffer{},
+		}
+		jr, err := New(conf)
+		if err != nil {
+			t.Fatalf("Failed to create JSRuntime: %v", err)
+		}
+		if err := jr.Run(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return jr
+	}
+	compiled := func(jr *JSRuntime) bool {
+		key := *jr.file
+		key.name, key.strict = jr.Name, jr.Strict
+		_, ok := programs.get(key, jr.Source)
+		return ok
+	}
+
+	first := run()
+	if !compiled(first) {
+		t.Fatal("Expected the program to be cached")
+	}
+	if p1, p2 := mustCompile(t, first), mustCompile(t, run()); p1 != p2 {
+		t.Error("Expected the cached program to be reused")
+	}
+
+	// modify the script, it is compiled again
+	if err := os.WriteFile(script, []byte(`console.println("hello again");`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(script, later, later); err != nil {
+		t.Fatal(err)
+	}
+	second := run()
+	if *first.file == *second.file {
+		t.Fatal("Expected the modified script to have another key")
+	}
+	if got := second.Env.Writer().(*bytes.Buffer).String(); got != "hello again\n" {
+		t.Errorf("Expected the modified script to run, got %q", got)
+	}
+}
+
+func TestModuleProgramCache(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.js":  `console.println(require("./greet.js")("world"));`,
+		"greet.js": `module.exports = function (name) { return "hello " + name; };`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run := func() *JSRuntime {
+		t.Helper()
+		conf := Config{
+			Args:   []string{"/work/main.js"},
+			FSTabs: []FSTab{{MountPoint: "/work", Source: dir}},
+			Writer: &bytes.Buffer{},
+			Reader: &bytes.Buffer{},
+		}
+		jr, err := New(conf)
+		if err != nil {
+			t.Fatalf("Failed to create JSRuntime: %v", err)
+		}
+		if err := jr.Run(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got := jr.Env.Writer().(*bytes.Buffer).String(); got != "hello world\n" {
+			t.Fatalf("Unexpected output %q", got)
+		}
+		return jr
+	}
+
+	first, second := run(), run()
+	p1, p2 := first.compiled["/work/greet.js"], second.compiled["/work/greet.js"]
+	if p1 == nil || p1 != p2 {
+		t.Error("Expected the required module to be compiled once for both runtimes")
+	}
+}
+
+func mustCompile(t *testing.T, jr *JSRuntime) any {
+	t.Helper()
+	program, err := jr.compile()
+	if err != nil {
+		t.Fatalf("Failed to compile: %v", err)
+	}
+	return program
+}
+
+func TestCacheDir(t *testing.T) {
+	dir := t.TempDir()
+	SetCacheDir(dir, 0)
+	defer SetCacheDir("", 0)
+
+	src := []byte("let x: number = 1;\nexport default x;\n")
+	key := transpiledKey("/work/cached.mts", true, true, src)
+	want, err := transpile(nil, "/work/cached.mts", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := readCache(key)
+	if !ok {
+		t.Fatal("Expected the transpiled source to be written to the cache directory")
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Cached source mismatch:\n%s\n%s", got, want)
+	}
+
+	// the other processes start with an empty memory cache
+	transpiled.Lock()
+	delete(transpiled.entries, key)
+	transpiled.Unlock()
+	if err := os.WriteFile(cachePath(key), []byte("// from disk\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := transpile(nil, "/work/cached.mts", src); string(got) != "// from disk\n" {
+		t.Errorf("Expected the source from the cache directory, got %q", got)
+	}
+}
+
+func TestCacheDirEviction(t *testing.T) {
+	dir := t.TempDir()
+	SetCacheDir(dir, 0)
+	defer SetCacheDir("", 0)
+
+	var keys [3][sha256.Size]byte
+	for i := range keys {
+		keys[i][0] = byte(i + 1)
+		writeCache(keys[i], []byte("// source\n"))
+		// the modification times of the files tell their order
+		at := time.Now().Add(time.Duration(i-10) * time.Minute)
+		os.Chtimes(cachePath(keys[i]), at, at)
+	}
+	SetCacheDir(dir, 2)
+	// reading the first source makes it the one used last
+	if _, ok := readCache(keys[0]); !ok {
+		t.Fatal("Expected the first source to be cached")
+	}
+	writeCache([sha256.Size]byte{4}, []byte("// source\n"))
+
+	for i, ok := range []bool{true, false, false} {
+		if _, err := os.Stat(cachePath(keys[i])); (err == nil) != ok {
+			t.Errorf("Source %d cached: %v, want %v", i, err == nil, ok)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("Expected 2 cached sources, got %d", len(entries))
+	}
+}
@@ -0,0 +1,262 @@
+package engine
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja_nodejs/eventloop"
+)
+
+// Clock is the time of a runtime, set by Config.Clock.
+// It drives process.now(), Date.now(), new Date(), setTimeout() and setInterval()
+// instead of the time of the system, e.g. a ManualClock in tests.
+type Clock interface {
+	Now() time.Time
+	// AfterFunc calls f after the duration d, on its own goroutine like time.AfterFunc,
+	// or in the call that advances the clock like ManualClock.Set, which may run on the event loop.
+	// So f must not block, nor wait for the event loop.
+	AfterFunc(d time.Duration, f func()) ClockTimer
+}
+
+// ClockTimer is a timer of a Clock.
+type ClockTimer interface {
+	// Stop prevents the timer from firing, it returns false if the timer
+	// has already fired or been stopped.
+	Stop() bool
+}
+
+// ManualClock is a Clock that stands still until it is advanced,
+// so the tests check the timers of a script without sleeping.
+// It is safe for concurrent use.
+type ManualClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	seq    int
+	timers []*manualTimer
+}
+
+var _ Clock = (*ManualClock)(nil)
+
+type manualTimer struct {
+	c    *ManualClock
+	when time.Time
+	seq  int // the timers of the same time fire in the order they are set
+	f    func()
+}
+
+// NewManualClock returns a ManualClock that starts at now.
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *ManualClock) AfterFunc(d time.Duration, f func()) ClockTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	t := &manualTimer{c: c, when: c.now.Add(d), seq: c.seq, f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the clock forward by d, and fires the timers that are due
+// in the order of their times. A timer fires with the clock set to its time,
+// so the timers it sets, like the next one of an interval, fire in the same Advance if they are due.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	c.mu.Unlock()
+	c.Set(end)
+}
+
+// Set moves the clock forward to end, like Advance. The clock does not go back.
+// The timers fire in the call, on the goroutine of the caller.
+func (c *ManualClock) Set(end time.Time) {
+	for {
+		c.mu.Lock()
+		next := -1
+		for i, t := range c.timers {
+			if t.when.After(end) {
+				continue
+			}
+			if next < 0 || t.when.Before(c.timers[next].when) || (t.when.Equal(c.timers[next].when) && t.seq < c.timers[next].seq) {
+				next = i
+			}
+		}
+		if next < 0 {
+			if end.After(c.now) {
+				c.now = end
+			}
+			c.mu.Unlock()
+			return
+		}
+		t := c.timers[next]
+		c.timers = append(c.timers[:next], c.timers[next+1:]...)
+		if t.when.After(c.now) {
+			c.now = t.when
+		}
+		c.mu.Unlock()
+		t.f()
+	}
+}
+
+func (t *manualTimer) Stop() bool {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	for i, other := range t.c.timers {
+		if other == t {
+			t.c.timers = append(t.c.timers[:i], t.c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// clockTimer is the handle of setTimeout() and setInterval() on the Clock of a runtime.
+type clockTimer struct {
+	mu     sync.Mutex
+	timer  ClockTimer
+	active bool
+}
+
+func (ct *clockTimer) stop() bool {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	if !ct.active {
+		return false
+	}
+	ct.active = false
+	ct.timer.Stop()
+	return true
+}
+
+func (ct *clockTimer) isActive() bool {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	return ct.active
+}
+
+// noTimer is the ClockTimer of the timeouts without delay, which do not use the clock.
+type noTimer struct{}
+
+func (noTimer) Stop() bool { return false }
+
+// useClock makes vm take the time from the Clock of the runtime: the Date,
+// and the timers that replace the ones of the event loop.
+// The event loop is kept alive while any of the timers is pending.
+// A timer callback sees the time the timer is due, even if the clock
+// has been advanced further when the event loop runs it.
+func (jr *JSRuntime) useClock(vm *goja.Runtime) {
+	clock := jr.clock
+	var firing *time.Time
+	now := func() time.Time {
+		if firing != nil {
+			return *firing
+		}
+		return clock.Now()
+	}
+	vm.SetTimeSource(now)
+	jr.nowFunc = now
+
+	pending := 0
+	var hold *eventloop.Timer
+	ref := func() {
+		if pending == 0 {
+			hold = jr.eventLoop.SetTimeout(func(*goja.Runtime) {}, time.Duration(math.MaxInt64))
+		}
+		pending++
+	}
+	unref := func() {
+		if pending--; pending == 0 {
+			jr.eventLoop.ClearTimeout(hold)
+			hold = nil
+		}
+	}
+	call := func(vm *goja.Runtime, at time.Time, fn goja.Callable, args []goja.Value) {
+		prev := firing
+		firing = &at
+		defer func() { firing = prev }()
+		if _, err := fn(goja.Undefined(), args...); err != nil {
+			jr.uncaught(vm, err)
+		}
+	}
+
+	schedule := func(repeat bool) func(call goja.FunctionCall) goja.Value {
+		return func(c goja.FunctionCall) goja.Value {
+			fn, ok := goja.AssertFunction(c.Argument(0))
+			if !ok {
+				return goja.Undefined()
+			}
+			d := time.Duration(c.Argument(1).ToInteger()) * time.Millisecond
+			if d < 0 {
+				d = 0
+			}
+			if repeat && d < time.Millisecond {
+				d = time.Millisecond
+			}
+			var args []goja.Value
+			if len(c.Arguments) > 2 {
+				args = c.Arguments[2:]
+			}
+			ct := &clockTimer{active: true}
+			ref()
+			if d == 0 && !repeat {
+				// no need to advance the clock for the next turn of the event loop
+				ct.timer = noTimer{}
+				at := now()
+				jr.eventLoop.RunOnLoop(func(vm *goja.Runtime) {
+					if ct.stop() {
+						unref()
+						call(vm, at, fn, args)
+					}
+				})
+				return vm.ToValue(ct)
+			}
+			// fire only queues the callback, as the clock may call it on the event loop,
+			// in process.advanceClock()
+			var fire func()
+			fire = func() {
+				at := clock.Now()
+				// the next one of an interval is set when it is due, not when the callback runs,
+				// so it keeps up with the clock
+				ct.mu.Lock()
+				if repeat && ct.active {
+					ct.timer = clock.AfterFunc(d, fire)
+				}
+				ct.mu.Unlock()
+				jr.eventLoop.RunOnLoop(func(vm *goja.Runtime) {
+					if !repeat {
+						if !ct.stop() {
+							return
+						}
+						unref()
+					} else if !ct.isActive() {
+						return
+					}
+					call(vm, at, fn, args)
+				})
+			}
+			ct.mu.Lock()
+			ct.timer = clock.AfterFunc(d, fire)
+			ct.mu.Unlock()
+			return vm.ToValue(ct)
+		}
+	}
+	clear := func(c goja.FunctionCall) goja.Value {
+		if ct, ok := c.Argument(0).Export().(*clockTimer); ok && ct.stop() {
+			unref()
+		}
+		return goja.Undefined()
+	}
+	vm.Set("setTimeout", schedule(false))
+	vm.Set("setInterval", schedule(true))
+	vm.Set("clearTimeout", clear)
+	vm.Set("clearInterval", clear)
+}
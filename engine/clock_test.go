@@ -0,0 +1,147 @@
+package engine
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestManualClock(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	mc := NewManualClock(start)
+	var fired []string
+	mc.AfterFunc(2*time.Second, func() { fired = append(fired, "b@"+mc.Now().Sub(start).String()) })
+	mc.AfterFunc(time.Second, func() {
+		fired = append(fired, "a@"+mc.Now().Sub(start).String())
+		// set while firing, due in the same Advance
+		mc.AfterFunc(500*time.Millisecond, func() { fired = append(fired, "c@"+mc.Now().Sub(start).String()) })
+	})
+	stopped := mc.AfterFunc(time.Second, func() { fired = append(fired, "stopped") })
+	if !stopped.Stop() {
+		t.Fatal("expected Stop to stop the timer")
+	}
+	if stopped.Stop() {
+		t.Fatal("expected Stop of a stopped timer to return false")
+	}
+
+	mc.Advance(500 * time.Millisecond)
+	if len(fired) != 0 {
+		t.Fatalf("unexpected timers fired: %v", fired)
+	}
+	mc.Advance(3 * time.Second)
+	want := []string{"a@1s", "c@1.5s", "b@2s"}
+	if len(fired) != len(want) {
+		t.Fatalf("expected %v, got %v", want, fired)
+	}
+	for i := range want {
+		if fired[i] != want[i] {
+			t.Errorf("expected %v, got %v", want, fired)
+		}
+	}
+	if got := mc.Now().Sub(start); got != 3500*time.Millisecond {
+		t.Errorf("expected the clock at 3.5s, got %v", got)
+	}
+}
+
+func TestClockRuntime(t *testing.T) {
+	start := time.UnixMilli(1700000000000)
+	mc := NewManualClock(start)
+	out := &syncBuffer{}
+	jr, err := New(Config{
+		Name: "clock",
+		Code: `
+			const process = require("/lib/process");
+			const t0 = Date.now();
+			console.println("start", t0, new Date().getTime() === t0, process.now().unixMilli() === t0);
+			const id = setInterval(() => console.println("tick", Date.now() - t0), 1000);
+			setTimeout((name) => {
+				console.println("timeout", name, Date.now() - t0);
+				clearInterval(id);
+			}, 3500, "done");
+			const never = setTimeout(() => console.println("never"), 100);
+			clearTimeout(never);
+		`,
+		FSTabs: []FSTab{{MountPoint: "/", Source: "../native/root/"}},
+		Reader: &bytes.Buffer{},
+		Writer: out,
+		Clock:  mc,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jr.RegisterNativeModule("@jsh/process", jr.Process)
+	done := make(chan error)
+	go func() {
+		done <- jr.Run()
+	}()
+
+	// wait for the script to set its timers
+	waitOutput(t, out, "start 1700000000000 true true\n")
+	select {
+	case err := <-done:
+		t.Fatalf("the script ended with pending timers: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	mc.Advance(10 * time.Second)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the script did not end")
+	}
+	want := "start 1700000000000 true true\ntick 1000\ntick 2000\ntick 3000\ntimeout done 3500\n"
+	if got := out.String(); got != want {
+		t.Errorf("expected output %q, got %q", want, got)
+	}
+}
+
+func TestAdvanceClock(t *testing.T) {
+	tests := []TestCase{
+		{
+			name: "advance_clock",
+			script: `
+				const process = require("/lib/process");
+				const t0 = Date.now();
+				setTimeout(() => console.println("timeout", Date.now() - t0), 1500);
+				let n = 0;
+				const id = setInterval(() => {
+					console.println("tick", Date.now() - t0);
+					if (++n === 2) {
+						clearInterval(id);
+					}
+				}, 1000);
+				process.advanceClock(1000);
+				console.println("advanced", Date.now() - t0);
+				setTimeout(() => process.advanceClock(5000), 0);
+			`,
+			preTest: func(jr *JSRuntime) {
+				jr.clock = NewManualClock(time.Unix(1700000000, 0))
+			},
+			output: []string{
+				"advanced 1000",
+				"tick 1000",
+				"timeout 1500",
+				"tick 2000",
+			},
+		},
+		{
+			name: "advance_clock_system",
+			script: `
+				const process = require("/lib/process");
+				try {
+					process.advanceClock(1000);
+				} catch (e) {
+					console.println(e.message);
+				}
+			`,
+			output: []string{
+				"advanceClock: the runtime does not have a manual clock",
+			},
+		},
+	}
+	for _, tc := range tests {
+		RunTest(t, tc)
+	}
+}
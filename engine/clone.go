@@ -0,0 +1,285 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// The values copied between runtimes by cloneValue, like the structured clone
+// of the HTML standard. They hold no reference to the runtime they are copied from,
+// so they can be passed to another goroutine and restored by restoreValue.
+// The primitives are copied as the Go values exported by goja, and null as nil.
+type (
+	cloneUndefined struct{}
+	cloneObject    struct {
+		keys   []string
+		values []any
+	}
+	cloneArray  struct{ items []any }
+	cloneMap    struct{ entries [][2]any }
+	cloneSet    struct{ items []any }
+	cloneError  struct{ name, message, stack string }
+	cloneRegExp struct{ source, flags string }
+	// cloneBytes is an ArrayBuffer, a typed array or a DataView, by the name of its class.
+	cloneBytes struct {
+		class string
+		data  []byte
+	}
+)
+
+// DataCloneError reports a value that can not be copied, like a function.
+type DataCloneError struct {
+	What string
+}
+
+func (e *DataCloneError) Error() string {
+	return fmt.Sprintf("DataCloneError: %s could not be cloned", e.What)
+}
+
+// bytesClasses are the classes of the views of an ArrayBuffer that are cloned.
+var bytesClasses = []string{
+	"Int8Array", "Uint8Array", "Uint8ClampedArray", "Int16Array", "Uint16Array",
+	"Int32Array", "Uint32Array", "Float32Array", "Float64Array",
+	"BigInt64Array", "BigUint64Array", "DataView",
+}
+
+type cloner struct {
+	vm   *goja.Runtime
+	seen map[*goja.Object]any
+}
+
+// cloneValue copies v of vm. The objects referenced more than once, even cyclically,
+// are copied once and referenced the same way by the copy.
+func cloneValue(vm *goja.Runtime, v goja.Value) (any, error) {
+	c := &cloner{vm: vm, seen: map[*goja.Object]any{}}
+	return c.clone(v)
+}
+
+func (c *cloner) clone(v goja.Value) (any, error) {
+	if v == nil || goja.IsUndefined(v) {
+		return cloneUndefined{}, nil
+	}
+	if goja.IsNull(v) {
+		return nil, nil
+	}
+	if _, ok := v.(*goja.Symbol); ok {
+		return nil, &DataCloneError{What: v.String()}
+	}
+	obj, ok := v.(*goja.Object)
+	if !ok {
+		return v.Export(), nil
+	}
+	if ret, ok := c.seen[obj]; ok {
+		return ret, nil
+	}
+	if _, ok := goja.AssertFunction(obj); ok {
+		return nil, &DataCloneError{What: "function"}
+	}
+	switch obj.ClassName() {
+	case "Array":
+		ret := &cloneArray{}
+		c.seen[obj] = ret
+		n := obj.Get("length").ToInteger()
+		ret.items = make([]any, n)
+		for i := int64(0); i < n; i++ {
+			item, err := c.clone(obj.Get(strconv.FormatInt(i, 10)))
+			if err != nil {
+				return nil, err
+			}
+			ret.items[i] = item
+		}
+		return ret, nil
+	case "Date":
+		ret, _ := obj.Export().(time.Time)
+		return ret, nil
+	case "RegExp":
+		return &cloneRegExp{source: obj.Get("source").String(), flags: obj.Get("flags").String()}, nil
+	case "Error":
+		ret := &cloneError{name: obj.Get("name").String(), message: obj.Get("message").String()}
+		if stack := obj.Get("stack"); stack != nil && !goja.IsUndefined(stack) {
+			ret.stack = stack.String()
+		}
+		return ret, nil
+	}
+	if c.instanceOf(obj, "Map") {
+		ret := &cloneMap{}
+		c.seen[obj] = ret
+		for _, entry := range c.entries(obj) {
+			pair := entry.(*goja.Object)
+			k, err := c.clone(pair.Get("0"))
+			if err != nil {
+				return nil, err
+			}
+			v, err := c.clone(pair.Get("1"))
+			if err != nil {
+				return nil, err
+			}
+			ret.entries = append(ret.entries, [2]any{k, v})
+		}
+		return ret, nil
+	}
+	if c.instanceOf(obj, "Set") {
+		ret := &cloneSet{}
+		c.seen[obj] = ret
+		for _, item := range c.entries(obj) {
+			v, err := c.clone(item)
+			if err != nil {
+				return nil, err
+			}
+			ret.items = append(ret.items, v)
+		}
+		return ret, nil
+	}
+	if ab, ok := obj.Export().(goja.ArrayBuffer); ok {
+		ret := &cloneBytes{class: "ArrayBuffer", data: append([]byte(nil), ab.Bytes()...)}
+		c.seen[obj] = ret
+		return ret, nil
+	}
+	for _, class := range bytesClasses {
+		if c.instanceOf(obj, class) {
+			ab, _ := obj.Get("buffer").Export().(goja.ArrayBuffer)
+			offset := obj.Get("byteOffset").ToInteger()
+			length := obj.Get("byteLength").ToInteger()
+			ret := &cloneBytes{class: class, data: append([]byte(nil), ab.Bytes()[offset:offset+length]...)}
+			c.seen[obj] = ret
+			return ret, nil
+		}
+	}
+	// the own enumerable properties of the other objects, like structuredClone does
+	ret := &cloneObject{}
+	c.seen[obj] = ret
+	for _, key := range obj.Keys() {
+		v, err := c.clone(obj.Get(key))
+		if err != nil {
+			return nil, err
+		}
+		ret.keys = append(ret.keys, key)
+		ret.values = append(ret.values, v)
+	}
+	return ret, nil
+}
+
+func (c *cloner) instanceOf(obj *goja.Object, class string) bool {
+	ctor, ok := c.vm.Get(class).(*goja.Object)
+	return ok && c.vm.InstanceOf(obj, ctor)
+}
+
+// entries returns the items of the iterable obj, like Array.from(obj).
+func (c *cloner) entries(obj *goja.Object) []goja.Value {
+	from, _ := goja.AssertFunction(c.vm.Get("Array").ToObject(c.vm).Get("from"))
+	arr, err := from(nil, obj)
+	if err != nil {
+		return nil
+	}
+	a := arr.ToObject(c.vm)
+	n := a.Get("length").ToInteger()
+	ret := make([]goja.Value, n)
+	for i := int64(0); i < n; i++ {
+		ret[i] = a.Get(strconv.FormatInt(i, 10))
+	}
+	return ret
+}
+
+type restorer struct {
+	vm   *goja.Runtime
+	seen map[any]*goja.Object
+}
+
+// restoreValue returns the value of vm copied from v, made by cloneValue.
+func restoreValue(vm *goja.Runtime, v any) goja.Value {
+	r := &restorer{vm: vm, seen: map[any]*goja.Object{}}
+	return r.restore(v)
+}
+
+func (r *restorer) restore(v any) goja.Value {
+	switch v := v.(type) {
+	case cloneUndefined:
+		return goja.Undefined()
+	case nil:
+		return goja.Null()
+	case *cloneArray:
+		if obj, ok := r.seen[v]; ok {
+			return obj
+		}
+		arr := r.vm.NewArray()
+		r.seen[v] = arr
+		for i, item := range v.items {
+			arr.Set(strconv.Itoa(i), r.restore(item))
+		}
+		return arr
+	case *cloneObject:
+		if obj, ok := r.seen[v]; ok {
+			return obj
+		}
+		obj := r.vm.NewObject()
+		r.seen[v] = obj
+		for i, key := range v.keys {
+			obj.Set(key, r.restore(v.values[i]))
+		}
+		return obj
+	case *cloneMap:
+		if obj, ok := r.seen[v]; ok {
+			return obj
+		}
+		obj := r.construct("Map")
+		r.seen[v] = obj
+		set, _ := goja.AssertFunction(obj.Get("set"))
+		for _, entry := range v.entries {
+			set(obj, r.restore(entry[0]), r.restore(entry[1]))
+		}
+		return obj
+	case *cloneSet:
+		if obj, ok := r.seen[v]; ok {
+			return obj
+		}
+		obj := r.construct("Set")
+		r.seen[v] = obj
+		add, _ := goja.AssertFunction(obj.Get("add"))
+		for _, item := range v.items {
+			add(obj, r.restore(item))
+		}
+		return obj
+	case *cloneBytes:
+		if obj, ok := r.seen[v]; ok {
+			return obj
+		}
+		ab := r.vm.ToValue(r.vm.NewArrayBuffer(append([]byte(nil), v.data...)))
+		obj := ab.ToObject(r.vm)
+		if v.class != "ArrayBuffer" {
+			obj = r.construct(v.class, ab)
+		}
+		r.seen[v] = obj
+		return obj
+	case *cloneError:
+		class := "Error"
+		switch v.name {
+		case "TypeError", "RangeError", "SyntaxError", "ReferenceError", "EvalError", "URIError":
+			class = v.name
+		}
+		obj := r.construct(class, r.vm.ToValue(v.message))
+		if class != v.name {
+			obj.Set("name", v.name)
+		}
+		if v.stack != "" {
+			obj.Set("stack", v.stack)
+		}
+		return obj
+	case *cloneRegExp:
+		return r.construct("RegExp", r.vm.ToValue(v.source), r.vm.ToValue(v.flags))
+	case time.Time:
+		return r.construct("Date", r.vm.ToValue(v.UnixMilli()))
+	default:
+		return r.vm.ToValue(v)
+	}
+}
+
+func (r *restorer) construct(class string, args ...goja.Value) *goja.Object {
+	obj, err := r.vm.New(r.vm.Get(class), args...)
+	if err != nil {
+		panic(err)
+	}
+	return obj
+}
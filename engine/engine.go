@@ -1,11 +1,15 @@
 package engine
 
 import (
+	"context"
 	_ "embed"
+	"errors"
 	"fmt"
 	"os"
+	"path"
 	"runtime/debug"
 	"slices"
+	"strings"
 	"time"
 
 	"github.com/OutOfBedlam/jsh/log"
@@ -23,14 +27,37 @@ type JSRuntime struct {
 	Strict bool
 	Env    Env
 
+	file          *programKey // the script file, nil if the script is not loaded from a file
 	registry      *require.Registry
 	eventLoop     *eventloop.EventLoop
 	exitCode      int
+	timeout       time.Duration
 	shutdownHooks []func()
 	nowFunc       func() time.Time
+	clock         Clock // the time of the script, nil for the time of the system
+	execInProcess bool
+	cpuProfile    string
+	limits        Limits
+	memProfile    string
+	nativeModules map[string]require.ModuleLoader
+	fileLoaders   map[string]FileLoader     // the loaders of the files required, by extension
+	signals       map[string]chan os.Signal // the signals delivered as events, by name
+	uncaughtErr   error                     // the exception not handled, or process.exit(), that stopped the runtime
+	stdin         *stdinStream              // the buffered reader of process.stdin
+	worker        *workerLink               // the link to the parent, if it runs as a worker
+	conf          Config                    // the configuration the runtime is built from
+	watched       *watchSet                 // the files loaded by the script, in watch mode
+	runCtx        context.Context           // the context of the run, done when it returns, for the children
+	compiled      map[string]*goja.Program  // the programs of the modules required, by path, see compileModule
+	jobs          *pendingJobs              // the timers and the jobs pending on the event loop
+	vm            *goja.Runtime             // the runtime of the run, that require() throws its errors in
 }
 
 func (jr *JSRuntime) RegisterNativeModule(name string, loader require.ModuleLoader) {
+	if jr.nativeModules == nil {
+		jr.nativeModules = make(map[string]require.ModuleLoader)
+	}
+	jr.nativeModules[name] = loader
 	jr.registry.RegisterNativeModule(name, loader)
 }
 
@@ -38,57 +65,209 @@ func (jr *JSRuntime) EventLoop() *eventloop.EventLoop {
 	return jr.eventLoop
 }
 
+// Exit codes reported when the script is stopped by its context.
+const (
+	ExitCodeTimeout  = 124 // deadline exceeded, same as timeout(1)
+	ExitCodeCanceled = 130 // canceled, same as 128+SIGINT
+)
+
 func (jr *JSRuntime) Run() error {
+	return jr.RunContext(context.Background())
+}
+
+// RunContext runs the script like Run, but interrupts the VM and stops
+// the event loop when ctx is done. In that case the shutdown hooks still run
+// and ctx.Err() is returned. It is the same for the Limits of the runtime,
+// with the *LimitError of the limit exceeded.
+func (jr *JSRuntime) RunContext(ctx context.Context) error {
+	return jr.runContext(ctx, nil)
+}
+
+// runContext is RunContext, that runs the script as a CommonJS module if loaded is not nil.
+// loaded is called on the event loop when the script has run, with its module object
+// or the error it has thrown.
+func (jr *JSRuntime) runContext(ctx context.Context, loaded func(vm *goja.Runtime, module *goja.Object, err error)) (retErr error) {
 	if jr.Env == nil {
 		jr.Env = &DefaultEnv{}
 	}
+	if jr.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, jr.timeout)
+		defer cancel()
+	}
+	ctx, failLimit, cancel := jr.limitContext(ctx)
+	defer cancel()
+	// the in-process children and the workers stop with the runtime
+	runCtx, stopRun := context.WithCancel(ctx)
+	defer stopRun()
+	jr.runCtx = runCtx
 
 	defer func() {
 		if r := recover(); r != nil {
 			if ie, ok := r.(*goja.InterruptedError); ok {
-				fmt.Fprintf(jr.Env.Writer(), "interrupted: %v\n", ie.Value())
+				fmt.Fprintf(jr.Env.ErrorWriter(), "interrupted: %v\n", ie.Value())
 			}
-			fmt.Fprintf(os.Stderr, "panic: %v\n%v\n", r, string(debug.Stack()))
-			os.Exit(1)
+			fmt.Fprintf(jr.Env.ErrorWriter(), "panic: %v\n%v\n", r, string(debug.Stack()))
+			retErr = fmt.Errorf("panic: %v", r)
+			jr.exitCode = 1
 		}
 	}()
 
+	stopProfile, err := jr.startProfile()
+	if err != nil {
+		return err
+	}
+	defer stopProfile()
+
 	// guarantee shutdown hooks run at the end
-	defer func() {
-		slices.Reverse(jr.shutdownHooks)
-		for _, hook := range jr.shutdownHooks {
-			hook()
-		}
-	}()
+	defer jr.runShutdownHooks()
 
-	program, err := goja.Compile(jr.Name, jr.Source, jr.Strict)
+	program, err := jr.compile()
 	if err != nil {
 		return err
 	}
-	var retErr error = nil
-	jr.eventLoop.Run(func(vm *goja.Runtime) {
+	var vm *goja.Runtime
+	var watch <-chan error
+	stop := make(chan struct{})
+	jr.eventLoop.Run(func(rt *goja.Runtime) {
+		vm = rt
+		jr.vm = vm
+		watch = jr.watchContext(ctx, vm, stop)
+		fail := func(err error) {
+			vm.Interrupt(err)
+			failLimit(err)
+		}
+		jr.enforceLimits(vm, fail, stop)
+		jr.trackRejections(vm)
+		if jr.clock != nil {
+			jr.useClock(vm)
+		}
+		jr.wrapTimers(vm, fail)
 		buffer.Enable(vm)
 		url.Enable(vm)
 		vm.SetFieldNameMapper(goja.UncapFieldNameMapper())
-		vm.Set("console", log.SetConsole(vm, jr.Env.Writer()))
-		if _, err := vm.RunProgram(program); err != nil {
+		vm.Set("console", log.SetConsoleWriters(vm, jr.Env.Writer(), jr.Env.ErrorWriter()))
+		var module *goja.Object
+		if loaded != nil {
+			module = vm.NewObject()
+			module.Set("exports", vm.NewObject())
+			vm.Set("module", module)
+			vm.Set("exports", module.Get("exports"))
+		}
+		_, err := vm.RunProgram(program)
+		if loaded != nil {
+			loaded(vm, module, err)
+		}
+		if err != nil {
+			if _, ok := err.(*goja.Exception); ok && jr.emitProcessEvent(vm, "uncaughtException", errorValue(vm, err), vm.ToValue("uncaughtException")) {
+				return
+			}
 			retErr = err
 			jr.exitCode = -1
+			if _, ok := err.(*goja.StackOverflowError); ok && jr.limits.StackDepth > 0 {
+				failLimit(&LimitError{Limit: LimitStackDepth, Max: jr.limits.StackDepth})
+			}
 		}
 	})
+	close(stop)
+	if err := <-watch; err != nil {
+		// let the shutdown hooks run JS again
+		vm.ClearInterrupt()
+		retErr = err
+		var limitErr *LimitError
+		if errors.As(err, &limitErr) {
+			jr.exitCode = ExitCodeLimit
+		} else if err == context.DeadlineExceeded {
+			jr.exitCode = ExitCodeTimeout
+		} else {
+			jr.exitCode = ExitCodeCanceled
+		}
+	} else if jr.uncaughtErr != nil {
+		vm.ClearInterrupt()
+		retErr = jr.uncaughtErr
+		jr.exitCode = ExitCodeUncaught
+		if ie, ok := retErr.(*goja.InterruptedError); ok {
+			if exit, ok := ie.Value().(Exit); ok {
+				jr.exitCode = exit.Code
+			}
+		}
+	}
 	return retErr
 }
 
+// runShutdownHooks runs the shutdown hooks in the reverse order they are added.
+// A hook that panics does not keep the others from running.
+func (jr *JSRuntime) runShutdownHooks() {
+	slices.Reverse(jr.shutdownHooks)
+	for _, hook := range jr.shutdownHooks {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					if ex, ok := r.(*goja.Exception); ok {
+						fmt.Fprintln(jr.Env.ErrorWriter(), "shutdown hook:", strings.TrimSpace(ex.String()))
+					} else {
+						fmt.Fprintln(jr.Env.ErrorWriter(), "shutdown hook:", r)
+					}
+				}
+			}()
+			hook()
+		}()
+	}
+}
+
+// watchContext interrupts vm and stops the event loop when ctx is done.
+// The returned channel yields the cause of ctx if that happened before stop is closed.
+func (jr *JSRuntime) watchContext(ctx context.Context, vm *goja.Runtime, stop <-chan struct{}) <-chan error {
+	ch := make(chan error, 1)
+	go func() {
+		defer close(ch)
+		select {
+		case <-ctx.Done():
+			vm.Interrupt(context.Cause(ctx))
+			jr.eventLoop.StopNoWait()
+			ch <- context.Cause(ctx)
+		case <-stop:
+			// the script may have been interrupted just before it ended
+			if ctx.Err() != nil {
+				ch <- context.Cause(ctx)
+			}
+		}
+	}()
+	return ch
+}
+
 func (jr *JSRuntime) ExitCode() int {
 	return jr.exitCode
 }
 
 func (jr *JSRuntime) loadSource(moduleName string) ([]byte, error) {
-	return LoadSource(jr.Env, moduleName)
+	var b []byte
+	var file string
+	var err error
+	if loader, ok := jr.fileLoaders[path.Ext(moduleName)]; ok {
+		b, file, err = loadDataFile(jr.Env, moduleName, loader)
+	} else {
+		b, file, err = loadModuleFile(jr.Env, moduleName, moduleWrapperLen)
+		if err == nil {
+			b = jr.compileModule(moduleName, file, b)
+		}
+	}
+	if err == nil && jr.watched != nil {
+		jr.watched.add(jr.Env.Filesystem(), file)
+	}
+	return b, err
 }
 
+// pathResolver is the PathResolver of require(), that throws a TypeError with the code
+// ERR_PACKAGE_PATH_NOT_EXPORTED for the subpaths that a package does not export.
 func (jr *JSRuntime) pathResolver(base, target string) string {
-	return PathResolver(jr.Env, base, target)
+	p, err := resolvePath(jr.Env, base, target)
+	if err != nil && jr.vm != nil {
+		ex := jr.vm.NewTypeError(err.Error())
+		ex.Set("code", "ERR_PACKAGE_PATH_NOT_EXPORTED")
+		panic(ex)
+	}
+	return p
 }
 
 func (jr *JSRuntime) AddShutdownHook(hook func()) {
@@ -96,13 +275,16 @@ func (jr *JSRuntime) AddShutdownHook(hook func()) {
 }
 
 func (jr *JSRuntime) Exec(vm *goja.Runtime, source string, args []string) goja.Value {
+	if jr.execInProcess {
+		return jr.execChild(vm, source, args)
+	}
 	eb := jr.Env.ExecBuilder()
 	if eb == nil {
 		return vm.NewGoError(fmt.Errorf("no command builder defined"))
 	}
-	var env map[string]any
-	if de, ok := jr.Env.(*DefaultEnv); ok {
-		env = de.vars
+	env := make(map[string]any)
+	for _, k := range jr.Env.Keys() {
+		env[k] = jr.Env.Get(k)
 	}
 	cmd, err := eb(source, args, env)
 	if err != nil {
@@ -110,3 +292,45 @@ func (jr *JSRuntime) Exec(vm *goja.Runtime, source string, args []string) goja.V
 	}
 	return jr.exec0(vm, cmd)
 }
+
+// execChild runs the command in a child JSRuntime of the same process.
+// The child has its own event loop and Env, shares the mounted filesystem
+// and the stdin/stdout of the parent, and runs on its own goroutine
+// while the caller waits for its exit code. The child reads the stdin
+// buffered by the parent and stops when the run of the parent stops.
+func (jr *JSRuntime) execChild(vm *goja.Runtime, source string, args []string) goja.Value {
+	env := NewEnv(
+		WithFilesystem(jr.Env.Filesystem()),
+		WithReader(jr.stdinStream().reader),
+		WithWriter(jr.Env.Writer()),
+		WithErrorWriter(jr.Env.ErrorWriter()),
+		WithExecBuilder(jr.Env.ExecBuilder()),
+	)
+	for _, k := range jr.Env.Keys() {
+		env.Set(k, jr.Env.Get(k))
+	}
+	conf := Config{
+		Code:          source,
+		Args:          args,
+		ExecInProcess: true,
+		Limits:        jr.limits,
+		Clock:         jr.clock,
+	}
+	child, err := newJSRuntime(conf, env)
+	if err != nil {
+		fmt.Fprintln(jr.Env.ErrorWriter(), err.Error())
+		return vm.ToValue(1)
+	}
+	jr.inheritModules(child)
+
+	ctx := jr.runCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	done := make(chan int)
+	go func() {
+		done <- child.exitStatus(child.RunContext(ctx))
+	}()
+	// exit status of an OS process is 0-255
+	return vm.ToValue(<-done & 0xff)
+}
@@ -8,3 +8,14 @@ const (
 	ioctlReadTermios  = syscall.TIOCGETA
 	ioctlWriteTermios = syscall.TIOCSETA
 )
+
+// residentSize returns the maximum resident set size the process has reached, in bytes,
+// as getrusage reports it on darwin. It is not the current one, which needs task_info
+// of mach, not available without cgo, so it does not go down when the memory is freed.
+func residentSize() uint64 {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0
+	}
+	return uint64(ru.Maxrss)
+}
@@ -2,9 +2,32 @@
 
 package engine
 
-import "syscall"
+import (
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
 
 const (
 	ioctlReadTermios  = syscall.TCGETS
 	ioctlWriteTermios = syscall.TCSETS
 )
+
+// residentSize returns the resident set size of the process in bytes.
+func residentSize() uint64 {
+	// size resident shared text lib data dt, in pages
+	b, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) < 2 {
+		return 0
+	}
+	pages, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return pages * uint64(os.Getpagesize())
+}
@@ -2,12 +2,15 @@ package engine
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 )
 
 type TestCase struct {
@@ -163,6 +166,73 @@ func TestEngine(t *testing.T) {
 				"Package help",
 			},
 		},
+		{
+			name: "module_resolution",
+			script: `
+				require("/work/resolve/app/main.js");
+			`,
+			output: []string{
+				"sub/dir/mod shared/util",
+				"shared/util",
+				"config.json 8080",
+				"app/node_modules/local",
+				"withmain/lib/entry withmain/node_modules/inner",
+				"nomain/index",
+				"dirmain/src/index",
+				"function",
+			},
+		},
+		{
+			name: "module_resolution_exports",
+			script: `
+				require("/work/resolve/app/exports.js");
+			`,
+			output: []string{
+				"exp/cjs/index",
+				"exp/lib/feature exp/lib/internal/helper nomain/index",
+				"exp/lib/utils/str",
+				"exp",
+				"@scope/pkg/main",
+				"config.json",
+				"TypeError ERR_PACKAGE_PATH_NOT_EXPORTED subpath ./utils/private/secret is not exported by exp",
+				"TypeError ERR_PACKAGE_PATH_NOT_EXPORTED subpath ./lib/utils/private/secret is not exported by exp",
+				"TypeError ERR_PACKAGE_PATH_NOT_EXPORTED subpath ./legacy is not exported by exp",
+				"TypeError ERR_PACKAGE_PATH_NOT_EXPORTED subpath ./legacy.js is not exported by exp",
+				"#util/util not found",
+				"#missing not found",
+			},
+		},
+		{
+			name: "module_resolution_relative",
+			script: `
+				// relative to PWD, /work
+				const mod = require("./resolve/app/sub/dir/mod");
+				const { sayHello } = require("demo");
+				console.println(mod.name);
+				sayHello("");
+			`,
+			output: []string{
+				"sub/dir/mod",
+				"Hello  from demo.js!",
+			},
+		},
+		{
+			name: "module_resolution_path",
+			script: `
+				// not in node_modules, found in the PATH directories
+				const { parseArgs } = require("util/parseArgs");
+				console.println(typeof parseArgs);
+				try {
+					require("no-such-module");
+				} catch (e) {
+					console.println("not found");
+				}
+			`,
+			output: []string{
+				"function",
+				"not found",
+			},
+		},
 	}
 
 	for _, tc := range ts {
@@ -179,7 +249,6 @@ func TestSetTimeout(t *testing.T) {
 				let t = now();
 				setTimeout(() => {
 					console.log("Timeout executed");
-					testDone();
 				}, 100);
 			`,
 			output: []string{
@@ -194,7 +263,6 @@ func TestSetTimeout(t *testing.T) {
 					console.println("Timeout with args:", a, b);
 					arg1 = a;
 					arg2 = b;
-					testDone();
 				}, 50,  "test", 42);
 			`,
 			output: []string{
@@ -213,7 +281,7 @@ func TestSetTimeout(t *testing.T) {
 					tm = setTimeout(add, 50, a+1);
 					if(counter >= 3) {
 						clearTimeout(tm);
-						setTimeout(()=>{testDone();}, 100);
+						setTimeout(()=>{}, 100);
 					}
 					console.println("count:", counter,", sum:", sum);					
 				}
@@ -229,10 +297,10 @@ func TestSetTimeout(t *testing.T) {
 			name: "clearTimeout_twice",
 			script: `
 				var executed = false;
-				var tm = setTimeout(()=>{ executed = true; testDone(); }, 50);
+				var tm = setTimeout(()=>{ executed = true; }, 50);
 				clearTimeout(tm);
 				clearTimeout(tm);
-				setTimeout(()=>{ testDone(); }, 50); // Ensure test completes
+				setTimeout(()=>{ if (executed) console.println("executed"); }, 50); // Ensure test completes
 				`,
 			output: []string{
 				// No output expected regarding execution
@@ -244,6 +312,172 @@ func TestSetTimeout(t *testing.T) {
 	}
 }
 
+func TestRunContext(t *testing.T) {
+	newRuntime := func(t *testing.T, timeout time.Duration) (*JSRuntime, *bytes.Buffer) {
+		t.Helper()
+		output := &bytes.Buffer{}
+		jr, err := New(Config{
+			Name: t.Name(),
+			Code: `
+				const process = require("/lib/process");
+				process.addShutdownHook(() => {
+					console.println("cleanup");
+				});
+				setInterval(() => {}, 10);
+				console.println("running");
+			`,
+			FSTabs:  []FSTab{{MountPoint: "/", Source: "../native/root/"}},
+			Timeout: timeout,
+			Reader:  &bytes.Buffer{},
+			Writer:  output,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create JSRuntime: %v", err)
+		}
+		jr.RegisterNativeModule("@jsh/process", jr.Process)
+		return jr, output
+	}
+
+	t.Run("timeout", func(t *testing.T) {
+		jr, output := newRuntime(t, 100*time.Millisecond)
+		err := jr.Run()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Expected deadline exceeded, got %v", err)
+		}
+		if jr.ExitCode() != ExitCodeTimeout {
+			t.Errorf("Expected exit code %d, got %d", ExitCodeTimeout, jr.ExitCode())
+		}
+		if got := output.String(); got != "running\ncleanup\n" {
+			t.Errorf("Unexpected output: %q", got)
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		jr, output := newRuntime(t, 0)
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(100*time.Millisecond, cancel)
+		err := jr.RunContext(ctx)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Expected canceled, got %v", err)
+		}
+		if jr.ExitCode() != ExitCodeCanceled {
+			t.Errorf("Expected exit code %d, got %d", ExitCodeCanceled, jr.ExitCode())
+		}
+		if got := output.String(); got != "running\ncleanup\n" {
+			t.Errorf("Unexpected output: %q", got)
+		}
+	})
+
+	t.Run("exit_status", func(t *testing.T) {
+		tests := []struct {
+			timeout time.Duration
+			ctx     func() (context.Context, context.CancelFunc)
+			code    int
+			message string
+		}{
+			{100 * time.Millisecond, func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.Background())
+			}, ExitCodeTimeout, "timeout after 100ms\n"},
+			{0, func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 100*time.Millisecond)
+			}, ExitCodeTimeout, "timeout\n"},
+			{0, func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(100*time.Millisecond, cancel)
+				return ctx, cancel
+			}, ExitCodeCanceled, "canceled\n"},
+		}
+		for _, tc := range tests {
+			jr, output := newRuntime(t, tc.timeout)
+			ctx, cancel := tc.ctx()
+			code := jr.exitStatus(jr.RunContext(ctx))
+			cancel()
+			if code != tc.code {
+				t.Errorf("Expected exit code %d, got %d", tc.code, code)
+			}
+			if got := output.String(); got != "running\ncleanup\n"+tc.message {
+				t.Errorf("Unexpected output: %q", got)
+			}
+		}
+	})
+
+	t.Run("exec_child", func(t *testing.T) {
+		output := &bytes.Buffer{}
+		jr, err := New(Config{
+			Name: t.Name(),
+			Code: `
+				const process = require("/lib/process");
+				process.execString("console.println('child'); setInterval(() => {}, 10);");
+			`,
+			FSTabs:        []FSTab{{MountPoint: "/", Source: "../native/root/"}},
+			Timeout:       100 * time.Millisecond,
+			ExecInProcess: true,
+			Reader:        &bytes.Buffer{},
+			Writer:        output,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create JSRuntime: %v", err)
+		}
+		jr.RegisterNativeModule("@jsh/process", jr.Process)
+		done := make(chan error, 1)
+		go func() { done <- jr.Run() }()
+		select {
+		case err := <-done:
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("Expected deadline exceeded, got %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("The child kept running after the timeout of the parent")
+		}
+		if got := output.String(); got != "child\ntimeout\n" {
+			t.Errorf("Unexpected output: %q", got)
+		}
+	})
+}
+
+func TestConsolePerRuntime(t *testing.T) {
+	names := []string{"first", "second", "third"}
+	outputs := make([]*bytes.Buffer, len(names))
+	runtimes := make([]*JSRuntime, len(names))
+	for i, name := range names {
+		outputs[i] = &bytes.Buffer{}
+		jr, err := New(Config{
+			Name: name,
+			Code: `
+				let count = 0;
+				const tm = setInterval(() => {
+					console.println("` + name + `", ++count);
+					if (count >= 3) clearInterval(tm);
+				}, 10);
+			`,
+			FSTabs: []FSTab{{MountPoint: "/", Source: "../native/root/"}},
+			Reader: &bytes.Buffer{},
+			Writer: outputs[i],
+		})
+		if err != nil {
+			t.Fatalf("Failed to create JSRuntime: %v", err)
+		}
+		runtimes[i] = jr
+	}
+
+	errs := make(chan error, len(runtimes))
+	for _, jr := range runtimes {
+		go func() { errs <- jr.Run() }()
+	}
+	for range runtimes {
+		if err := <-errs; err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	for i, name := range names {
+		expected := fmt.Sprintf("%[1]s 1\n%[1]s 2\n%[1]s 3\n", name)
+		if got := outputs[i].String(); got != expected {
+			t.Errorf("Output of %s: expected %q, got %q", name, expected, got)
+		}
+	}
+}
+
 // TestShutdownHook tests have been moved to process_test.go
 
 func TestEventLoop(t *testing.T) {
@@ -4,6 +4,9 @@ package engine
 
 import (
 	"os/exec"
+	"syscall"
+	"time"
+	"unsafe"
 
 	"github.com/dop251/goja"
 )
@@ -11,7 +14,7 @@ import (
 func (jr *JSRuntime) exec0(vm *goja.Runtime, ex *exec.Cmd) goja.Value {
 	ex.Stdin = jr.Env.Reader()
 	ex.Stdout = jr.Env.Writer()
-	ex.Stderr = jr.Env.Writer()
+	ex.Stderr = jr.Env.ErrorWriter()
 
 	// Windows doesn't support process groups like Unix
 	// Just run the process directly
@@ -33,3 +36,59 @@ func (jr *JSRuntime) exec0(vm *goja.Runtime, ex *exec.Cmd) goja.Value {
 
 	return result
 }
+
+// cpuTimes returns the user and system CPU time of the process.
+func cpuTimes() (user, system time.Duration) {
+	h, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return 0, 0
+	}
+	var creation, exit, kernel, usr syscall.Filetime
+	if err := syscall.GetProcessTimes(h, &creation, &exit, &kernel, &usr); err != nil {
+		return 0, 0
+	}
+	// in 100-nanosecond intervals
+	ticks := func(ft syscall.Filetime) time.Duration {
+		return time.Duration(int64(ft.HighDateTime)<<32|int64(ft.LowDateTime)) * 100
+	}
+	return ticks(usr), ticks(kernel)
+}
+
+var procGetProcessMemoryInfo = syscall.NewLazyDLL("psapi.dll").NewProc("GetProcessMemoryInfo")
+
+// processMemoryCounters is PROCESS_MEMORY_COUNTERS of psapi.h.
+type processMemoryCounters struct {
+	cb                         uint32
+	PageFaultCount             uint32
+	PeakWorkingSetSize         uintptr
+	WorkingSetSize             uintptr
+	QuotaPeakPagedPoolUsage    uintptr
+	QuotaPagedPoolUsage        uintptr
+	QuotaPeakNonPagedPoolUsage uintptr
+	QuotaNonPagedPoolUsage     uintptr
+	PagefileUsage              uintptr
+	PeakPagefileUsage          uintptr
+}
+
+// residentSize returns the working set size of the process in bytes.
+func residentSize() uint64 {
+	h, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return 0
+	}
+	var pmc processMemoryCounters
+	pmc.cb = uint32(unsafe.Sizeof(pmc))
+	if r, _, _ := procGetProcessMemoryInfo.Call(uintptr(h), uintptr(unsafe.Pointer(&pmc)), uintptr(pmc.cb)); r == 0 {
+		return 0
+	}
+	return uint64(pmc.WorkingSetSize)
+}
+
+// signals are the signals kill sends and process.on receives, by name.
+// Windows has only these: kill can send SIGKILL, and process.on receives SIGINT
+// for Ctrl+C and Ctrl+Break, and SIGTERM when the console is closed or the system shuts down.
+var signals = map[string]syscall.Signal{
+	"SIGINT":  syscall.SIGINT,
+	"SIGKILL": syscall.SIGKILL,
+	"SIGTERM": syscall.SIGTERM,
+}
@@ -1,7 +1,9 @@
 package engine
 
 import (
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
@@ -9,14 +11,20 @@ import (
 	"os/exec"
 	"path"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
+
+	"github.com/dop251/goja_nodejs/require"
 )
 
 type Env interface {
 	Reader() io.Reader
 	Writer() io.Writer
+	ErrorWriter() io.Writer
 	Set(key string, value any)
 	Get(key string) any
+	Keys() []string
 	ExecBuilder() ExecBuilderFunc
 	Filesystem() fs.FS
 }
@@ -26,30 +34,107 @@ type Env interface {
 // if code is non-empty, it indicates that the code is being executed.
 type ExecBuilderFunc func(code string, args []string, env map[string]any) (*exec.Cmd, error)
 
-func PathResolver(env Env, base, path string) string {
-	if strings.HasPrefix(path, "/") {
-		return path
+// PathResolver resolves the module target required from the directory base, like Node.js does.
+// require() joins the relative paths, with their subdirectories and "..", to the directory
+// of the module, and searches the bare names in the node_modules directories from there
+// up to the root. A base that is not absolute, the one of a script without a file, is relative to PWD.
+// The "exports" of the package.json of a package map the bare names of its entries,
+// like "pkg/sub", and hide its other files, and the "imports" of the package.json of
+// the module map the "#" names.
+// The bare names not found in the node_modules directories are searched in the PATH directories.
+// A subpath that the "exports" of its package do not export resolves to "".
+func PathResolver(env Env, base, target string) string {
+	p, _ := resolvePath(env, base, target)
+	return p
+}
+
+// resolvePath is PathResolver, that returns a *notExportedError for a subpath
+// that the "exports" of its package do not export.
+func resolvePath(env Env, base, target string) (string, error) {
+	target = filepath.ToSlash(target)
+	if strings.HasPrefix(target, "/") {
+		return CleanPath(target), nil
 	}
-	// require.DefaultPathResolver(base, target)
-	p := filepath.Join(filepath.ToSlash(base), filepath.Base(path))
-	if resolved, err := filepath.EvalSymlinks(p); err == nil {
-		p = resolved
+	base = filepath.ToSlash(base)
+	// the last of the node_modules directories that require() searches
+	last := base == "/node_modules" || base == "node_modules"
+	if !strings.HasPrefix(base, "/") {
+		pwd, _ := env.Get("PWD").(string)
+		base = path.Join(CleanPath(pwd), base)
 	}
-	return filepath.ToSlash(p)
+	fileSystem := env.Filesystem()
+	if fileSystem != nil {
+		if strings.HasPrefix(target, "#") {
+			// the "imports" of the package that requires it
+			dir := base
+			if path.Base(dir) == "node_modules" {
+				dir = path.Dir(dir)
+			}
+			if p, ok := resolvePackageImports(fileSystem, CleanPath(dir), target); ok {
+				return p, nil
+			}
+		} else if path.Base(base) == "node_modules" && !strings.HasPrefix(target, ".") {
+			// the "exports" of the package, that take precedence over its main and files
+			if p, ok, err := resolvePackageExports(fileSystem, CleanPath(base), target); ok {
+				return p, err
+			}
+		}
+	}
+	p := CleanPath(path.Join(base, target))
+	if !last || fileSystem == nil || moduleExists(fileSystem, p) {
+		return p, nil
+	}
+	if v, ok := env.Get("PATH").(string); ok {
+		for _, dir := range strings.Split(v, ":") {
+			if dir == "" {
+				continue
+			}
+			if alt := CleanPath(path.Join(dir, target)); moduleExists(fileSystem, alt) {
+				return alt, nil
+			}
+		}
+	}
+	return p, nil
+}
+
+// moduleExists reports whether require() finds a module at p, a file or a directory.
+func moduleExists(fileSystem fs.FS, p string) bool {
+	for _, name := range []string{p, p + ".js", p + ".json", p + ".ts"} {
+		if _, err := fs.Stat(fileSystem, name); err == nil {
+			return true
+		}
+	}
+	return false
 }
 
+var ErrModuleNotFound = errors.New("module not found")
+
 func LoadSource(env Env, moduleName string) ([]byte, error) {
+	return loadModuleSource(env, moduleName, 0)
+}
+
+// loadModuleSource is LoadSource for the sources that are prefixed with shift characters
+// on their first line when they are compiled, like goja_nodejs does for the modules.
+// The source maps of the sources account for them.
+func loadModuleSource(env Env, moduleName string, shift int) ([]byte, error) {
+	b, _, err := loadScript(env, moduleName, shift)
+	return b, err
+}
+
+// loadScript is loadModuleSource that also returns the path of the file the source is loaded from.
+func loadScript(env Env, moduleName string, shift int) ([]byte, string, error) {
 	moduleName = filepath.ToSlash(moduleName) // for Windows compatibility
 	var fileSystem fs.FS = env.Filesystem()
 	if fileSystem == nil {
-		return nil, fmt.Errorf("no filesystem available to load module: %s", moduleName)
+		return nil, "", fmt.Errorf("no filesystem available to load module: %s", moduleName)
 	}
 
 	if strings.HasPrefix(moduleName, "/") {
 		moduleName = CleanPath(moduleName)
-		b, err := loadSource(fileSystem, moduleName)
+		b, file, err := loadSource(fileSystem, moduleName)
 		if err == nil {
-			return b, nil
+			b, err = moduleSource(fileSystem, file, b, shift)
+			return b, file, err
 		}
 	} else {
 		findings := []string{
@@ -64,74 +149,212 @@ func LoadSource(env Env, moduleName string) ([]byte, error) {
 		}
 		for _, path := range findings {
 			path = CleanPath(path)
-			b, err := loadSource(fileSystem, path)
+			b, file, err := loadSource(fileSystem, path)
 			if err == nil {
-				return b, nil
+				b, err = moduleSource(fileSystem, file, b, shift)
+				return b, file, err
 			}
 		}
 	}
-	return nil, fmt.Errorf("module not found: %s", moduleName)
+	return nil, "", fmt.Errorf("%w: %s", ErrModuleNotFound, moduleName)
 }
 
-func loadSource(fileSystem fs.FS, moduleName string) ([]byte, error) {
+// loadModuleFile loads the file p, or its alternate like the .ts of a .js, for require().
+// require() probes the files and the directories of the modules itself, like Node.js does,
+// so it returns require.ModuleFileDoesNotExistError for a directory or a missing file
+// to let require() try the next one.
+func loadModuleFile(env Env, p string, shift int) ([]byte, string, error) {
+	fileSystem := env.Filesystem()
+	if fileSystem == nil {
+		return nil, "", fmt.Errorf("no filesystem available to load module: %s", p)
+	}
+	p = CleanPath(filepath.ToSlash(p))
+	for _, name := range append([]string{p}, sourceAlternates(p)...) {
+		if fi, err := fs.Stat(fileSystem, name); err != nil || fi.IsDir() {
+			continue
+		}
+		b, err := fs.ReadFile(fileSystem, name)
+		if err != nil {
+			return nil, "", err
+		}
+		b, err = moduleSource(fileSystem, name, b, shift)
+		return b, name, err
+	}
+	return nil, "", require.ModuleFileDoesNotExistError
+}
+
+// moduleSource returns the source b loaded from file, with the types stripped if it is
+// TypeScript and rewritten into CommonJS if it is an ES module, and its source map inlined.
+func moduleSource(fileSystem fs.FS, file string, b []byte, shift int) ([]byte, error) {
+	out, err := transpile(fileSystem, file, b)
+	if err != nil {
+		return nil, err
+	}
+	return inlineSourceMap(fileSystem, file, b, out, shift), nil
+}
+
+// transpile returns the source b loaded from file, with the types stripped if it is
+// TypeScript and rewritten into CommonJS if it is an ES module.
+func transpile(fileSystem fs.FS, file string, b []byte) ([]byte, error) {
+	ts := isTypeScript(file)
+	esm := isESModule(fileSystem, file, b)
+	if !ts && !esm {
+		return b, nil
+	}
+	key := transpiledKey(file, ts, esm, b)
+	if out, ok := transpiled.get(key); ok {
+		return out, nil
+	}
+	if out, ok := readCache(key); ok {
+		transpiled.put(key, out)
+		return out, nil
+	}
+	var err error
+	if ts {
+		if b, err = StripTypes(file, b); err != nil {
+			return nil, err
+		}
+	}
+	if esm {
+		if b, err = TransformESM(file, b); err != nil {
+			return nil, err
+		}
+	}
+	transpiled.put(key, b)
+	writeCache(key, b)
+	return b, nil
+}
+
+// transpiled caches the sources rewritten by transpile, so that the modules
+// required again, by other runtimes or by exec children, are not rewritten again.
+// The cache directory set by SetCacheDir keeps them for the other processes.
+var transpiled = &sourceCache{max: 256}
+
+// transpiledKey returns the cache key of the source b of file rewritten by transpile.
+func transpiledKey(file string, ts, esm bool, b []byte) [sha256.Size]byte {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%t\x00%t\x00", file, ts, esm)
+	h.Write(b)
+	var key [sha256.Size]byte
+	h.Sum(key[:0])
+	return key
+}
+
+type sourceCache struct {
+	sync.Mutex
+	max     int
+	entries map[[sha256.Size]byte][]byte
+}
+
+func (c *sourceCache) get(key [sha256.Size]byte) ([]byte, bool) {
+	c.Lock()
+	defer c.Unlock()
+	b, ok := c.entries[key]
+	return b, ok
+}
+
+func (c *sourceCache) put(key [sha256.Size]byte, b []byte) {
+	c.Lock()
+	defer c.Unlock()
+	if c.entries == nil || len(c.entries) >= c.max {
+		c.entries = make(map[[sha256.Size]byte][]byte)
+	}
+	c.entries[key] = b
+}
+
+// loadSource returns the content of the module and the path of the file it is read from.
+func loadSource(fileSystem fs.FS, moduleName string) ([]byte, string, error) {
 	file, err := fileSystem.Open(moduleName)
 	if err != nil {
-		if !strings.HasSuffix(moduleName, ".js") {
-			file, err = fileSystem.Open(moduleName + ".js")
+		for _, name := range sourceAlternates(moduleName) {
+			if file, err = fileSystem.Open(name); err == nil {
+				moduleName = name
+				break
+			}
 		}
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 	}
 	defer file.Close()
 	isDir := false
 	if fi, err := file.Stat(); err != nil {
-		return nil, err
+		return nil, "", err
 	} else if fi.IsDir() {
 		isDir = true
 	}
 	if isDir {
 		return loadSourceFromDir(fileSystem, moduleName)
 	} else {
-		return io.ReadAll(file)
+		b, err := io.ReadAll(file)
+		return b, moduleName, err
 	}
 }
 
-func loadSourceFromDir(fileSystem fs.FS, moduleName string) ([]byte, error) {
+func loadSourceFromDir(fileSystem fs.FS, moduleName string) ([]byte, string, error) {
 	// look for package.json
 	pkgFile, err := fileSystem.Open(moduleName + "/package.json")
 	if err == nil {
 		defer pkgFile.Close()
 		pkgData, err := io.ReadAll(pkgFile)
 		if err != nil {
-			return nil, err
-		}
-		var mainEntry struct {
-			Main string `json:"main"`
+			return nil, "", err
 		}
+		var mainEntry packageJSON
 		if err := json.Unmarshal(pkgData, &mainEntry); err != nil {
-			return nil, err
+			return nil, "", err
+		}
+		if len(mainEntry.Exports) > 0 {
+			// the main entry of the "exports" takes precedence over the main
+			if p, ok := resolvePackageMap(fileSystem, moduleName, mainEntry.Exports, ".", false); ok {
+				if b, err := fs.ReadFile(fileSystem, p); err == nil {
+					return b, p, nil
+				}
+			}
 		}
 		if mainEntry.Main != "" {
 			mainPath := filepath.Join(moduleName, mainEntry.Main)
 			mainPath = filepath.ToSlash(mainPath)
-			if !strings.HasSuffix(mainPath, ".js") {
+			if !hasScriptExt(mainPath) {
 				mainPath += ".js"
 			}
 			if main, err := fileSystem.Open(mainPath); err == nil {
 				defer main.Close()
-				return io.ReadAll(main)
+				b, err := io.ReadAll(main)
+				return b, mainPath, err
 			}
 		}
 	} else {
-		// look for index.js
-		indexPath := moduleName + "/index.js"
-		if f, err := fileSystem.Open(indexPath); err == nil {
-			defer f.Close()
-			return io.ReadAll(f)
+		// look for index.js, or index.ts
+		for _, indexPath := range []string{moduleName + "/index.js", moduleName + "/index.ts"} {
+			if f, err := fileSystem.Open(indexPath); err == nil {
+				defer f.Close()
+				b, err := io.ReadAll(f)
+				return b, indexPath, err
+			}
 		}
 	}
-	return nil, fs.ErrNotExist
+	return nil, "", fs.ErrNotExist
+}
+
+// scriptExts are the file extensions of the scripts, ".js" is the default.
+var scriptExts = []string{".js", ".mjs", ".cjs", ".ts", ".mts", ".cts"}
+
+// sourceAlternates returns the file names to try when the module moduleName does not exist.
+// The ".js" extension is appended if missing, and TypeScript sources are looked for
+// in place of JavaScript ones, as "./lib.js" refers to "./lib.ts" in TypeScript.
+func sourceAlternates(moduleName string) []string {
+	switch ext := path.Ext(moduleName); ext {
+	case ".js", ".mjs", ".cjs":
+		return []string{strings.TrimSuffix(moduleName, ext) + strings.Replace(ext, "js", "ts", 1)}
+	case ".ts", ".mts", ".cts":
+		return nil
+	}
+	return []string{moduleName + ".js", moduleName + ".ts"}
+}
+
+func hasScriptExt(name string) bool {
+	return slices.Contains(scriptExts, path.Ext(name))
 }
 
 // cleanPath normalizes a path and ensures it starts with /
@@ -151,6 +374,7 @@ func CleanPath(p string) string {
 
 type DefaultEnv struct {
 	writer      io.Writer
+	errorWriter io.Writer
 	reader      io.Reader
 	fs          fs.FS
 	execBuilder ExecBuilderFunc
@@ -181,6 +405,14 @@ func WithWriter(w io.Writer) EnvOption {
 	}
 }
 
+// WithErrorWriter sets the writer of the error output,
+// like process.stderr and console.error.
+func WithErrorWriter(w io.Writer) EnvOption {
+	return func(de *DefaultEnv) {
+		de.errorWriter = w
+	}
+}
+
 func WithReader(r io.Reader) EnvOption {
 	return func(de *DefaultEnv) {
 		de.reader = r
@@ -207,6 +439,13 @@ func (de *DefaultEnv) Writer() io.Writer {
 	return os.Stdout
 }
 
+func (de *DefaultEnv) ErrorWriter() io.Writer {
+	if de.errorWriter != nil {
+		return de.errorWriter
+	}
+	return os.Stderr
+}
+
 func (de *DefaultEnv) Filesystem() fs.FS {
 	return de.fs
 }
@@ -232,3 +471,13 @@ func (de *DefaultEnv) Get(key string) any {
 	}
 	return de.vars[key]
 }
+
+// Keys returns the names of the variables in sorted order.
+func (de *DefaultEnv) Keys() []string {
+	keys := make([]string, 0, len(de.vars))
+	for k := range de.vars {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,135 @@
+package engine
+
+import (
+	"os"
+	"path"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// envObject is process.env, the variables of Env as the properties of a plain object.
+// The methods of Env, like get() and set(), are available as well,
+// and take precedence over the variables of the same names.
+type envObject struct {
+	vm      *goja.Runtime
+	env     Env
+	methods *goja.Object
+}
+
+var _ goja.DynamicObject = (*envObject)(nil)
+
+func newEnvObject(vm *goja.Runtime, env Env) *goja.Object {
+	return vm.NewDynamicObject(&envObject{
+		vm:      vm,
+		env:     env,
+		methods: vm.ToValue(env).ToObject(vm),
+	})
+}
+
+func (o *envObject) Get(key string) goja.Value {
+	if m := o.methods.Get(key); m != nil {
+		return m
+	}
+	if v := o.env.Get(key); v != nil {
+		return o.vm.ToValue(v)
+	}
+	return nil
+}
+
+// Set assigns the variable key, converted to a string like Node.js does.
+func (o *envObject) Set(key string, val goja.Value) bool {
+	if o.methods.Get(key) != nil {
+		return false
+	}
+	o.env.Set(key, val.String())
+	return true
+}
+
+func (o *envObject) Has(key string) bool {
+	return o.methods.Get(key) != nil || o.env.Get(key) != nil
+}
+
+func (o *envObject) Delete(key string) bool {
+	if o.methods.Get(key) != nil {
+		return false
+	}
+	o.env.Set(key, nil)
+	return true
+}
+
+func (o *envObject) Keys() []string {
+	return o.env.Keys()
+}
+
+// HostEnv selects the environment variables of the host OS
+// that are imported into the Env of the script.
+// The variables PATH, HOME and PWD are never imported, since they
+// refer to the mounted filesystem of the script, not to the host's.
+type HostEnv struct {
+	// Import enables importing the host environment variables.
+	Import bool `json:"import,omitempty"`
+	// Allow lists the path.Match patterns of the names to import, e.g. "LANG" or "AWS_*".
+	// All the names are allowed if it is empty.
+	Allow EnvPatterns `json:"allow,omitempty"`
+	// Deny lists the patterns of the names not to import, even if allowed.
+	Deny EnvPatterns `json:"deny,omitempty"`
+}
+
+// Vars returns the host environment variables selected by he.
+func (he HostEnv) Vars() map[string]string {
+	ret := map[string]string{}
+	if !he.Import {
+		return ret
+	}
+	for _, kv := range os.Environ() {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || name == "" {
+			continue
+		}
+		if he.allows(name) {
+			ret[name] = value
+		}
+	}
+	return ret
+}
+
+func (he HostEnv) allows(name string) bool {
+	switch name {
+	case "PATH", "HOME", "PWD":
+		return false
+	}
+	if len(he.Allow) > 0 && !matchAny(he.Allow, name) {
+		return false
+	}
+	return !matchAny(he.Deny, name)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// EnvPatterns is a flag.Value of the name patterns of HostEnv,
+// that accepts comma separated patterns and repeated flags.
+type EnvPatterns []string
+
+func (ep *EnvPatterns) String() string {
+	return strings.Join(*ep, ",")
+}
+
+func (ep *EnvPatterns) Set(value string) error {
+	for _, p := range strings.Split(value, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			if _, err := path.Match(p, ""); err != nil {
+				return err
+			}
+			*ep = append(*ep, p)
+		}
+	}
+	return nil
+}
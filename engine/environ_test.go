@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestHostEnv(t *testing.T) {
+	t.Setenv("JSH_TEST_ALLOWED", "yes")
+	t.Setenv("JSH_TEST_SECRET", "no")
+	t.Setenv("JSH_OTHER", "no")
+
+	he := HostEnv{Import: true}
+	he.Allow.Set("JSH_TEST_*")
+	he.Deny.Set("*_SECRET")
+	vars := he.Vars()
+	if vars["JSH_TEST_ALLOWED"] != "yes" {
+		t.Errorf("JSH_TEST_ALLOWED is not imported: %v", vars)
+	}
+	for _, name := range []string{"JSH_TEST_SECRET", "JSH_OTHER", "PATH", "HOME"} {
+		if _, ok := vars[name]; ok {
+			t.Errorf("%s is imported", name)
+		}
+	}
+	if vars := (HostEnv{Allow: EnvPatterns{"*"}}).Vars(); len(vars) != 0 {
+		t.Errorf("imported without Import: %v", vars)
+	}
+
+	out := &bytes.Buffer{}
+	conf := Config{
+		Name:    "host_env",
+		Code:    `const env = require("/lib/process").env; console.println(env.JSH_TEST_ALLOWED, env.JSH_OTHER, env.PATH)`,
+		FSTabs:  []FSTab{{MountPoint: "/", Source: "../native/root/"}},
+		Env:     map[string]any{"JSH_OTHER": "overridden"},
+		HostEnv: HostEnv{Import: true, Allow: EnvPatterns{"JSH_*"}},
+		Reader:  &bytes.Buffer{},
+		Writer:  out,
+	}
+	jr, err := New(conf)
+	if err != nil {
+		t.Fatalf("Failed to create JSRuntime: %v", err)
+	}
+	jr.RegisterNativeModule("@jsh/process", jr.Process)
+	if err := jr.Run(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := out.String(); got != "yes overridden /sbin:/lib\n" {
+		t.Errorf("unexpected output %q", got)
+	}
+}
+
+func TestEnvPatterns(t *testing.T) {
+	var ep EnvPatterns
+	if err := ep.Set("LANG, LC_*"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ep.Set("AWS_*"); err != nil {
+		t.Fatal(err)
+	}
+	if got := ep.String(); got != "LANG,LC_*,AWS_*" {
+		t.Errorf("unexpected patterns %q", got)
+	}
+	if err := ep.Set("["); err == nil {
+		t.Error("expected an error for a malformed pattern")
+	}
+}
@@ -0,0 +1,830 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ES module support
+//
+// goja runs scripts only, so ES modules are rewritten into CommonJS when they are loaded.
+// Import declarations become require() calls hoisted to the first line, and the exported
+// bindings become getters of the exports object, so a namespace import (import * as ns)
+// sees their current values. Named imports are bound when the module is imported.
+// The rewritten source keeps the line numbers of the original one.
+
+// isESModule reports whether the source loaded from the file p is an ES module.
+// .mjs and .mts files always are, .cjs, .cts and .json files never are, other files are ES modules
+// if the nearest package.json declares "type": "module" or if they use import/export.
+func isESModule(fileSystem fs.FS, p string, src []byte) bool {
+	switch path.Ext(p) {
+	case ".mjs", ".mts":
+		return true
+	case ".cjs", ".cts", ".json":
+		return false
+	}
+	if packageType(fileSystem, path.Dir(p)) == "module" {
+		return true
+	}
+	return hasESMSyntax(src)
+}
+
+// packageType returns the "type" field of the nearest package.json from dir.
+func packageType(fileSystem fs.FS, dir string) string {
+	for {
+		if b, err := fs.ReadFile(fileSystem, CleanPath(path.Join(dir, "package.json"))); err == nil {
+			var pkg struct {
+				Type string `json:"type"`
+			}
+			json.Unmarshal(b, &pkg)
+			return pkg.Type
+		}
+		if dir == "/" || dir == "." || dir == "" {
+			return ""
+		}
+		dir = path.Dir(dir)
+	}
+}
+
+// hasESMSyntax reports whether src has import/export declarations or import() calls.
+func hasESMSyntax(src []byte) bool {
+	if !bytes.Contains(src, []byte("import")) && !bytes.Contains(src, []byte("export")) {
+		return false
+	}
+	toks := tokenizeJS(src)
+	depth := 0
+	for i, t := range toks {
+		switch {
+		case t.isPunct("{", "(", "["):
+			depth++
+		case t.isPunct("}", ")", "]"):
+			depth--
+		case t.kind == tokIdent && (i == 0 || !toks[i-1].isPunct(".")):
+			if t.text == "import" && (isImportCall(toks, i) || i+1 < len(toks) && toks[i+1].isPunct(".")) {
+				return true
+			}
+			if depth == 0 && (t.text == "import" || t.text == "export") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// TransformESM rewrites the ES module src, loaded from the file named filename, into CommonJS.
+func TransformESM(filename string, src []byte) ([]byte, error) {
+	if len(src) > 1 && src[0] == '#' && src[1] == '!' {
+		src = append([]byte("//"), src[2:]...)
+	}
+	tr := &esmTransformer{src: src, toks: tokenizeJS(src), filename: filename}
+	if err := tr.transform(); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return tr.output(), nil
+}
+
+type esmEdit struct {
+	start, end int
+	text       string
+}
+
+type esmTransformer struct {
+	src      []byte
+	toks     []jsToken
+	filename string
+
+	edits    []esmEdit
+	imports  []string // hoisted require() statements
+	exports  []string // exported name -> expression, as defineProperty statements
+	modules  int      // number of imported modules, for unique names
+	useMeta  bool
+	useDyn   bool
+	useStars bool
+}
+
+func (tr *esmTransformer) transform() error {
+	depth := 0
+	for i := 0; i < len(tr.toks); i++ {
+		t := tr.toks[i]
+		switch {
+		case t.isPunct("{", "(", "["):
+			depth++
+			continue
+		case t.isPunct("}", ")", "]"):
+			depth--
+			continue
+		case t.kind != tokIdent || (i > 0 && tr.toks[i-1].isPunct(".")):
+			continue
+		}
+		var next *jsToken
+		if i+1 < len(tr.toks) {
+			next = &tr.toks[i+1]
+		}
+		var err error
+		switch {
+		case t.text == "import" && isImportCall(tr.toks, i):
+			tr.useDyn = true
+			tr.edit(t.start, t.end, "__jsh_import")
+		case t.text == "import" && next != nil && next.isPunct("."):
+			// import.meta
+			if i+2 < len(tr.toks) && tr.toks[i+2].text == "meta" {
+				tr.useMeta = true
+				tr.edit(t.start, tr.toks[i+2].end, "__jsh_import_meta")
+				i += 2
+			}
+		case t.text == "import" && depth == 0 && (next == nil || !next.isPunct("(")):
+			i, err = tr.importDecl(i)
+		case t.text == "export" && depth == 0:
+			i, err = tr.exportDecl(i)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importDecl rewrites the import declaration at toks[i] and returns the index of its last token.
+func (tr *esmTransformer) importDecl(i int) (int, error) {
+	start := tr.toks[i].start
+	i++
+	if i < len(tr.toks) && tr.toks[i].kind == tokString {
+		// import "module"
+		tr.imports = append(tr.imports, fmt.Sprintf("require(%s);", tr.toks[i].text))
+		end := tr.declEnd(i)
+		tr.remove(start, tr.toks[end].end)
+		return end, nil
+	}
+	var defName, nsName string
+	var named []string
+	for ; i < len(tr.toks); i++ {
+		t := tr.toks[i]
+		switch {
+		case t.isPunct(","):
+		case t.isPunct("*"):
+			// * as ns
+			if i+2 >= len(tr.toks) || tr.toks[i+1].text != "as" {
+				return i, tr.errorAt(t, "invalid namespace import")
+			}
+			nsName = tr.toks[i+2].text
+			i += 2
+		case t.isPunct("{"):
+			specs, next, err := tr.specifiers(i)
+			if err != nil {
+				return i, err
+			}
+			for _, s := range specs {
+				named = append(named, fmt.Sprintf("%s: %s", jsPropKey(s[0]), s[1]))
+			}
+			i = next
+		case t.kind == tokIdent && t.text == "from":
+			if i+1 >= len(tr.toks) || tr.toks[i+1].kind != tokString {
+				return i, tr.errorAt(t, "missing module specifier")
+			}
+			mod := tr.module(tr.toks[i+1].text)
+			if defName != "" {
+				tr.imports = append(tr.imports, fmt.Sprintf("const %s = %s.default;", defName, mod))
+			}
+			if nsName != "" {
+				tr.imports = append(tr.imports, fmt.Sprintf("const %s = %s;", nsName, mod))
+			}
+			if len(named) > 0 {
+				tr.imports = append(tr.imports, fmt.Sprintf("const { %s } = %s;", strings.Join(named, ", "), mod))
+			}
+			end := tr.declEnd(i + 1)
+			tr.remove(start, tr.toks[end].end)
+			return end, nil
+		case t.kind == tokIdent:
+			defName = t.text
+		default:
+			return i, tr.errorAt(t, "unexpected token in import declaration")
+		}
+	}
+	return i, fmt.Errorf("unterminated import declaration")
+}
+
+// exportDecl rewrites the export declaration at toks[i] and returns the index of its last token.
+func (tr *esmTransformer) exportDecl(i int) (int, error) {
+	exp := tr.toks[i]
+	if i+1 >= len(tr.toks) {
+		return i, tr.errorAt(exp, "unexpected end of export declaration")
+	}
+	t := tr.toks[i+1]
+	switch {
+	case t.kind == tokIdent && t.text == "default":
+		if name, ok := tr.declName(i + 2); ok && name != "" {
+			// export default function name() {} / export default class name {}
+			tr.remove(exp.start, tr.toks[i+2].start)
+			tr.export("default", name)
+		} else {
+			tr.edit(exp.start, t.end, "__jsh_exports.default =")
+		}
+		return i + 1, nil
+	case t.kind == tokIdent && (t.text == "const" || t.text == "let" || t.text == "var"):
+		names, err := tr.declarators(i + 2)
+		if err != nil {
+			return i, err
+		}
+		tr.remove(exp.start, t.start)
+		for _, n := range names {
+			tr.export(n, n)
+		}
+		// the initializers are scanned as usual
+		return i + 1, nil
+	case t.kind == tokIdent:
+		name, ok := tr.declName(i + 1)
+		if !ok || name == "" {
+			return i, tr.errorAt(t, "unexpected token in export declaration")
+		}
+		tr.remove(exp.start, t.start)
+		tr.export(name, name)
+		return i + 1, nil
+	case t.isPunct("*"):
+		// export * from "module" / export * as ns from "module"
+		j := i + 2
+		nsName := ""
+		if j+1 < len(tr.toks) && tr.toks[j].text == "as" {
+			nsName = tr.toks[j+1].text
+			j += 2
+		}
+		if j+1 >= len(tr.toks) || tr.toks[j].text != "from" || tr.toks[j+1].kind != tokString {
+			return i, tr.errorAt(t, "missing module specifier")
+		}
+		mod := tr.module(tr.toks[j+1].text)
+		if nsName != "" {
+			tr.export(nsName, mod)
+		} else {
+			tr.useStars = true
+			tr.imports = append(tr.imports, fmt.Sprintf("__jsh_export_star(%s);", mod))
+		}
+		end := tr.declEnd(j + 1)
+		tr.remove(exp.start, tr.toks[end].end)
+		return end, nil
+	case t.isPunct("{"):
+		// export { a, b as c } [from "module"]
+		specs, next, err := tr.specifiers(i + 1)
+		if err != nil {
+			return i, err
+		}
+		end := next
+		mod := ""
+		if next+1 < len(tr.toks) && tr.toks[next+1].text == "from" {
+			if next+2 >= len(tr.toks) || tr.toks[next+2].kind != tokString {
+				return i, tr.errorAt(tr.toks[next+1], "missing module specifier")
+			}
+			mod = tr.module(tr.toks[next+2].text)
+			end = next + 2
+		}
+		for _, s := range specs {
+			if mod != "" {
+				tr.export(s[1], mod+"["+strconv.Quote(s[0])+"]")
+			} else {
+				tr.export(s[1], s[0])
+			}
+		}
+		end = tr.declEnd(end)
+		tr.remove(exp.start, tr.toks[end].end)
+		return end, nil
+	}
+	return i, tr.errorAt(t, "unexpected token in export declaration")
+}
+
+// declName returns the name of the function or class declaration at toks[i].
+// ok is false if toks[i] does not start a function or class.
+func (tr *esmTransformer) declName(i int) (name string, ok bool) {
+	if i < len(tr.toks) && tr.toks[i].text == "async" {
+		i++
+	}
+	if i >= len(tr.toks) || tr.toks[i].kind != tokIdent {
+		return "", false
+	}
+	switch tr.toks[i].text {
+	case "function":
+		i++
+		if i < len(tr.toks) && tr.toks[i].isPunct("*") {
+			i++
+		}
+	case "class":
+		i++
+	default:
+		return "", false
+	}
+	if i < len(tr.toks) && tr.toks[i].kind == tokIdent && tr.toks[i].text != "extends" {
+		return tr.toks[i].text, true
+	}
+	return "", true
+}
+
+// specifiers parses "{ a, b as c }" at toks[i] into [local-or-imported, exported-or-local] pairs
+// and returns the index of the closing brace.
+func (tr *esmTransformer) specifiers(i int) ([][2]string, int, error) {
+	var ret [][2]string
+	for i++; i < len(tr.toks); i++ {
+		t := tr.toks[i]
+		switch {
+		case t.isPunct("}"):
+			return ret, i, nil
+		case t.isPunct(","):
+		case t.kind == tokIdent || t.kind == tokString:
+			name := t.text
+			if t.kind == tokString {
+				name, _ = strconv.Unquote(t.text)
+			}
+			alias := name
+			if i+2 < len(tr.toks) && tr.toks[i+1].text == "as" {
+				alias = tr.toks[i+2].text
+				if tr.toks[i+2].kind == tokString {
+					alias, _ = strconv.Unquote(alias)
+				}
+				i += 2
+			}
+			ret = append(ret, [2]string{name, alias})
+		default:
+			return nil, i, tr.errorAt(t, "unexpected token in specifiers")
+		}
+	}
+	return nil, i, fmt.Errorf("unterminated specifiers")
+}
+
+// declarators returns the names bound by the variable declarators starting at toks[i].
+func (tr *esmTransformer) declarators(i int) ([]string, error) {
+	var names []string
+	for i < len(tr.toks) {
+		n, next, err := tr.bindingNames(i)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, n...)
+		i = next
+		if i < len(tr.toks) && tr.toks[i].isPunct("=") {
+			i = tr.skipExpression(i + 1)
+		}
+		if i < len(tr.toks) && tr.toks[i].isPunct(",") {
+			i++
+			continue
+		}
+		break
+	}
+	return names, nil
+}
+
+// bindingNames returns the names of the binding identifier or pattern at toks[i]
+// and the index of the token after it.
+func (tr *esmTransformer) bindingNames(i int) ([]string, int, error) {
+	if i >= len(tr.toks) {
+		return nil, i, fmt.Errorf("unexpected end of declaration")
+	}
+	t := tr.toks[i]
+	switch {
+	case t.kind == tokIdent:
+		return []string{t.text}, i + 1, nil
+	case t.isPunct("["):
+		var names []string
+		for i++; i < len(tr.toks); {
+			switch {
+			case tr.toks[i].isPunct("]"):
+				return names, i + 1, nil
+			case tr.toks[i].isPunct(","), tr.toks[i].isPunct("."):
+				i++
+			default:
+				n, next, err := tr.bindingNames(i)
+				if err != nil {
+					return nil, i, err
+				}
+				names = append(names, n...)
+				i = next
+				if i < len(tr.toks) && tr.toks[i].isPunct("=") {
+					i = tr.skipExpression(i + 1)
+				}
+			}
+		}
+	case t.isPunct("{"):
+		var names []string
+		for i++; i < len(tr.toks); {
+			switch {
+			case tr.toks[i].isPunct("}"):
+				return names, i + 1, nil
+			case tr.toks[i].isPunct(","), tr.toks[i].isPunct("."):
+				i++
+			case tr.toks[i].isPunct("["):
+				// computed key
+				i = tr.skipGroup(i)
+			default:
+				key := tr.toks[i]
+				i++
+				if i < len(tr.toks) && tr.toks[i].isPunct(":") {
+					n, next, err := tr.bindingNames(i + 1)
+					if err != nil {
+						return nil, i, err
+					}
+					names = append(names, n...)
+					i = next
+				} else if key.kind == tokIdent {
+					names = append(names, key.text)
+				}
+				if i < len(tr.toks) && tr.toks[i].isPunct("=") {
+					i = tr.skipExpression(i + 1)
+				}
+			}
+		}
+	}
+	return nil, i, tr.errorAt(t, "unexpected token in binding")
+}
+
+// skipGroup returns the index after the bracket group opening at toks[i].
+func (tr *esmTransformer) skipGroup(i int) int {
+	depth := 0
+	for ; i < len(tr.toks); i++ {
+		switch {
+		case tr.toks[i].isPunct("{", "(", "["):
+			depth++
+		case tr.toks[i].isPunct("}", ")", "]"):
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return i
+}
+
+// skipExpression returns the index of the token that ends the expression starting at toks[i]:
+// a comma, a semicolon or a closing bracket at the same depth, or a token on a new line
+// where a statement may end.
+func (tr *esmTransformer) skipExpression(i int) int {
+	depth := 0
+	for ; i < len(tr.toks); i++ {
+		t := tr.toks[i]
+		if depth == 0 {
+			if t.isPunct(",", ";", "}", ")", "]") {
+				return i
+			}
+			if t.nl && i > 0 && tr.toks[i-1].endsStatement() && !t.continuesExpression() {
+				return i
+			}
+		}
+		switch {
+		case t.isPunct("{", "(", "["):
+			depth++
+		case t.isPunct("}", ")", "]"):
+			depth--
+		}
+	}
+	return i
+}
+
+// declEnd returns the index of the optional semicolon after toks[i], otherwise i.
+// Import attributes ("with {...}") are skipped as well.
+func (tr *esmTransformer) declEnd(i int) int {
+	if i+2 < len(tr.toks) && (tr.toks[i+1].text == "with" || tr.toks[i+1].text == "assert") && tr.toks[i+2].isPunct("{") && !tr.toks[i+1].nl {
+		i = tr.skipGroup(i+2) - 1
+	}
+	if i+1 < len(tr.toks) && tr.toks[i+1].isPunct(";") {
+		return i + 1
+	}
+	return i
+}
+
+// module hoists require() of the module specifier and returns the variable holding it.
+func (tr *esmTransformer) module(spec string) string {
+	tr.modules++
+	name := fmt.Sprintf("__jsh_m%d", tr.modules)
+	tr.imports = append(tr.imports, fmt.Sprintf("const %s = __jsh_interop(require(%s));", name, spec))
+	return name
+}
+
+func (tr *esmTransformer) export(name, expr string) {
+	tr.exports = append(tr.exports, fmt.Sprintf(
+		"Object.defineProperty(__jsh_exports, %s, { enumerable: true, get: () => %s });",
+		strconv.Quote(name), expr))
+}
+
+func (tr *esmTransformer) edit(start, end int, text string) {
+	tr.edits = append(tr.edits, esmEdit{start: start, end: end, text: text})
+}
+
+// remove deletes src[start:end], keeping the line breaks.
+func (tr *esmTransformer) remove(start, end int) {
+	tr.edit(start, end, strings.Repeat("\n", bytes.Count(tr.src[start:end], []byte("\n"))))
+}
+
+func (tr *esmTransformer) errorAt(t jsToken, msg string) error {
+	line := bytes.Count(tr.src[:t.start], []byte("\n")) + 1
+	return fmt.Errorf("line %d: %s: %q", line, msg, t.text)
+}
+
+func (tr *esmTransformer) output() []byte {
+	var prologue []string
+	prologue = append(prologue, `"use strict";`)
+	prologue = append(prologue, `const __jsh_exports = typeof exports === "object" && exports !== null ? exports : {};`)
+	prologue = append(prologue, `Object.defineProperty(__jsh_exports, "__esModule", { value: true });`)
+	prologue = append(prologue, `const __jsh_interop = (m) => m && m.__esModule ? m : Object.assign(m !== null && (typeof m === "object" || typeof m === "function") ? Object.create(m) : {}, { default: m });`)
+	if tr.useDyn {
+		prologue = append(prologue, `const __jsh_import = (p) => Promise.resolve().then(() => __jsh_interop(require(p)));`)
+	}
+	if tr.useMeta {
+		prologue = append(prologue, fmt.Sprintf(`const __jsh_import_meta = { url: %s, filename: %s, dirname: %s };`,
+			strconv.Quote("file://"+tr.filename), strconv.Quote(tr.filename), strconv.Quote(path.Dir(tr.filename))))
+	}
+	if tr.useStars {
+		prologue = append(prologue, `const __jsh_export_star = (m) => { for (const k in m) { if (k !== "default" && k !== "__esModule" && !Object.prototype.hasOwnProperty.call(__jsh_exports, k)) { Object.defineProperty(__jsh_exports, k, { enumerable: true, get: () => m[k] }); } } };`)
+	}
+	// exports first, so that cyclic imports see the bindings
+	prologue = append(prologue, tr.exports...)
+	prologue = append(prologue, tr.imports...)
+
+	var out bytes.Buffer
+	out.WriteString(strings.Join(prologue, " "))
+	pos := 0
+	for _, e := range tr.edits {
+		out.Write(tr.src[pos:e.start])
+		out.WriteString(e.text)
+		pos = e.end
+	}
+	out.Write(tr.src[pos:])
+	return out.Bytes()
+}
+
+// isImportCall reports whether toks[i] is the "import" of a dynamic import() call,
+// rather than a method named import.
+func isImportCall(toks []jsToken, i int) bool {
+	if toks[i].text != "import" || i+1 >= len(toks) || !toks[i+1].isPunct("(") {
+		return false
+	}
+	depth := 0
+	for j := i + 1; j < len(toks); j++ {
+		switch {
+		case toks[j].isPunct("(", "[", "{"):
+			depth++
+		case toks[j].isPunct(")", "]", "}"):
+			depth--
+			if depth == 0 {
+				return j+1 >= len(toks) || !toks[j+1].isPunct("{")
+			}
+		}
+	}
+	return true
+}
+
+// jsPropKey returns name as a property key usable in an object pattern.
+func jsPropKey(name string) string {
+	if isJSIdent(name) {
+		return name
+	}
+	return strconv.Quote(name)
+}
+
+func isJSIdent(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		if !isIdentPart(r) || (i == 0 && unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// A minimal JavaScript tokenizer, it is enough to find the module declarations.
+
+type jsTokenKind int
+
+const (
+	tokIdent jsTokenKind = iota
+	tokNumber
+	tokString
+	tokTemplate
+	tokRegExp
+	tokPunct
+)
+
+type jsToken struct {
+	kind       jsTokenKind
+	text       string
+	start, end int
+	nl         bool // preceded by a line break
+}
+
+func (t jsToken) isPunct(texts ...string) bool {
+	if t.kind != tokPunct {
+		return false
+	}
+	for _, s := range texts {
+		if t.text == s {
+			return true
+		}
+	}
+	return false
+}
+
+// endsStatement reports whether a statement may end after the token.
+func (t jsToken) endsStatement() bool {
+	switch t.kind {
+	case tokIdent, tokNumber, tokString, tokTemplate, tokRegExp:
+		return true
+	}
+	return t.isPunct(")", "]", "}")
+}
+
+// continuesExpression reports whether the token on a new line continues the previous expression.
+func (t jsToken) continuesExpression() bool {
+	return t.isPunct(".", "?", ":", "+", "-", "*", "/", "%", "&", "|", "^", "=", "<", ">", ",", "(", "[")
+}
+
+var regexpPrecedingKeywords = map[string]bool{
+	"return": true, "typeof": true, "instanceof": true, "in": true, "of": true, "new": true,
+	"delete": true, "void": true, "throw": true, "case": true, "do": true, "else": true,
+	"yield": true, "await": true,
+}
+
+func tokenizeJS(src []byte) []jsToken {
+	lx := &jsLexer{src: src}
+	lx.scan(false)
+	return lx.toks
+}
+
+// tokenizeWithSubst is like tokenizeJS, but keeps the tokens of the template substitutions.
+// They follow the template token they are part of.
+func tokenizeWithSubst(src []byte) []jsToken {
+	lx := &jsLexer{src: src, keepSubst: true}
+	lx.scan(false)
+	return lx.toks
+}
+
+type jsLexer struct {
+	src  []byte
+	pos  int
+	toks []jsToken
+	nl   bool
+
+	keepSubst bool
+	subst     []jsToken // substitution tokens of the template being scanned
+}
+
+func (lx *jsLexer) regexpAllowed() bool {
+	if len(lx.toks) == 0 {
+		return true
+	}
+	prev := lx.toks[len(lx.toks)-1]
+	switch prev.kind {
+	case tokIdent:
+		return regexpPrecedingKeywords[prev.text]
+	case tokPunct:
+		return !prev.isPunct(")", "]")
+	}
+	return false
+}
+
+// scan tokenizes until the end of the source, or until the unbalanced
+// closing brace of a template substitution if inTemplate.
+func (lx *jsLexer) scan(inTemplate bool) {
+	depth := 0
+	for lx.pos < len(lx.src) {
+		c := lx.src[lx.pos]
+		start := lx.pos
+		switch {
+		case c == '\n':
+			lx.nl = true
+			lx.pos++
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v':
+			lx.pos++
+		case c == '/' && lx.peek(1) == '/':
+			for lx.pos < len(lx.src) && lx.src[lx.pos] != '\n' {
+				lx.pos++
+			}
+		case c == '/' && lx.peek(1) == '*':
+			end := bytes.Index(lx.src[lx.pos+2:], []byte("*/"))
+			if end < 0 {
+				lx.pos = len(lx.src)
+			} else {
+				lx.pos += end + 4
+			}
+			if bytes.IndexByte(lx.src[start:lx.pos], '\n') >= 0 {
+				lx.nl = true
+			}
+		case c == '\'' || c == '"':
+			lx.scanString(c)
+			lx.add(tokString, start)
+		case c == '`':
+			lx.scanTemplate()
+			lx.add(tokTemplate, start)
+		case c == '/' && lx.regexpAllowed():
+			lx.scanRegExp()
+			lx.add(tokRegExp, start)
+		case c >= '0' && c <= '9' || c == '.' && lx.peek(1) >= '0' && lx.peek(1) <= '9':
+			for lx.pos < len(lx.src) && (isIdentPart(rune(lx.src[lx.pos])) || lx.src[lx.pos] == '.') {
+				lx.pos++
+			}
+			lx.add(tokNumber, start)
+		case c == '#' || c == '$' || c == '_' || c == '\\' || c >= 0x80 || unicode.IsLetter(rune(c)):
+			lx.pos++
+			for lx.pos < len(lx.src) {
+				r, size := utf8.DecodeRune(lx.src[lx.pos:])
+				if !isIdentPart(r) && r != '\\' {
+					break
+				}
+				lx.pos += size
+			}
+			lx.add(tokIdent, start)
+		default:
+			if inTemplate {
+				if c == '{' {
+					depth++
+				} else if c == '}' {
+					if depth == 0 {
+						return
+					}
+					depth--
+				}
+			}
+			lx.pos++
+			lx.add(tokPunct, start)
+		}
+	}
+}
+
+func (lx *jsLexer) add(kind jsTokenKind, start int) {
+	lx.toks = append(lx.toks, jsToken{kind: kind, text: string(lx.src[start:lx.pos]), start: start, end: lx.pos, nl: lx.nl})
+	lx.nl = false
+	if kind == tokTemplate && len(lx.subst) > 0 {
+		lx.toks = append(lx.toks, lx.subst...)
+		lx.subst = nil
+	}
+}
+
+func (lx *jsLexer) peek(n int) byte {
+	if lx.pos+n < len(lx.src) {
+		return lx.src[lx.pos+n]
+	}
+	return 0
+}
+
+func (lx *jsLexer) scanString(quote byte) {
+	for lx.pos++; lx.pos < len(lx.src); lx.pos++ {
+		switch lx.src[lx.pos] {
+		case '\\':
+			lx.pos++
+		case quote, '\n':
+			lx.pos++
+			return
+		}
+	}
+}
+
+func (lx *jsLexer) scanTemplate() {
+	for lx.pos++; lx.pos < len(lx.src); lx.pos++ {
+		switch lx.src[lx.pos] {
+		case '\\':
+			lx.pos++
+		case '`':
+			lx.pos++
+			return
+		case '$':
+			if lx.peek(1) == '{' {
+				// substitutions are tokenized apart and dropped, unless keepSubst
+				sub := &jsLexer{src: lx.src, pos: lx.pos + 2, keepSubst: lx.keepSubst}
+				sub.scan(true)
+				lx.pos = sub.pos
+				if lx.keepSubst {
+					lx.subst = append(lx.subst, sub.toks...)
+				}
+			}
+		}
+	}
+}
+
+func (lx *jsLexer) scanRegExp() {
+	inClass := false
+	for lx.pos++; lx.pos < len(lx.src); lx.pos++ {
+		switch lx.src[lx.pos] {
+		case '\\':
+			lx.pos++
+		case '[':
+			inClass = true
+		case ']':
+			inClass = false
+		case '\n':
+			return
+		case '/':
+			if !inClass {
+				lx.pos++
+				for lx.pos < len(lx.src) && isIdentPart(rune(lx.src[lx.pos])) {
+					lx.pos++
+				}
+				return
+			}
+		}
+	}
+}
+
+func isIdentPart(r rune) bool {
+	return r == '$' || r == '_' || r == '#' || unicode.IsLetter(r) || unicode.IsDigit(r) || r == '\u200c' || r == '\u200d'
+}
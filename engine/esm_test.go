@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestESM(t *testing.T) {
+	tests := []TestCase{
+		{
+			name: "esm_import",
+			script: `
+				import { greet, area } from "/work/esm/greet.js";
+				import { argv } from "/lib/process";
+				console.println(greet("ESM"));
+				console.println("area:", area(1), Array.isArray(argv));
+			`,
+			output: []string{
+				"Hello ESM from legacy.cjs!",
+				"area: 3.14 true",
+			},
+		},
+		{
+			name: "esm_namespace",
+			script: `
+				import * as greet from "/work/esm/greet.js";
+				import legacy from "/work/esm/greet.js";
+				console.println(Object.keys(greet).sort().join(","));
+				console.println(greet.count(), greet.count());
+				console.println(legacy.name, greet.default === legacy);
+			`,
+			output: []string{
+				"area,count,default,greet",
+				"1 2",
+				"legacy true",
+			},
+		},
+		{
+			name: "esm_require",
+			script: `
+				const math = require("/work/esm/math.mjs");
+				console.println(math.__esModule, math.default(6, 7), math.PI);
+				math.increment();
+				console.println("counter:", math.counter);
+			`,
+			output: []string{
+				"true 42 3.14",
+				"counter: 1",
+			},
+		},
+		{
+			name: "esm_dynamic_import",
+			script: `
+				import("/work/esm/math.mjs").then((m) => {
+					console.println("multiply:", m.default(2, 3));
+				});
+			`,
+			output: []string{
+				"multiply: 6",
+			},
+		},
+	}
+	for _, tc := range tests {
+		RunTest(t, tc)
+	}
+}
+
+func TestTransformESM(t *testing.T) {
+	src := strings.Join([]string{
+		`#!/usr/bin/env jsh`,
+		`import a, { b as c } from "./a.js";`,
+		`export const x = 1, y = c;`,
+		`export default function main() { return a; }`,
+	}, "\n")
+	out, err := TransformESM("/work/t.js", []byte(src))
+	if err != nil {
+		t.Fatalf("TransformESM: %v", err)
+	}
+	if got, want := strings.Count(string(out), "\n"), strings.Count(src, "\n"); got != want {
+		t.Errorf("line count changed: got %d, want %d\n%s", got, want, out)
+	}
+	for _, s := range []string{`require("./a.js")`, `const x = 1, y = c;`, `function main() { return a; }`} {
+		if !strings.Contains(string(out), s) {
+			t.Errorf("expected %q in\n%s", s, out)
+		}
+	}
+	if strings.Contains(string(out), "import ") || strings.Contains(string(out), "export ") {
+		t.Errorf("import/export left in\n%s", out)
+	}
+}
+
+func TestHasESMSyntax(t *testing.T) {
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{`import fs from "fs";`, true},
+		{`export const a = 1;`, true},
+		{`const m = require("./m");`, false},
+		{`// import x from "y"`, false},
+		{`const s = "export default 1";`, false},
+		{`obj.import("x");`, false},
+	}
+	for _, tt := range tests {
+		if got := hasESMSyntax([]byte(tt.src)); got != tt.want {
+			t.Errorf("hasESMSyntax(%q) = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
@@ -13,18 +13,19 @@ func NewEventLoop(opts ...eventloop.Option) *eventloop.EventLoop {
 // returns false if the event loop is already terminated.
 type EventDispatchFunc func(obj *goja.Object, event string, args ...any) bool
 
-func dispatchEvent(loop *eventloop.EventLoop) EventDispatchFunc {
+// dispatchEvent returns the EventDispatchFunc of the event loop runOnLoop queues the events on.
+// The exceptions thrown by the listeners are passed to uncaught.
+func dispatchEvent(runOnLoop func(func(*goja.Runtime)) bool, uncaught func(*goja.Runtime, error)) EventDispatchFunc {
 	return func(obj *goja.Object, event string, args ...any) bool {
-		return loop.RunOnLoop(func(vm *goja.Runtime) {
+		return runOnLoop(func(vm *goja.Runtime) {
 			values := make([]goja.Value, len(args))
 			for i, a := range args {
 				values[i] = vm.ToValue(a)
 			}
-			if emit, ok := obj.Get("emit").Export().(func(goja.FunctionCall) goja.Value); ok {
-				emit(goja.FunctionCall{
-					This:      obj,
-					Arguments: append([]goja.Value{vm.ToValue(event)}, values...),
-				})
+			if emit, ok := goja.AssertFunction(obj.Get("emit")); ok {
+				if _, err := emit(obj, append([]goja.Value{vm.ToValue(event)}, values...)...); err != nil {
+					uncaught(vm, err)
+				}
 			}
 		})
 	}
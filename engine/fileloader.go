@@ -0,0 +1,64 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/dop251/goja_nodejs/require"
+)
+
+// FileLoader converts the content of a file, required with an extension registered by
+// RegisterFileLoader, into the value that is the module.exports of the file.
+// The value is passed to the script as JSON, like the content of a .json file.
+type FileLoader func(data []byte) (any, error)
+
+// TextLoader is the FileLoader of the text files, like ".txt", that exports the text.
+func TextLoader(data []byte) (any, error) {
+	return string(data), nil
+}
+
+// RegisterFileLoader makes require() load the files with the extension ext, like ".yaml",
+// with loader, e.g. to parse them. The .json files are parsed without a loader.
+// The files are required with their extensions, require("./config.yaml").
+func (jr *JSRuntime) RegisterFileLoader(ext string, loader FileLoader) {
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	if jr.fileLoaders == nil {
+		jr.fileLoaders = make(map[string]FileLoader)
+	}
+	jr.fileLoaders[ext] = loader
+}
+
+// loadDataFile loads the file p with loader, into the source of a module that exports its value.
+func loadDataFile(env Env, p string, loader FileLoader) ([]byte, string, error) {
+	fileSystem := env.Filesystem()
+	if fileSystem == nil {
+		return nil, "", fmt.Errorf("no filesystem available to load module: %s", p)
+	}
+	p = CleanPath(filepath.ToSlash(p))
+	if fi, err := fs.Stat(fileSystem, p); err != nil || fi.IsDir() {
+		return nil, "", require.ModuleFileDoesNotExistError
+	}
+	b, err := fs.ReadFile(fileSystem, p)
+	if err != nil {
+		return nil, "", err
+	}
+	v, err := loader(b)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", p, err)
+	}
+	b, err = json.Marshal(v)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", p, err)
+	}
+	if path.Ext(p) == ".json" {
+		// require() parses the .json files itself
+		return b, p, nil
+	}
+	return append(append([]byte("module.exports = "), b...), ';'), p, nil
+}
@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// kvLoader loads the key=value lines of the .kv files of the tests.
+func kvLoader(data []byte) (any, error) {
+	ret := map[string]string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid line %q", line)
+		}
+		ret[k] = v
+	}
+	return ret, nil
+}
+
+func TestFileLoader(t *testing.T) {
+	tests := []TestCase{
+		{
+			name: "require_json",
+			script: `
+				const settings = require("./loader/settings.json");
+				console.println(settings.name, settings.server.host, settings.server.ports.join(","), settings.debug);
+				// the same object for every require
+				console.println(settings === require("/work/loader/settings.json"));
+			`,
+			output: []string{
+				"loader localhost 8080,8443 false",
+				"true",
+			},
+		},
+		{
+			name: "require_registered",
+			script: `
+				const notes = require("./loader/notes.txt");
+				const broker = require("./loader/broker.kv");
+				console.println(JSON.stringify(notes));
+				console.println(broker.host, broker.port);
+				try {
+					require("./loader/broken.kv");
+				} catch (e) {
+					console.println(e.message);
+				}
+			`,
+			preTest: func(jr *JSRuntime) {
+				jr.RegisterFileLoader(".txt", TextLoader)
+				jr.RegisterFileLoader("kv", kvLoader)
+			},
+			output: []string{
+				`"hello\nworld\n"`,
+				"localhost 1883",
+				`/work/loader/broken.kv: invalid line "no separator"`,
+			},
+		},
+		{
+			name: "require_json_loader",
+			script: `
+				const settings = require("./loader/settings.json");
+				console.println(settings.loaded, settings.name);
+			`,
+			preTest: func(jr *JSRuntime) {
+				jr.RegisterFileLoader(".json", func(data []byte) (any, error) {
+					return map[string]any{"loaded": true, "name": "custom"}, nil
+				})
+			},
+			output: []string{
+				"true custom",
+			},
+		},
+	}
+	for _, tc := range tests {
+		RunTest(t, tc)
+	}
+}
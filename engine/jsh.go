@@ -1,9 +1,11 @@
 package engine
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
@@ -11,6 +13,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/dop251/goja"
 	"github.com/dop251/goja_nodejs/eventloop"
@@ -45,19 +48,30 @@ func New(conf Config) (*JSRuntime, error) {
 	if conf.Writer != nil {
 		writer = conf.Writer
 	}
+	// the errors go to the Writer of the embedders that set only the Writer
+	var errorWriter io.Writer = os.Stderr
+	if conf.ErrorWriter != nil {
+		errorWriter = conf.ErrorWriter
+	} else if conf.Writer != nil {
+		errorWriter = conf.Writer
+	}
 	var execBuilderFunc ExecBuilderFunc
 	if conf.ExecBuilder != nil {
 		execBuilderFunc = conf.ExecBuilder
 	} else {
-		execBuilderFunc = execBuilder(conf.FSTabs)
+		execBuilderFunc = execBuilder(conf.FSTabs, conf.Limits)
 	}
 	opts := []EnvOption{
 		WithFilesystem(fileSystem),
 		WithReader(reader),
 		WithWriter(writer),
+		WithErrorWriter(errorWriter),
 		WithExecBuilder(execBuilderFunc),
 	}
 	env := NewEnv(opts...)
+	for k, v := range conf.HostEnv.Vars() {
+		env.Set(k, v)
+	}
 	for k, v := range conf.Env {
 		env.Set(k, v)
 	}
@@ -71,10 +85,15 @@ func New(conf Config) (*JSRuntime, error) {
 	if env.Get("PWD") == nil {
 		env.Set("PWD", "/")
 	}
+	return newJSRuntime(conf, env)
+}
 
+// newJSRuntime builds a JSRuntime that runs the script of conf in env.
+func newJSRuntime(conf Config, env Env) (*JSRuntime, error) {
 	script := ""
 	scriptName := ""
 	scriptArgs := []string{}
+	var scriptKey *programKey
 	if conf.Code == "" {
 		cmd := ""
 		if len(conf.Args) > 0 {
@@ -86,16 +105,21 @@ func New(conf Config) (*JSRuntime, error) {
 		if cmd == "" {
 			// No command or script file provided
 			// start default command
-			b, _ := LoadSource(env, conf.Default)
+			b, file, err := loadScript(env, conf.Default, 0)
 			scriptName = conf.Default
 			script = string(b)
+			if err == nil {
+				scriptKey = scriptFile(env.Filesystem(), file)
+			}
 		} else {
-			if !strings.HasSuffix(cmd, ".js") {
+			if !hasScriptExt(cmd) {
 				cmd = cmd + ".js"
 			}
-			b, err := LoadSource(env, cmd)
-			if err != nil {
+			b, file, err := loadScript(env, cmd, 0)
+			if errors.Is(err, ErrModuleNotFound) {
 				return nil, fmt.Errorf("command not found: %s", cmd)
+			} else if err != nil {
+				return nil, err
 			}
 			// replace shebang line as javascript comment
 			if b[0] == '#' && b[1] == '!' {
@@ -103,11 +127,27 @@ func New(conf Config) (*JSRuntime, error) {
 			}
 			scriptName = cmd
 			script = string(b)
+			scriptKey = scriptFile(env.Filesystem(), file)
 		}
 	} else {
 		scriptName = conf.Name
 		script = conf.Code
 		scriptArgs = conf.Args
+		if isTypeScript(scriptName) {
+			b, err := StripTypes(scriptName, []byte(script))
+			if err != nil {
+				return nil, err
+			}
+			script = string(b)
+		}
+		if hasESMSyntax([]byte(script)) {
+			b, err := TransformESM(scriptName, []byte(script))
+			if err != nil {
+				return nil, err
+			}
+			script = string(b)
+		}
+		script = string(inlineSourceMap(env.Filesystem(), scriptName, []byte(conf.Code), []byte(script), 0))
 	}
 	if scriptName == "" {
 		scriptName = "ad-hoc"
@@ -118,12 +158,33 @@ func New(conf Config) (*JSRuntime, error) {
 		Source: script,
 		Args:   scriptArgs,
 		Env:    env,
+
+		file:          scriptKey,
+		timeout:       conf.Timeout,
+		execInProcess: conf.ExecInProcess,
+		limits:        conf.Limits,
+		cpuProfile:    conf.CPUProfile,
+		memProfile:    conf.MemProfile,
+		conf:          conf,
+	}
+	if conf.Clock != nil {
+		jr.clock = conf.Clock
+		jr.nowFunc = conf.Clock.Now
+	}
+	if conf.Watch {
+		jr.watched = newWatchSet()
+		if scriptKey != nil {
+			jr.watched.add(env.Filesystem(), scriptKey.file)
+		}
 	}
 
+	jr.jobs = newPendingJobs()
 	jr.registry = require.NewRegistry(
 		require.WithLoader(jr.loadSource),
 		require.WithPathResolver(jr.pathResolver),
 	)
+	jr.registry.RegisterNativeModule(compiledModuleName, jr.loadCompiledModule)
+	registerNodeCoreModules(jr.registry)
 	jr.eventLoop = NewEventLoop(
 		eventloop.EnableConsole(false),
 		eventloop.WithRegistry(jr.registry),
@@ -132,24 +193,56 @@ func New(conf Config) (*JSRuntime, error) {
 }
 
 func (jr *JSRuntime) Main() int {
-	if err := jr.Run(); err != nil {
+	if jr.conf.Watch {
+		return jr.Watch(context.Background())
+	}
+	return jr.exitStatus(jr.Run())
+}
+
+// exitStatus reports err returned by Run, if any, and returns the exit code of the script.
+func (jr *JSRuntime) exitStatus(err error) int {
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			// the deadline may be the one of the context, not Config.Timeout
+			if jr.timeout > 0 {
+				fmt.Fprintf(jr.Env.ErrorWriter(), "timeout after %v\n", jr.timeout)
+			} else {
+				fmt.Fprintln(jr.Env.ErrorWriter(), "timeout")
+			}
+			return jr.ExitCode()
+		}
+		if errors.Is(err, context.Canceled) {
+			fmt.Fprintln(jr.Env.ErrorWriter(), "canceled")
+			return jr.ExitCode()
+		}
+		var limitErr *LimitError
+		if errors.As(err, &limitErr) {
+			fmt.Fprintln(jr.Env.ErrorWriter(), limitErr.Error())
+			return jr.ExitCode()
+		}
 		if ie, ok := err.(*goja.InterruptedError); ok {
 			frame := ie.Stack()[0]
 			if exit, ok := ie.Value().(Exit); ok {
 				if exit.Code < 0 {
-					fmt.Printf("exit code %d at %v\n", exit.Code, frame.Position())
+					fmt.Fprintf(jr.Env.ErrorWriter(), "exit code %d at %v\n", exit.Code, frame.Position())
 				}
 				return exit.Code
 			}
 		}
-		fmt.Println("runtime error:", err)
+		if ex, ok := err.(*goja.Exception); ok {
+			// the stack trace of the exception
+			fmt.Fprintln(jr.Env.ErrorWriter(), "runtime error:", strings.TrimSpace(ex.String()))
+			return 1
+		}
+		fmt.Fprintln(jr.Env.ErrorWriter(), "runtime error:", err)
 		return 1
 	}
 	return jr.ExitCode()
 }
 
 // execBuilder builds an exec.Cmd to run jsh with the given code and args.
-func execBuilder(fstabs []FSTab) ExecBuilderFunc {
+// The child runs with the same mounts and limits.
+func execBuilder(fstabs []FSTab, limits Limits) ExecBuilderFunc {
 	useSecretBox := os.Getenv("JSH_NO_SECRET_BOX") != "1"
 	return func(code string, args []string, env map[string]any) (*exec.Cmd, error) {
 		self, err := os.Executable()
@@ -164,6 +257,7 @@ func execBuilder(fstabs []FSTab) ExecBuilderFunc {
 				Args:   args,
 				FSTabs: fstabs,
 				Env:    env,
+				Limits: limits,
 			}
 			secretBox, err := NewSecretBox(conf)
 			if err != nil {
@@ -176,6 +270,7 @@ func execBuilder(fstabs []FSTab) ExecBuilderFunc {
 			for _, tab := range fstabs {
 				opts = append(opts, "-v", fmt.Sprintf("%s=%s", tab.MountPoint, tab.Source))
 			}
+			opts = append(opts, limits.Flags()...)
 			if code != "" {
 				opts = append(opts, "-c", code)
 				if len(args) > 0 {
@@ -222,8 +317,29 @@ type Config struct {
 	Env    map[string]any `json:"env"`
 	FSTabs FSTabs         `json:"fstabs,omitempty"`
 
+	// HostEnv imports the environment variables of the host OS, overridden by Env.
+	HostEnv HostEnv `json:"hostEnv,omitempty"`
+
+	// Timeout limits the run time of the script, zero means no limit.
+	Timeout time.Duration `json:"timeout,omitempty"`
+	// ExecInProcess runs the commands of process.exec in a child JSRuntime
+	// on its own goroutine instead of re-launching the jsh binary.
+	ExecInProcess bool `json:"execInProcess,omitempty"`
+	// Limits bounds the resources the script may use.
+	Limits Limits `json:"limits,omitempty"`
+	// CPUProfile is the file to write the CPU profile of the JavaScript functions to.
+	CPUProfile string `json:"cpuProfile,omitempty"`
+	// MemProfile is the file to write the heap profile to when the script ends.
+	MemProfile string `json:"memProfile,omitempty"`
+	// Watch runs the script again whenever a file it has loaded changes, see JSRuntime.Watch.
+	Watch bool `json:"watch,omitempty"`
+
+	// Clock is the time of the script, e.g. a ManualClock in tests. The time of the system if nil.
+	Clock Clock `json:"-"`
+
 	Default     string                `json:"default,omitempty"`
 	Writer      io.Writer             `json:"-"`
+	ErrorWriter io.Writer             `json:"-"` // stderr, defaults to Writer if set, otherwise os.Stderr
 	Reader      io.Reader             `json:"-"`
 	ExecBuilder ExecBuilderFunc       `json:"-"`
 	fstabHooks  []func(FSTabs) FSTabs `json:"-"`
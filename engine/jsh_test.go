@@ -52,6 +52,45 @@ func TestJshMain(t *testing.T) {
 				"Options: {help:true, version:true}",
 			},
 		},
+		{
+			name:       "esm",
+			args:       []string{"esm/main.mjs", "world"},
+			stdinInput: "",
+			expectedOutput: []string{
+				"Hello world from legacy.cjs!",
+				"area: 12.56",
+			},
+		},
+		{
+			name:       "typescript",
+			args:       []string{"ts/main.ts", "world"},
+			stdinInput: "",
+			expectedOutput: []string{
+				"Hello world from lib.ts!",
+				"level: 3 Mid",
+				"sum: 6",
+			},
+		},
+		{
+			name:       "test_command",
+			args:       []string{"test", "/work/testing/pass"},
+			stdinInput: "",
+			expectedOutput: []string{
+				"TAP version 13",
+				"# /work/testing/pass/async.test.js",
+				"ok 1 - async > awaits a promise",
+				"ok 2 - async > calls done",
+				"# /work/testing/pass/math.test.js",
+				"ok 3 - math > adds",
+				"ok 4 - math > copies",
+				"ok 5 - math > divides by zero # SKIP",
+				"1..5",
+				"# tests 5",
+				"# pass 4",
+				"# fail 0",
+				"# skip 1",
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,186 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"runtime/metrics"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// Limits bounds the resources a script may use, the zero values mean no limit.
+// A script exceeding one of them is interrupted with a *LimitError
+// and exits with ExitCodeLimit.
+type Limits struct {
+	// WallTime is the maximum run time of the script.
+	WallTime time.Duration `json:"wallTime,omitempty"`
+	// StackDepth is the maximum depth of the call stack.
+	StackDepth int `json:"stackDepth,omitempty"`
+	// HeapGrowth is the maximum growth of the heap in bytes since the script started.
+	// It is approximate, the heap is shared with the rest of the process.
+	HeapGrowth uint64 `json:"heapGrowth,omitempty"`
+	// PendingJobs is the maximum number of timers, intervals, immediates and jobs queued
+	// on the event loop, like process.nextTick() and the worker messages, pending at once.
+	PendingJobs int `json:"pendingJobs,omitempty"`
+}
+
+// Flags returns the command line options of jsh that set the limits.
+func (l Limits) Flags() []string {
+	var ret []string
+	if l.WallTime > 0 {
+		ret = append(ret, "-max-time", l.WallTime.String())
+	}
+	if l.StackDepth > 0 {
+		ret = append(ret, "-max-stack", strconv.Itoa(l.StackDepth))
+	}
+	if l.HeapGrowth > 0 {
+		ret = append(ret, "-max-heap", strconv.FormatUint(l.HeapGrowth, 10))
+	}
+	if l.PendingJobs > 0 {
+		ret = append(ret, "-max-jobs", strconv.Itoa(l.PendingJobs))
+	}
+	return ret
+}
+
+// The names of the limits reported by LimitError.
+const (
+	LimitWallTime    = "wall time"
+	LimitStackDepth  = "stack depth"
+	LimitHeapGrowth  = "heap growth"
+	LimitPendingJobs = "pending jobs"
+)
+
+// ExitCodeLimit is the exit code of a script stopped by its Limits,
+// same as killed by SIGKILL (128+9), like the OOM killer does.
+const ExitCodeLimit = 137
+
+// LimitError is the error a script is stopped with when it exceeds one of its Limits.
+type LimitError struct {
+	Limit string // one of LimitWallTime, LimitStackDepth, LimitHeapGrowth and LimitPendingJobs
+	Max   any    // the value of the limit
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s limit exceeded: %v", e.Limit, e.Max)
+}
+
+// limitContext returns ctx done with a *LimitError when the wall time limit is exceeded,
+// and the function to stop it with the *LimitError of the other limits.
+func (jr *JSRuntime) limitContext(ctx context.Context) (context.Context, context.CancelCauseFunc, context.CancelFunc) {
+	ctx, fail := context.WithCancelCause(ctx)
+	if jr.limits.WallTime <= 0 {
+		return ctx, fail, func() { fail(nil) }
+	}
+	ctx, cancel := context.WithTimeoutCause(ctx, jr.limits.WallTime, &LimitError{Limit: LimitWallTime, Max: jr.limits.WallTime})
+	return ctx, fail, func() { cancel(); fail(nil) }
+}
+
+// enforceLimits applies the limits of the runtime to vm, until stop is closed.
+// fail is called with the *LimitError of the limit exceeded.
+// The pending jobs are counted by wrapTimers and runOnLoop.
+func (jr *JSRuntime) enforceLimits(vm *goja.Runtime, fail func(error), stop <-chan struct{}) {
+	jr.jobs.start(jr.limits.PendingJobs, fail)
+	if jr.limits.StackDepth > 0 {
+		vm.SetMaxCallStackSize(jr.limits.StackDepth)
+	}
+	if jr.limits.HeapGrowth > 0 {
+		watchHeap(jr.limits.HeapGrowth, fail, stop)
+	}
+}
+
+// pendingJobs counts the timers and the jobs queued on the event loop that have not run yet,
+// for Limits.PendingJobs. The jobs are queued from any goroutine, like the messages of the workers.
+type pendingJobs struct {
+	mu     sync.Mutex
+	max    int
+	fail   func(error)
+	timers map[any]struct{}
+	queued int
+}
+
+func newPendingJobs() *pendingJobs {
+	return &pendingJobs{timers: map[any]struct{}{}}
+}
+
+// start sets the limit of the jobs, and fail to call with the *LimitError when it is exceeded.
+func (p *pendingJobs) start(max int, fail func(error)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.max, p.fail = max, fail
+}
+
+// full calls fail and returns true if one more job would exceed the limit.
+func (p *pendingJobs) full() bool {
+	p.mu.Lock()
+	max, fail := p.max, p.fail
+	full := max > 0 && len(p.timers)+p.queued >= max
+	p.mu.Unlock()
+	if full {
+		fail(&LimitError{Limit: LimitPendingJobs, Max: max})
+	}
+	return full
+}
+
+func (p *pendingJobs) addTimer(handle any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.timers[handle] = struct{}{}
+}
+
+func (p *pendingJobs) removeTimer(handle any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.timers, handle)
+}
+
+func (p *pendingJobs) add(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.queued += n
+}
+
+// runOnLoop queues fn on the event loop like RunOnLoop, counting it as a pending job until it runs.
+// It returns false if the loop is terminated, or if the job would exceed Limits.PendingJobs.
+func (jr *JSRuntime) runOnLoop(fn func(*goja.Runtime)) bool {
+	if jr.jobs.full() {
+		return false
+	}
+	jr.jobs.add(1)
+	ok := jr.eventLoop.RunOnLoop(func(vm *goja.Runtime) {
+		jr.jobs.add(-1)
+		fn(vm)
+	})
+	if !ok {
+		jr.jobs.add(-1)
+	}
+	return ok
+}
+
+// heapCheckInterval is how often the heap growth limit is checked.
+const heapCheckInterval = 10 * time.Millisecond
+
+// watchHeap calls fail when the heap grows by more than max bytes, until stop is closed.
+func watchHeap(max uint64, fail func(error), stop <-chan struct{}) {
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	metrics.Read(sample)
+	base := sample[0].Value.Uint64()
+	go func() {
+		ticker := time.NewTicker(heapCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				metrics.Read(sample)
+				if heap := sample[0].Value.Uint64(); heap > base && heap-base > max {
+					fail(&LimitError{Limit: LimitHeapGrowth, Max: max})
+					return
+				}
+			}
+		}
+	}()
+}
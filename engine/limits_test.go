@@ -0,0 +1,147 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		limits Limits
+		want   string
+	}{
+		{
+			name:   "wall_time",
+			script: `setInterval(() => {}, 10);`,
+			limits: Limits{WallTime: 100 * time.Millisecond},
+			want:   LimitWallTime,
+		},
+		{
+			name:   "wall_time_busy",
+			script: `while (true) {}`,
+			limits: Limits{WallTime: 100 * time.Millisecond},
+			want:   LimitWallTime,
+		},
+		{
+			name:   "stack_depth",
+			script: `function f(n) { return f(n + 1); } f(0);`,
+			limits: Limits{StackDepth: 100},
+			want:   LimitStackDepth,
+		},
+		{
+			name:   "stack_depth_timer",
+			script: `function f(n) { return f(n + 1); } setTimeout(() => f(0), 0);`,
+			limits: Limits{StackDepth: 100},
+			want:   LimitStackDepth,
+		},
+		{
+			name:   "heap_growth",
+			script: `const a = []; while (true) { a.push(new Array(1000).fill("x")); }`,
+			limits: Limits{HeapGrowth: 16 << 20},
+			want:   LimitHeapGrowth,
+		},
+		{
+			name:   "pending_jobs",
+			script: `for (let i = 0; i < 100; i++) { setTimeout(() => {}, 1000); }`,
+			limits: Limits{PendingJobs: 10},
+			want:   LimitPendingJobs,
+		},
+		{
+			name: "pending_jobs_next_tick",
+			script: `
+				const process = require("/lib/process");
+				for (let i = 0; i < 5; i++) { setTimeout(() => {}, 1000); }
+				for (let i = 0; i < 100; i++) { process.nextTick(() => {}); }
+			`,
+			limits: Limits{PendingJobs: 10},
+			want:   LimitPendingJobs,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			hooked := false
+			conf := Config{
+				Name:   tc.name,
+				Code:   tc.script,
+				Limits: tc.limits,
+				FSTabs: []FSTab{{MountPoint: "/", Source: "../native/root/"}},
+				Reader: &bytes.Buffer{},
+				Writer: &bytes.Buffer{},
+			}
+			jr, err := New(conf)
+			if err != nil {
+				t.Fatalf("Failed to create JSRuntime: %v", err)
+			}
+			jr.RegisterNativeModule("@jsh/process", jr.Process)
+			jr.AddShutdownHook(func() { hooked = true })
+			err = jr.Run()
+			var limitErr *LimitError
+			if !errors.As(err, &limitErr) {
+				t.Fatalf("Expected LimitError, got %v", err)
+			}
+			if limitErr.Limit != tc.want {
+				t.Errorf("Expected %q limit, got %q", tc.want, limitErr.Limit)
+			}
+			if jr.ExitCode() != ExitCodeLimit {
+				t.Errorf("Expected exit code %d, got %d", ExitCodeLimit, jr.ExitCode())
+			}
+			if !hooked {
+				t.Error("Expected the shutdown hook to run")
+			}
+		})
+	}
+}
+
+func TestLimitsWithinBounds(t *testing.T) {
+	conf := Config{
+		Code: `
+			let n = 0;
+			const id = setInterval(() => { if (++n == 3) clearInterval(id); }, 1);
+			for (let i = 0; i < 5; i++) { setTimeout(() => {}, 1); }
+			function depth(n) { return n == 0 ? 0 : 1 + depth(n - 1); }
+			setTimeout(() => console.println(depth(50)), 5);
+		`,
+		Limits: Limits{WallTime: 5 * time.Second, StackDepth: 100, PendingJobs: 10},
+		Reader: &bytes.Buffer{},
+		Writer: &bytes.Buffer{},
+	}
+	jr, err := New(conf)
+	if err != nil {
+		t.Fatalf("Failed to create JSRuntime: %v", err)
+	}
+	if err := jr.Run(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := conf.Writer.(*bytes.Buffer).String(); got != "50\n" {
+		t.Errorf("Expected output %q, got %q", "50\n", got)
+	}
+}
+
+func TestLimitsExecChild(t *testing.T) {
+	conf := Config{
+		Code: `
+			const process = require("/lib/process");
+			console.println(process.execString("function f() { return f(); } f();"));
+		`,
+		Limits:        Limits{StackDepth: 100},
+		ExecInProcess: true,
+		FSTabs:        []FSTab{{MountPoint: "/", Source: "../native/root/"}},
+		Reader:        &bytes.Buffer{},
+		Writer:        &bytes.Buffer{},
+	}
+	jr, err := New(conf)
+	if err != nil {
+		t.Fatalf("Failed to create JSRuntime: %v", err)
+	}
+	jr.RegisterNativeModule("@jsh/process", jr.Process)
+	if err := jr.Run(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := conf.Writer.(*bytes.Buffer).String(); got != "stack depth limit exceeded: 100\n137\n" {
+		t.Errorf("Unexpected output %q", got)
+	}
+}
@@ -0,0 +1,164 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// ErrModuleClosed is returned by Module.Call after the runtime of the module has stopped.
+var ErrModuleClosed = errors.New("module closed")
+
+// Module is a script loaded by JSRuntime.Load, whose exported functions are called from Go.
+// Its runtime keeps running, with its event loop, until Close.
+type Module struct {
+	jr      *JSRuntime
+	exports *goja.Object // module.exports of the script, used on the event loop only
+	cancel  context.CancelFunc
+	done    chan struct{} // closed when the runtime has stopped
+	err     error         // the error the runtime has stopped with
+}
+
+// CallError is the exception thrown by a function called by Module.Call,
+// or the reason of the rejected promise it returned.
+type CallError struct {
+	Value   any    // the value thrown, exported like the results of Call
+	Message string // the string of the value, like "TypeError: invalid id"
+	Stack   string // the stack trace, if the value is an Error
+}
+
+func (e *CallError) Error() string {
+	return e.Message
+}
+
+func newCallError(v goja.Value) *CallError {
+	ret := &CallError{Value: v.Export(), Message: v.String()}
+	if obj, ok := v.(*goja.Object); ok {
+		if stack := obj.Get("stack"); stack != nil && !goja.IsUndefined(stack) {
+			ret.Stack = stack.String()
+		}
+	}
+	return ret
+}
+
+// Load runs the script of the runtime as a CommonJS module, the properties of
+// module.exports or the exports of an ES module are the functions that Call calls.
+// The runtime keeps running after the script until Close, or until ctx is done.
+// The error thrown by the script is returned, after the runtime has stopped.
+func (jr *JSRuntime) Load(ctx context.Context) (*Module, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	m := &Module{jr: jr, cancel: cancel, done: make(chan struct{})}
+	ready := make(chan error, 1)
+	go func() {
+		defer close(m.done)
+		defer cancel()
+		m.err = jr.runContext(ctx, func(vm *goja.Runtime, module *goja.Object, err error) {
+			if err == nil {
+				m.exports = module.Get("exports").ToObject(vm)
+				// keeps the event loop alive for the calls
+				jr.eventLoop.SetTimeout(func(*goja.Runtime) {}, time.Duration(math.MaxInt64))
+			}
+			ready <- err
+		})
+	}()
+	select {
+	case err := <-ready:
+		if err != nil {
+			cancel()
+			<-m.done
+			return nil, err
+		}
+		return m, nil
+	case <-m.done:
+		if m.err == nil {
+			m.err = fmt.Errorf("%s: the script has stopped before it was loaded", jr.Name)
+		}
+		return nil, m.err
+	}
+}
+
+// Call calls the exported function name with args, converted to JavaScript values,
+// on the event loop of the module, after the calls and the events before it.
+// It returns the exported result, or the one of the promise the function returns
+// when the promise is fulfilled. The exception thrown, or the reason of the rejected
+// promise, is returned as a *CallError.
+// If ctx is done first, Call returns ctx.Err() and the function is not waited for.
+func (m *Module) Call(ctx context.Context, name string, args ...any) (any, error) {
+	type result struct {
+		value any
+		err   error
+	}
+	ch := make(chan result, 1)
+	queued := m.jr.eventLoop.RunOnLoop(func(vm *goja.Runtime) {
+		fn, ok := goja.AssertFunction(m.exports.Get(name))
+		if !ok {
+			ch <- result{err: fmt.Errorf("%s is not an exported function of %s", name, m.jr.Name)}
+			return
+		}
+		values := make([]goja.Value, len(args))
+		for i, a := range args {
+			values[i] = vm.ToValue(a)
+		}
+		ret, err := fn(m.exports, values...)
+		if err != nil {
+			if ex, ok := err.(*goja.Exception); ok {
+				err = newCallError(ex.Value())
+			} else {
+				// process.exit() stops the runtime
+				m.jr.uncaught(vm, err)
+			}
+			ch <- result{err: err}
+			return
+		}
+		if _, ok := ret.Export().(*goja.Promise); !ok {
+			ch <- result{value: ret.Export()}
+			return
+		}
+		// handling the promise also keeps its rejection from being reported as unhandled
+		obj := ret.ToObject(vm)
+		then, _ := goja.AssertFunction(obj.Get("then"))
+		_, err = then(obj, vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			ch <- result{value: call.Argument(0).Export()}
+			return goja.Undefined()
+		}), vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			ch <- result{err: newCallError(call.Argument(0))}
+			return goja.Undefined()
+		}))
+		if err != nil {
+			ch <- result{err: err}
+		}
+	})
+	if !queued {
+		return nil, ErrModuleClosed
+	}
+	select {
+	case r := <-ch:
+		return r.value, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-m.done:
+		return nil, ErrModuleClosed
+	}
+}
+
+// Done returns a channel that is closed when the runtime of the module has stopped,
+// like when the script calls process.exit().
+func (m *Module) Done() <-chan struct{} {
+	return m.done
+}
+
+// Close stops the runtime of the module, like a canceled RunContext,
+// so its shutdown hooks run. It returns the error the runtime has stopped with,
+// if it has stopped by itself.
+func (m *Module) Close() error {
+	m.cancel()
+	<-m.done
+	if errors.Is(m.err, context.Canceled) {
+		return nil
+	}
+	return m.err
+}
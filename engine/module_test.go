@@ -0,0 +1,161 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func loadTestModule(t *testing.T, code string, out *bytes.Buffer) (*Module, error) {
+	t.Helper()
+	jr, err := New(Config{
+		Name:   "plugin",
+		Code:   code,
+		FSTabs: []FSTab{{MountPoint: "/", Source: "../native/root/"}, {MountPoint: "/work", Source: "../test/"}},
+		Env: map[string]any{
+			"PATH": "/lib:/work:/sbin",
+			"PWD":  "/work",
+		},
+		Reader: &bytes.Buffer{},
+		Writer: out,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jr.RegisterNativeModule("@jsh/process", jr.Process)
+	return jr.Load(context.Background())
+}
+
+func TestModuleCall(t *testing.T) {
+	out := &bytes.Buffer{}
+	m, err := loadTestModule(t, `
+		const process = require("/lib/process");
+		let count = 0;
+		process.addShutdownHook(() => console.println("closed after", count, "calls"));
+		module.exports = {
+			add: (a, b) => { count++; return a + b; },
+			greet(user) { count++; return { text: "hello " + user.name, tags: user.tags.length }; },
+			later(ms, value) {
+				count++;
+				return new Promise((resolve) => setTimeout(() => resolve(value), ms));
+			},
+			fail() { count++; throw new TypeError("invalid id"); },
+			async reject() { count++; throw new RangeError("too far"); },
+			version: "1.0",
+		};
+	`, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if ret, err := m.Call(ctx, "add", 1, 2); err != nil || ret != int64(3) {
+		t.Errorf("add: expected 3, got %v %v", ret, err)
+	}
+	ret, err := m.Call(ctx, "greet", map[string]any{"name": "jsh", "tags": []string{"a", "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj, ok := ret.(map[string]any); !ok || obj["text"] != "hello jsh" || obj["tags"] != int64(2) {
+		t.Errorf("greet: unexpected result %#v", ret)
+	}
+	if ret, err := m.Call(ctx, "later", 10, "done"); err != nil || ret != "done" {
+		t.Errorf("later: expected done, got %v %v", ret, err)
+	}
+
+	var callErr *CallError
+	if _, err := m.Call(ctx, "fail"); !errors.As(err, &callErr) || callErr.Message != "TypeError: invalid id" || callErr.Stack == "" {
+		t.Errorf("fail: unexpected error %#v", err)
+	}
+	if _, err := m.Call(ctx, "reject"); !errors.As(err, &callErr) || callErr.Message != "RangeError: too far" {
+		t.Errorf("reject: unexpected error %#v", err)
+	}
+	if _, err := m.Call(ctx, "version"); err == nil || err.Error() != "version is not an exported function of plugin" {
+		t.Errorf("version: unexpected error %v", err)
+	}
+
+	// a call that takes longer than its context
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := m.Call(timeout, "later", 1000, "late"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("later: expected deadline exceeded, got %v", err)
+	}
+
+	// the calls from many goroutines run one by one on the event loop
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := m.Call(ctx, "add", i, i); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Call(ctx, "add", 1, 2); !errors.Is(err, ErrModuleClosed) {
+		t.Errorf("expected ErrModuleClosed, got %v", err)
+	}
+	if got := out.String(); got != "closed after 56 calls\n" {
+		t.Errorf("unexpected output %q", got)
+	}
+}
+
+func TestModuleESM(t *testing.T) {
+	out := &bytes.Buffer{}
+	m, err := loadTestModule(t, `
+		export function double(n) { return n * 2; }
+		export default function () { return "default"; }
+	`, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if ret, err := m.Call(context.Background(), "double", 21); err != nil || ret != int64(42) {
+		t.Errorf("double: expected 42, got %v %v", ret, err)
+	}
+	if ret, err := m.Call(context.Background(), "default"); err != nil || ret != "default" {
+		t.Errorf("default: expected default, got %v %v", ret, err)
+	}
+}
+
+func TestModuleLoadError(t *testing.T) {
+	out := &bytes.Buffer{}
+	_, err := loadTestModule(t, `throw new Error("bad config");`, out)
+	if err == nil || !strings.Contains(err.Error(), "bad config") {
+		t.Errorf("expected the error of the script, got %v", err)
+	}
+	_, err = loadTestModule(t, `require("/lib/process").exit(3);`, out)
+	if err == nil {
+		t.Error("expected an error for the script that exits")
+	}
+}
+
+func TestModuleDone(t *testing.T) {
+	out := &bytes.Buffer{}
+	m, err := loadTestModule(t, `
+		exports.quit = () => setTimeout(() => require("/lib/process").exit(2), 0);
+	`, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Call(context.Background(), "quit"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-m.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the module has not stopped")
+	}
+	if err := m.Close(); err == nil {
+		t.Error("expected the exit of the script")
+	}
+}
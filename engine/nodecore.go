@@ -0,0 +1,44 @@
+package engine
+
+import (
+	"github.com/dop251/goja"
+	"github.com/dop251/goja_nodejs/require"
+)
+
+// NodeCoreModules maps the names of the core modules of Node.js to the modules of jsh
+// that implement them, so require("fs") and require("node:fs") load /lib/fs,
+// like the packages written for Node.js do. The modules are required when the names are.
+var NodeCoreModules = map[string]string{
+	"events":   "/lib/events",
+	"fs":       "/lib/fs",
+	"http":     "/lib/http",
+	"path":     "/lib/path",
+	"process":  "/lib/process",
+	"readline": "/lib/readline",
+	"util":     "/lib/util",
+}
+
+// registerNodeCoreModules registers the names of NodeCoreModules,
+// with and without the "node:" prefix, to the registry.
+func registerNodeCoreModules(registry *require.Registry) {
+	for name, target := range NodeCoreModules {
+		loader := nodeCoreLoader(target)
+		registry.RegisterNativeModule(name, loader)
+		registry.RegisterNativeModule(require.NodePrefix+name, loader)
+	}
+}
+
+// nodeCoreLoader returns the loader of a core module, which exports the module target.
+func nodeCoreLoader(target string) require.ModuleLoader {
+	return func(vm *goja.Runtime, module *goja.Object) {
+		req, ok := goja.AssertFunction(vm.Get("require"))
+		if !ok {
+			panic(vm.NewGoError(require.InvalidModuleError))
+		}
+		exports, err := req(goja.Undefined(), vm.ToValue(target))
+		if err != nil {
+			panic(err)
+		}
+		module.Set("exports", exports)
+	}
+}
@@ -0,0 +1,56 @@
+package engine
+
+import "testing"
+
+func TestNodeCoreModules(t *testing.T) {
+	tests := []TestCase{
+		{
+			name: "node_core_names",
+			script: `
+				console.println(require("fs") === require("/lib/fs"), require("node:fs") === require("fs"));
+				console.println(require("node:events") === require("/lib/events"));
+				console.println(typeof require("node:process").exit, typeof require("util").parseArgs);
+				const usescore = require("/work/resolve/node_modules/usescore");
+				usescore.emitter.on("ping", (v) => console.println("ping", v));
+				usescore.emitter.emit("ping", 1);
+				console.println(usescore.name, usescore.util);
+			`,
+			output: []string{
+				"true true",
+				"true",
+				"function function",
+				"ping 1",
+				"usescore/index function",
+			},
+		},
+		{
+			name: "node_core_path",
+			script: `
+				const path = require("node:path");
+				console.println(path.join("/a/b", "../c", "./d.js"), path.join("a", "", "b/"), path.join());
+				console.println(path.resolve("x/y", "../z"), path.resolve("/a", "b", "/c", "d"));
+				console.println(path.normalize("/a//b/../c/."), path.normalize("../a/./b"), path.normalize(""));
+				console.println(path.relative("/a/b/c", "/a/d"), path.relative("/a", "/a/b/c"));
+				console.println(path.dirname("/a/b/c.txt"), path.dirname("/a"), path.dirname("a"), path.dirname("/a/b/"));
+				console.println(path.basename("/a/b/c.txt"), path.basename("/a/b/c.txt", ".txt"), path.basename("/a/b/"));
+				console.println(path.extname("c.tar.gz"), path.extname(".profile") === "", path.extname("a/b"));
+				console.println(JSON.stringify(path.parse("/home/user/file.txt")));
+				console.println(path.format({ dir: "/home/user", name: "file", ext: ".txt" }), path.isAbsolute("/a"), path.sep);
+			`,
+			output: []string{
+				"/a/c/d.js a/b/ .",
+				"/work/x/z /c/d",
+				"/a/c ../a/b .",
+				"../../d b/c",
+				"/a/b / . /a",
+				"c.txt c b",
+				".gz true ",
+				`{"root":"/","dir":"/home/user","base":"file.txt","ext":".txt","name":"file"}`,
+				"/home/user/file.txt true /",
+			},
+		},
+	}
+	for _, tc := range tests {
+		RunTest(t, tc)
+	}
+}
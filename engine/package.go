@@ -0,0 +1,247 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// packageConditions are the conditions of the "exports" and "imports" maps of package.json
+// that require() matches. The first matching condition of a map is used, in the order of the map.
+var packageConditions = []string{"require", "node", "default"}
+
+// packageJSON is the part of package.json that require() reads.
+type packageJSON struct {
+	Main    string          `json:"main"`
+	Exports json.RawMessage `json:"exports"`
+	Imports json.RawMessage `json:"imports"`
+}
+
+// readPackageJSON reads the package.json of the directory dir.
+func readPackageJSON(fileSystem fs.FS, dir string) (*packageJSON, bool) {
+	b, err := fs.ReadFile(fileSystem, CleanPath(path.Join(dir, "package.json")))
+	if err != nil {
+		return nil, false
+	}
+	pkg := &packageJSON{}
+	if err := json.Unmarshal(b, pkg); err != nil {
+		return nil, false
+	}
+	return pkg, true
+}
+
+// jsonMember is a member of a JSON object.
+type jsonMember struct {
+	key   string
+	value json.RawMessage
+}
+
+// jsonMembers returns the members of the JSON object raw in the order of the source,
+// which matters for the conditions, or false if raw is not an object.
+func jsonMembers(raw json.RawMessage) ([]jsonMember, bool) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, false
+	}
+	var ret []jsonMember
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, false
+		}
+		key, _ := tok.(string)
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, false
+		}
+		ret = append(ret, jsonMember{key: key, value: value})
+	}
+	return ret, true
+}
+
+// splitPackageName splits the bare module name into the name of the package,
+// like "pkg" or "@scope/pkg", and the subpath of the "exports", like "." or "./sub".
+func splitPackageName(name string) (string, string) {
+	parts := strings.SplitN(name, "/", 3)
+	n := 1
+	if strings.HasPrefix(name, "@") && len(parts) > 1 {
+		n = 2
+	}
+	if len(parts) <= n {
+		return name, "."
+	}
+	return strings.Join(parts[:n], "/"), "./" + strings.Join(parts[n:], "/")
+}
+
+// resolvePackageExports resolves the bare module name in the node_modules directory dir
+// by the "exports" of its package.json. It returns false if the package has no "exports",
+// so that it is resolved like a file or a directory, and a *notExportedError for the
+// subpaths the "exports" do not export, or exclude with null.
+func resolvePackageExports(fileSystem fs.FS, dir, name string) (string, bool, error) {
+	pkgName, subpath := splitPackageName(name)
+	pkgDir := path.Join(dir, pkgName)
+	pkg, ok := readPackageJSON(fileSystem, pkgDir)
+	if !ok || len(pkg.Exports) == 0 {
+		return "", false, nil
+	}
+	if p, ok := resolvePackageMap(fileSystem, pkgDir, pkg.Exports, subpath, false); ok {
+		return p, true, nil
+	}
+	return "", true, &notExportedError{pkg: pkgName, subpath: subpath}
+}
+
+// notExportedError is the error of require() for a subpath that a package does not export,
+// ERR_PACKAGE_PATH_NOT_EXPORTED of Node.js.
+type notExportedError struct {
+	pkg     string
+	subpath string
+}
+
+func (e *notExportedError) Error() string {
+	return fmt.Sprintf("subpath %s is not exported by %s", e.subpath, e.pkg)
+}
+
+// resolvePackageImports resolves the name, like "#internal", by the "imports" of the package.json
+// of the package that the directory dir belongs to, the nearest one.
+func resolvePackageImports(fileSystem fs.FS, dir, name string) (string, bool) {
+	for {
+		if pkg, ok := readPackageJSON(fileSystem, dir); ok {
+			if len(pkg.Imports) == 0 {
+				return "", false
+			}
+			return resolvePackageMap(fileSystem, dir, pkg.Imports, name, true)
+		}
+		parent := path.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// resolvePackageMap resolves key with the "exports" or the "imports" map of the package in pkgDir.
+func resolvePackageMap(fileSystem fs.FS, pkgDir string, m json.RawMessage, key string, imports bool) (string, bool) {
+	members, ok := jsonMembers(m)
+	if !ok || (!imports && len(members) > 0 && !strings.HasPrefix(members[0].key, ".")) {
+		if imports {
+			return "", false
+		}
+		// "exports" of the main entry only, a path, an array or conditions
+		if key != "." {
+			return "", false
+		}
+		return resolvePackageTarget(fileSystem, pkgDir, m, "", imports)
+	}
+	if target, match, ok := matchPackageMap(members, key); ok {
+		return resolvePackageTarget(fileSystem, pkgDir, target, match, imports)
+	}
+	return "", false
+}
+
+// matchPackageMap returns the target of key in members, and the part of key matched by
+// the "*" of a pattern. The exact key is preferred, then the pattern of the longest prefix.
+func matchPackageMap(members []jsonMember, key string) (json.RawMessage, string, bool) {
+	for _, m := range members {
+		if m.key == key && !strings.Contains(key, "*") {
+			return m.value, "", true
+		}
+	}
+	best, bestPrefix := -1, ""
+	var match string
+	for i, m := range members {
+		prefix, suffix, ok := strings.Cut(m.key, "*")
+		if !ok || strings.Contains(suffix, "*") {
+			continue
+		}
+		if len(key) < len(prefix)+len(suffix) || !strings.HasPrefix(key, prefix) || !strings.HasSuffix(key, suffix) {
+			continue
+		}
+		if best < 0 || len(prefix) > len(bestPrefix) || (len(prefix) == len(bestPrefix) && len(m.key) > len(members[best].key)) {
+			best, bestPrefix = i, prefix
+			match = key[len(prefix) : len(key)-len(suffix)]
+		}
+	}
+	if best < 0 {
+		return nil, "", false
+	}
+	return members[best].value, match, true
+}
+
+// resolvePackageTarget resolves the target of a map of the package in pkgDir:
+// a path relative to the package, an array of the alternatives, or the conditions.
+// The "*" of the paths are replaced by match. The targets of "imports" may be bare module names.
+func resolvePackageTarget(fileSystem fs.FS, pkgDir string, target json.RawMessage, match string, imports bool) (string, bool) {
+	var s string
+	if json.Unmarshal(target, &s) == nil {
+		s = strings.ReplaceAll(s, "*", match)
+		if strings.HasPrefix(s, "./") {
+			p := path.Join(pkgDir, s)
+			// the targets may not leave the package
+			if p != pkgDir && !strings.HasPrefix(p, pkgDir+"/") {
+				return "", false
+			}
+			return p, true
+		}
+		if imports && !strings.HasPrefix(s, "/") && !strings.HasPrefix(s, "../") {
+			return resolveBareModule(fileSystem, pkgDir, s)
+		}
+		return "", false
+	}
+	var alternatives []json.RawMessage
+	if json.Unmarshal(target, &alternatives) == nil {
+		for _, alt := range alternatives {
+			if p, ok := resolvePackageTarget(fileSystem, pkgDir, alt, match, imports); ok {
+				return p, true
+			}
+		}
+		return "", false
+	}
+	members, ok := jsonMembers(target)
+	if !ok {
+		// null excludes the key
+		return "", false
+	}
+	for _, m := range members {
+		if !isPackageCondition(m.key) {
+			continue
+		}
+		if p, ok := resolvePackageTarget(fileSystem, pkgDir, m.value, match, imports); ok {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+func isPackageCondition(name string) bool {
+	for _, c := range packageConditions {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveBareModule resolves the bare module name in the node_modules directories
+// from the directory dir up to the root, like require() does.
+func resolveBareModule(fileSystem fs.FS, dir, name string) (string, bool) {
+	for {
+		modules := path.Join(dir, "node_modules")
+		if path.Base(dir) == "node_modules" {
+			modules = dir
+		}
+		if p, ok, err := resolvePackageExports(fileSystem, modules, name); ok {
+			return p, err == nil
+		}
+		if p := path.Join(modules, name); moduleExists(fileSystem, p) {
+			return p, true
+		}
+		parent := path.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
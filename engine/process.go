@@ -1,16 +1,14 @@
 package engine
 
 import (
-	"bufio"
 	"fmt"
-	"io"
+	"math/big"
 	"os"
 	"runtime"
 	"strings"
 	"time"
 
 	"github.com/dop251/goja"
-	"github.com/dop251/goja_nodejs/eventloop"
 )
 
 func (jr *JSRuntime) Process(vm *goja.Runtime, module *goja.Object) {
@@ -18,7 +16,7 @@ func (jr *JSRuntime) Process(vm *goja.Runtime, module *goja.Object) {
 	exports := module.Get("exports").(*goja.Object)
 
 	// Basic properties
-	exports.Set("env", jr.Env)
+	exports.Set("env", newEnvObject(vm, jr.Env))
 	exports.Set("argv", append([]string{executable, jr.Name}, jr.Args...))
 	exports.Set("execPath", executable)
 	exports.Set("pid", os.Getpid())
@@ -47,13 +45,14 @@ func (jr *JSRuntime) Process(vm *goja.Runtime, module *goja.Object) {
 	exports.Set("exit", doExit(vm))
 	exports.Set("exec", doExec(vm, jr.Exec))
 	exports.Set("execString", doExecString(vm, jr.Exec))
-	exports.Set("dispatchEvent", dispatchEvent(jr.EventLoop()))
+	exports.Set("dispatchEvent", dispatchEvent(jr.runOnLoop, jr.uncaught))
 	exports.Set("now", jr.Now)
+	exports.Set("advanceClock", jr.AdvanceClock)
 	exports.Set("chdir", jr.Chdir)
 	exports.Set("cwd", jr.Cwd)
-	exports.Set("nextTick", doNextTick(jr.EventLoop()))
+	exports.Set("nextTick", doNextTick(jr.runOnLoop, jr.uncaught))
 
-	// Resource monitoring (placeholder implementations)
+	// Resource monitoring
 	exports.Set("memoryUsage", doMemoryUsage(vm))
 	exports.Set("cpuUsage", doCpuUsage(vm))
 	exports.Set("uptime", doUptime(vm))
@@ -61,77 +60,9 @@ func (jr *JSRuntime) Process(vm *goja.Runtime, module *goja.Object) {
 
 	// Signal handling support
 	exports.Set("kill", doKill(vm))
-}
-
-func (jr *JSRuntime) createStdin(vm *goja.Runtime) *goja.Object {
-	stdin := vm.NewObject()
-	reader := jr.Env.Reader()
-
-	// read() - read all available data
-	stdin.Set("read", func(call goja.FunctionCall) goja.Value {
-		data, err := io.ReadAll(reader)
-		if err != nil {
-			return vm.NewGoError(fmt.Errorf("stdin read error: %w", err))
-		}
-		return vm.ToValue(string(data))
-	})
-
-	// readLine() - read a single line
-	stdin.Set("readLine", func(call goja.FunctionCall) goja.Value {
-		scanner := bufio.NewScanner(reader)
-		if scanner.Scan() {
-			return vm.ToValue(scanner.Text())
-		}
-		if err := scanner.Err(); err != nil {
-			return vm.NewGoError(fmt.Errorf("stdin readLine error: %w", err))
-		}
-		return goja.Null()
-	})
-
-	// readLines() - read all lines as an array
-	stdin.Set("readLines", func(call goja.FunctionCall) goja.Value {
-		lines := []string{}
-		scanner := bufio.NewScanner(reader)
-		for scanner.Scan() {
-			lines = append(lines, scanner.Text())
-		}
-		if err := scanner.Err(); err != nil {
-			return vm.NewGoError(fmt.Errorf("stdin readLines error: %w", err))
-		}
-		return vm.ToValue(lines)
-	})
-
-	// readBytes(n) - read n bytes
-	stdin.Set("readBytes", func(call goja.FunctionCall) goja.Value {
-		if len(call.Arguments) < 1 {
-			return vm.NewGoError(fmt.Errorf("readBytes requires a number argument"))
-		}
-		n := int(call.Argument(0).ToInteger())
-		if n <= 0 {
-			return vm.NewGoError(fmt.Errorf("readBytes requires a positive number"))
-		}
-		buf := make([]byte, n)
-		bytesRead, err := reader.Read(buf)
-		if err != nil && err != io.EOF {
-			return vm.NewGoError(fmt.Errorf("stdin readBytes error: %w", err))
-		}
-		return vm.ToValue(string(buf[:bytesRead]))
-	})
-
-	// isTTY - check if stdin is a terminal
-	stdin.Set("isTTY", func(call goja.FunctionCall) goja.Value {
-		file, ok := reader.(*os.File)
-		if !ok {
-			return vm.ToValue(false)
-		}
-		stat, err := file.Stat()
-		if err != nil {
-			return vm.ToValue(false)
-		}
-		return vm.ToValue((stat.Mode() & os.ModeCharDevice) != 0)
-	})
-
-	return stdin
+	exports.Set("signals", signalNumbers())
+	exports.Set("watchSignal", jr.watchSignal)
+	exports.Set("unwatchSignal", jr.unwatchSignal)
 }
 
 func (jr *JSRuntime) createStdout(vm *goja.Runtime) *goja.Object {
@@ -169,6 +100,7 @@ func (jr *JSRuntime) createStdout(vm *goja.Runtime) *goja.Object {
 
 func (jr *JSRuntime) createStderr(vm *goja.Runtime) *goja.Object {
 	stderr := vm.NewObject()
+	writer := jr.Env.ErrorWriter()
 
 	// write(data) - write data to stderr
 	stderr.Set("write", func(call goja.FunctionCall) goja.Value {
@@ -176,7 +108,7 @@ func (jr *JSRuntime) createStderr(vm *goja.Runtime) *goja.Object {
 			return vm.ToValue(true)
 		}
 		data := call.Argument(0).String()
-		_, err := os.Stderr.Write([]byte(data))
+		_, err := writer.Write([]byte(data))
 		if err != nil {
 			return vm.ToValue(false)
 		}
@@ -185,7 +117,11 @@ func (jr *JSRuntime) createStderr(vm *goja.Runtime) *goja.Object {
 
 	// isTTY - check if stderr is a terminal
 	stderr.Set("isTTY", func(call goja.FunctionCall) goja.Value {
-		stat, err := os.Stderr.Stat()
+		file, ok := writer.(*os.File)
+		if !ok {
+			return vm.ToValue(false)
+		}
+		stat, err := file.Stat()
 		if err != nil {
 			return vm.ToValue(false)
 		}
@@ -203,6 +139,17 @@ func (jr *JSRuntime) Now() time.Time {
 	}
 }
 
+// AdvanceClock moves the ManualClock of the runtime forward by ms milliseconds,
+// the timers that are due fire on the event loop afterwards.
+func (jr *JSRuntime) AdvanceClock(ms int64) error {
+	mc, ok := jr.clock.(*ManualClock)
+	if !ok {
+		return fmt.Errorf("advanceClock: the runtime does not have a manual clock")
+	}
+	mc.Advance(time.Duration(ms) * time.Millisecond)
+	return nil
+}
+
 func (jr *JSRuntime) Cwd() string {
 	return jr.Env.Get("PWD").(string)
 }
@@ -287,7 +234,7 @@ func doExit(vm *goja.Runtime) func(call goja.FunctionCall) goja.Value {
 	}
 }
 
-func doNextTick(eventLoop *eventloop.EventLoop) func(call goja.FunctionCall) goja.Value {
+func doNextTick(runOnLoop func(func(*goja.Runtime)) bool, uncaught func(*goja.Runtime, error)) func(call goja.FunctionCall) goja.Value {
 	return func(call goja.FunctionCall) goja.Value {
 		if len(call.Arguments) < 1 {
 			return goja.Undefined()
@@ -303,93 +250,86 @@ func doNextTick(eventLoop *eventloop.EventLoop) func(call goja.FunctionCall) goj
 			args = append(args, call.Arguments[i])
 		}
 
-		eventLoop.RunOnLoop(func(vm *goja.Runtime) {
-			callback(goja.Undefined(), args...)
+		runOnLoop(func(vm *goja.Runtime) {
+			if _, err := callback(goja.Undefined(), args...); err != nil {
+				uncaught(vm, err)
+			}
 		})
 
 		return goja.Undefined()
 	}
 }
 
-func doMemoryUsage(vm *goja.Runtime) func(call goja.FunctionCall) goja.Value {
-	return func(call goja.FunctionCall) goja.Value {
-		// TODO: Implement actual memory usage tracking
+// processStart is when the process started, the origin of uptime and hrtime.
+var processStart = time.Now()
+
+// doMemoryUsage returns the memory usage of the process in bytes.
+// The rss is the maximum resident set size reached on darwin, see residentSize.
+//
+// syntax) memoryUsage(): {rss, heapTotal, heapUsed, external, arrayBuffers}
+// syntax) memoryUsage.rss(): number
+func doMemoryUsage(vm *goja.Runtime) *goja.Object {
+	fn := vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
 		result := vm.NewObject()
-		result.Set("rss", 0)       // Resident Set Size
-		result.Set("heapTotal", 0) // Total heap size
-		result.Set("heapUsed", 0)  // Used heap size
-		result.Set("external", 0)  // External memory
-		result.Set("arrayBuffers", 0)
+		result.Set("rss", residentSize())    // Resident Set Size
+		result.Set("heapTotal", ms.HeapSys)  // Total heap size
+		result.Set("heapUsed", ms.HeapAlloc) // Used heap size
+		result.Set("external", ms.Sys-ms.HeapSys)
+		result.Set("arrayBuffers", 0) // ArrayBuffers are in the heap
 		return result
-	}
+	}).(*goja.Object)
+	fn.Set("rss", func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(residentSize())
+	})
+	return fn
 }
 
+// doCpuUsage returns the user and system CPU time of the process in microseconds,
+// or the difference from previousValue, the result of a previous call.
+//
+// syntax) cpuUsage(previousValue?: {user, system}): {user, system}
 func doCpuUsage(vm *goja.Runtime) func(call goja.FunctionCall) goja.Value {
 	return func(call goja.FunctionCall) goja.Value {
-		// TODO: Implement actual CPU usage tracking
+		user, system := cpuTimes()
+		userMicros, systemMicros := user.Microseconds(), system.Microseconds()
+		if prev, ok := call.Argument(0).(*goja.Object); ok {
+			userMicros -= prev.Get("user").ToInteger()
+			systemMicros -= prev.Get("system").ToInteger()
+		}
 		result := vm.NewObject()
-		result.Set("user", 0)   // User CPU time in microseconds
-		result.Set("system", 0) // System CPU time in microseconds
+		result.Set("user", userMicros)     // User CPU time in microseconds
+		result.Set("system", systemMicros) // System CPU time in microseconds
 		return result
 	}
 }
 
+// doUptime returns the number of seconds the process has been running.
+//
+// syntax) uptime(): number
 func doUptime(vm *goja.Runtime) func(call goja.FunctionCall) goja.Value {
-	// TODO: Track actual process start time
-	startTime := time.Now()
 	return func(call goja.FunctionCall) goja.Value {
-		uptime := time.Since(startTime).Seconds()
-		return vm.ToValue(uptime)
+		return vm.ToValue(time.Since(processStart).Seconds())
 	}
 }
 
-func doHrtime(vm *goja.Runtime) func(call goja.FunctionCall) goja.Value {
-	return func(call goja.FunctionCall) goja.Value {
-		// TODO: Implement high-resolution time
-		// Returns [seconds, nanoseconds] tuple
-		now := time.Now()
-
-		if len(call.Arguments) > 0 {
-			// Calculate difference from previous hrtime call
-			prevArray := call.Argument(0).Export()
-			if arr, ok := prevArray.([]interface{}); ok && len(arr) == 2 {
-				prevSec := int64(arr[0].(float64))
-				prevNano := int64(arr[1].(float64))
-				prevTime := time.Unix(prevSec, prevNano)
-				diff := now.Sub(prevTime)
-
-				result := vm.NewArray()
-				result.Set("0", diff.Nanoseconds()/1e9)
-				result.Set("1", diff.Nanoseconds()%1e9)
-				return result
-			}
-		}
-
-		// Return current time
-		result := vm.NewArray()
-		result.Set("0", now.Unix())
-		result.Set("1", now.Nanosecond())
-		return result
-	}
-}
-
-func doKill(vm *goja.Runtime) func(call goja.FunctionCall) goja.Value {
-	return func(call goja.FunctionCall) goja.Value {
-		if len(call.Arguments) < 1 {
-			return vm.NewGoError(fmt.Errorf("kill requires a pid argument"))
-		}
-
-		pid := int(call.Argument(0).ToInteger())
-		signal := "SIGTERM"
-		if len(call.Arguments) > 1 {
-			signal = call.Argument(1).String()
+// doHrtime returns the monotonic time as [seconds, nanoseconds] from an arbitrary origin,
+// or the difference from time, the result of a previous call.
+//
+// syntax) hrtime(time?: [number, number]): [number, number]
+// syntax) hrtime.bigint(): bigint
+func doHrtime(vm *goja.Runtime) *goja.Object {
+	fn := vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		// time.Since uses the monotonic clock
+		elapsed := time.Since(processStart)
+		if prev, ok := call.Argument(0).(*goja.Object); ok && prev.ClassName() == "Array" {
+			elapsed -= time.Duration(prev.Get("0").ToInteger())*time.Second + time.Duration(prev.Get("1").ToInteger())
 		}
-
-		// TODO: Implement actual signal sending
-		// For now, just a placeholder
-		_ = pid
-		_ = signal
-
-		return vm.ToValue(true)
-	}
+		return vm.ToValue([]int64{int64(elapsed / time.Second), int64(elapsed % time.Second)})
+	}).(*goja.Object)
+	fn.Set("bigint", func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(big.NewInt(int64(time.Since(processStart))))
+	})
+	return fn
 }
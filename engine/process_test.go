@@ -3,6 +3,7 @@ package engine
 import (
 	"fmt"
 	"runtime"
+	"strings"
 	"testing"
 	"time"
 )
@@ -21,6 +22,34 @@ func TestProcess(t *testing.T) {
 				"PWD: /work",
 			},
 		},
+		{
+			name: "process_env_object",
+			script: `
+				const process = require("/lib/process");
+				console.println("PATH:", process.env.PATH);
+				process.env.FOO = "bar";
+				process.env.NUM = 42;
+				console.println("FOO:", process.env.get("FOO"), "NUM:", process.env.NUM, typeof process.env.NUM);
+				console.println("keys:", Object.keys(process.env).join(","));
+				console.println("has:", "FOO" in process.env, "MISSING" in process.env);
+				delete process.env.FOO;
+				console.println("deleted:", typeof process.env.FOO, process.env.get("FOO"));
+				process.env.set("BAZ", "qux");
+				console.println("BAZ:", process.env.BAZ);
+				console.println("json:", JSON.stringify(process.env));
+				console.println("fs:", typeof process.env.filesystem());
+			`,
+			output: []string{
+				"PATH: /lib:/work:/sbin",
+				"FOO: bar NUM: 42 string",
+				"keys: FOO,HOME,NUM,PATH,PWD",
+				"has: true false",
+				"deleted: undefined null",
+				"BAZ: qux",
+				`json: {"BAZ":"qux","HOME":"/","NUM":"42","PATH":"/lib:/work:/sbin","PWD":"/work"}`,
+				"fs: object",
+			},
+		},
 		{
 			name: "process_argv",
 			script: `
@@ -212,6 +241,105 @@ func TestProcessStdin(t *testing.T) {
 				"testing",
 			},
 		},
+		{
+			name: "stdin_readLine_buffered",
+			script: `
+				const process = require("/lib/process");
+				console.println("first:", process.stdin.readLine());
+				console.println("second:", process.stdin.readLine());
+				console.println("rest:", process.stdin.readLines().join(","));
+				console.println("eof:", process.stdin.readLine());
+			`,
+			input: []string{"one", "two", "three", "four"},
+			output: []string{
+				"first: one",
+				"second: two",
+				"rest: three,four",
+				"eof: null",
+			},
+		},
+		{
+			name: "stdin_data_events",
+			script: `
+				const process = require("/lib/process");
+				let data = "";
+				process.stdin.on("data", (chunk) => { data += chunk; });
+				process.stdin.on("end", () => {
+					console.println("end:", JSON.stringify(data));
+				});
+			`,
+			input: []string{"hello", "world"},
+			output: []string{
+				"end: \"hello\\nworld\\n\"",
+			},
+		},
+		{
+			name: "stdin_setEncoding",
+			script: `
+				const process = require("/lib/process");
+				let data = "";
+				process.stdin.setEncoding("hex");
+				process.stdin.on("data", (chunk) => { data += chunk; });
+				process.stdin.on("end", () => console.println("hex:", data));
+			`,
+			input: []string{"AB"},
+			output: []string{
+				"hex: 41420a",
+			},
+		},
+		{
+			name: "stdin_data_utf8_chunks",
+			script: `
+				const process = require("/lib/process");
+				let chars = 0, chunks = 0;
+				process.stdin.on("data", (chunk) => { chars += chunk.length; chunks++; });
+				process.stdin.on("end", () => {
+					console.println("chars:", chars, "chunks:", chunks > 1);
+				});
+			`,
+			input: []string{strings.Repeat("가", 30000)},
+			output: []string{
+				"chars: 30001 chunks: true",
+			},
+		},
+		{
+			name: "stdin_async_iterator",
+			script: `
+				const process = require("/lib/process");
+				(async () => {
+					const lines = process.stdin[Symbol.asyncIterator]();
+					let n = 0;
+					for (let r = await lines.next(); !r.done; r = await lines.next()) {
+						console.println(++n + ":", r.value);
+					}
+					console.println("done");
+				})();
+			`,
+			input: []string{"alpha", "beta", "gamma"},
+			output: []string{
+				"1: alpha",
+				"2: beta",
+				"3: gamma",
+				"done",
+			},
+		},
+		{
+			name: "stdin_async_iterator_break",
+			script: `
+				const process = require("/lib/process");
+				(async () => {
+					const lines = process.stdin.lines();
+					console.println("first:", (await lines.next()).value);
+					await lines.return();
+					console.println("done");
+				})();
+			`,
+			input: []string{"alpha", "beta"},
+			output: []string{
+				"first: alpha",
+				"done",
+			},
+		},
 	}
 
 	for _, tc := range tests {
@@ -264,6 +392,82 @@ func TestProcessExec(t *testing.T) {
 	}
 }
 
+func TestProcessExecInProcess(t *testing.T) {
+	inProcess := func(jr *JSRuntime) { jr.execInProcess = true }
+	tests := []TestCase{
+		{
+			name: "exec_in_process",
+			script: `
+				const process = require("/lib/process");
+				const exitCode = process.exec("echo", "hello from child");
+				console.println("exit code:", exitCode);
+			`,
+			output: []string{
+				"hello from child",
+				"exit code: 0",
+			},
+			preTest: inProcess,
+		},
+		{
+			name: "exec_in_process_exit_code",
+			script: `
+				const process = require("/lib/process");
+				const exitCode = process.execString("require('/lib/process').exit(3)");
+				console.println("exit code:", exitCode);
+			`,
+			output: []string{
+				"exit code: 3",
+			},
+			preTest: inProcess,
+		},
+		{
+			name: "exec_in_process_env",
+			script: `
+				const process = require("/lib/process");
+				process.env.set("GREETING", "hi");
+				process.execString("const p = require('/lib/process'); console.println(p.env.get('GREETING'), p.argv[2]); p.env.set('GREETING', 'bye')", "there");
+				console.println("parent:", process.env.get("GREETING"));
+			`,
+			output: []string{
+				"hi there",
+				"parent: hi",
+			},
+			preTest: inProcess,
+		},
+		{
+			name: "exec_in_process_not_found",
+			script: `
+				const process = require("/lib/process");
+				const exitCode = process.exec("no_such_command");
+				console.println("exit code:", exitCode);
+			`,
+			output: []string{
+				"command not found: no_such_command.js",
+				"exit code: 1",
+			},
+			preTest: inProcess,
+		},
+		{
+			name: "exec_in_process_stdin",
+			script: `
+				const process = require("/lib/process");
+				console.println("parent:", process.stdin.readLine());
+				process.execString("const p = require('/lib/process'); console.println('child:', p.stdin.readLine())");
+			`,
+			input: []string{"first", "second"},
+			output: []string{
+				"parent: first",
+				"child: second",
+			},
+			preTest: inProcess,
+		},
+	}
+
+	for _, tc := range tests {
+		RunTest(t, tc)
+	}
+}
+
 func TestProcessShutdownHook(t *testing.T) {
 	tests := []TestCase{
 		{
@@ -434,6 +638,56 @@ func TestProcessResources(t *testing.T) {
 				"length: 2",
 			},
 		},
+		{
+			name: "process_memoryUsage_values",
+			script: `
+				const process = require("/lib/process");
+				const mem = process.memoryUsage();
+				console.println("rss > 0:", mem.rss > 0, process.memoryUsage.rss() > 0);
+				console.println("heapUsed <= heapTotal:", mem.heapUsed > 0 && mem.heapUsed <= mem.heapTotal);
+			`,
+			output: []string{
+				"rss > 0: true true",
+				"heapUsed <= heapTotal: true",
+			},
+		},
+		{
+			name: "process_cpuUsage_delta",
+			script: `
+				const process = require("/lib/process");
+				const start = process.cpuUsage();
+				let x = 0;
+				for (let i = 0; i < 1000000; i++) { x += i; }
+				const delta = process.cpuUsage(start);
+				const total = process.cpuUsage();
+				console.println("delta >= 0:", delta.user >= 0 && delta.system >= 0);
+				console.println("delta <= total:", delta.user <= total.user && delta.system <= total.system);
+			`,
+			output: []string{
+				"delta >= 0: true",
+				"delta <= total: true",
+			},
+		},
+		{
+			name: "process_hrtime_delta",
+			script: `
+				const process = require("/lib/process");
+				const start = process.hrtime();
+				const big = process.hrtime.bigint();
+				setTimeout(() => {
+					const [sec, nsec] = process.hrtime(start);
+					const ms = sec * 1e3 + nsec / 1e6;
+					console.println("elapsed:", ms >= 10 && ms < 1000);
+					console.println("bigint:", typeof big, process.hrtime.bigint() - big >= 10000000n);
+					console.println("uptime:", process.uptime() >= ms / 1e3);
+				}, 10);
+			`,
+			output: []string{
+				"elapsed: true",
+				"bigint: bigint true",
+				"uptime: true",
+			},
+		},
 	}
 
 	for _, tc := range tests {
@@ -441,6 +695,61 @@ func TestProcessResources(t *testing.T) {
 	}
 }
 
+func TestProcessSignals(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals are not supported on windows")
+	}
+	tests := []TestCase{
+		{
+			name: "process_kill_check",
+			script: `
+				const process = require("/lib/process");
+				console.println("exists:", process.kill(process.pid, 0));
+				console.println(process.kill(process.pid, "SIGNOPE").message);
+			`,
+			output: []string{
+				"exists: true",
+				"unknown signal: SIGNOPE",
+			},
+		},
+		{
+			name: "process_signal_event",
+			script: `
+				const process = require("/lib/process");
+				const keepAlive = setTimeout(() => console.println("timeout"), 5000);
+				process.once("SIGUSR1", (name, num) => {
+					console.println("received:", name, num === process.signals.SIGUSR1);
+					clearTimeout(keepAlive);
+				});
+				process.kill(process.pid, "SIGUSR1");
+			`,
+			output: []string{
+				"received: SIGUSR1 true",
+			},
+		},
+		{
+			name: "process_signal_by_number",
+			script: `
+				const process = require("/lib/process");
+				const keepAlive = setTimeout(() => console.println("timeout"), 5000);
+				const handler = (name) => {
+					console.println("received:", name);
+					process.off("SIGUSR2", handler);
+					clearTimeout(keepAlive);
+				};
+				process.on("SIGUSR2", handler);
+				process.kill(process.pid, process.signals.SIGUSR2);
+			`,
+			output: []string{
+				"received: SIGUSR2",
+			},
+		},
+	}
+	for _, tc := range tests {
+		RunTest(t, tc)
+	}
+}
+
 func TestProcessEvents(t *testing.T) {
 	tests := []TestCase{
 		{
@@ -0,0 +1,49 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+
+	"github.com/dop251/goja"
+)
+
+// startProfile starts the CPU profile of the JavaScript functions if jr.cpuProfile is set.
+// The returned function stops it and writes the heap profile if jr.memProfile is set.
+// The profiles are written to the files of the host, in the pprof format.
+func (jr *JSRuntime) startProfile() (func(), error) {
+	var cpu *os.File
+	if jr.cpuProfile != "" {
+		f, err := os.Create(jr.cpuProfile)
+		if err != nil {
+			return nil, fmt.Errorf("cpuprofile: %w", err)
+		}
+		if err := goja.StartProfile(f); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("cpuprofile: %w", err)
+		}
+		cpu = f
+	}
+	return func() {
+		if cpu != nil {
+			goja.StopProfile()
+			cpu.Close()
+		}
+		if jr.memProfile != "" {
+			if err := writeHeapProfile(jr.memProfile); err != nil {
+				fmt.Fprintln(jr.Env.ErrorWriter(), "memprofile:", err)
+			}
+		}
+	}, nil
+}
+
+func writeHeapProfile(name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	runtime.GC() // get up-to-date statistics
+	return pprof.WriteHeapProfile(f)
+}
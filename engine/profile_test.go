@@ -0,0 +1,41 @@
+package engine
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProfile(t *testing.T) {
+	dir := t.TempDir()
+	conf := Config{
+		Code: `
+			function fib(n) { return n < 2 ? n : fib(n - 1) + fib(n - 2); }
+			console.println(fib(20));
+		`,
+		CPUProfile: filepath.Join(dir, "cpu.pprof"),
+		MemProfile: filepath.Join(dir, "mem.pprof"),
+		Reader:     &bytes.Buffer{},
+		Writer:     &bytes.Buffer{},
+	}
+	jr, err := New(conf)
+	if err != nil {
+		t.Fatalf("Failed to create JSRuntime: %v", err)
+	}
+	if err := jr.Run(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := conf.Writer.(*bytes.Buffer).String(); got != "6765\n" {
+		t.Errorf("Expected output %q, got %q", "6765\n", got)
+	}
+	for _, name := range []string{conf.CPUProfile, conf.MemProfile} {
+		fi, err := os.Stat(name)
+		if err != nil {
+			t.Fatalf("Expected profile %s: %v", name, err)
+		}
+		if fi.Size() == 0 {
+			t.Errorf("Expected profile %s not to be empty", name)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/dop251/goja"
+)
+
+// lookupSignal returns the signal named name, like "SIGTERM" or "TERM", or numbered n.
+func lookupSignal(v goja.Value) (syscall.Signal, error) {
+	if n, ok := v.Export().(int64); ok {
+		return syscall.Signal(n), nil
+	}
+	name := strings.ToUpper(v.String())
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	if sig, ok := signals[name]; ok {
+		return sig, nil
+	}
+	return 0, fmt.Errorf("unknown signal: %s", v.String())
+}
+
+// signalNumbers returns the numbers of the signals by their names.
+func signalNumbers() map[string]int {
+	ret := make(map[string]int, len(signals))
+	for name, sig := range signals {
+		ret[name] = int(sig)
+	}
+	return ret
+}
+
+// doKill sends a signal to the process pid, SIGTERM by default.
+// The signal 0 tests if the process exists.
+//
+// syntax) kill(pid: number, signal?: string|number): boolean
+func doKill(vm *goja.Runtime) func(call goja.FunctionCall) goja.Value {
+	return func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) < 1 {
+			return vm.NewGoError(fmt.Errorf("kill requires a pid argument"))
+		}
+		pid := int(call.Argument(0).ToInteger())
+		sig := syscall.SIGTERM
+		if arg := call.Argument(1); !goja.IsUndefined(arg) {
+			var err error
+			if sig, err = lookupSignal(arg); err != nil {
+				return vm.NewGoError(err)
+			}
+		}
+		proc, err := os.FindProcess(pid)
+		if err != nil {
+			return vm.NewGoError(fmt.Errorf("kill %d: %w", pid, err))
+		}
+		if err := proc.Signal(sig); err != nil {
+			return vm.NewGoError(fmt.Errorf("kill %d: %w", pid, err))
+		}
+		return vm.ToValue(true)
+	}
+}
+
+// watchSignal delivers the signal name received by the process to obj,
+// as an event of the same name dispatched on the event loop.
+// The signal does not terminate the process anymore, until unwatchSignal.
+func (jr *JSRuntime) watchSignal(obj *goja.Object, name string) error {
+	if _, ok := jr.signals[name]; ok {
+		return nil
+	}
+	sig, ok := signals[name]
+	if !ok {
+		return fmt.Errorf("unknown signal: %s", name)
+	}
+	if jr.signals == nil {
+		jr.signals = make(map[string]chan os.Signal)
+		jr.AddShutdownHook(jr.unwatchSignals)
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sig)
+	jr.signals[name] = ch
+	dispatch := dispatchEvent(jr.eventLoop.RunOnLoop, jr.uncaught)
+	go func() {
+		for range ch {
+			dispatch(obj, name, name, int(sig))
+		}
+	}()
+	return nil
+}
+
+// unwatchSignal stops delivering the signal name, watched by watchSignal.
+func (jr *JSRuntime) unwatchSignal(name string) {
+	if ch, ok := jr.signals[name]; ok {
+		signal.Stop(ch)
+		close(ch)
+		delete(jr.signals, name)
+	}
+}
+
+func (jr *JSRuntime) unwatchSignals() {
+	for name := range jr.signals {
+		jr.unwatchSignal(name)
+	}
+}
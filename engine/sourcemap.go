@@ -0,0 +1,221 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/fs"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Source maps
+//
+// goja maps the positions in stack traces through the source map named by the
+// "//# sourceMappingURL=" comment at the end of a script. The maps are read from the
+// mounted filesystem and inlined into the source as data URLs, with the sources made
+// relative to the script, as goja resolves them against its name, and the first line
+// shifted by the code put in front of it: the function header goja_nodejs wraps the
+// modules in, and the prologue of the rewritten ES modules.
+// A script without the comment uses the map next to it, file.js.map for file.js, if there is one.
+
+const sourceMapComment = "//# sourceMappingURL="
+
+// moduleWrapper is the function header goja_nodejs puts on the first line of the modules.
+const moduleWrapper = "(function(exports, require, module, __filename, __dirname) {"
+
+// moduleWrapperLen is the length of moduleWrapper.
+var moduleWrapperLen = len(moduleWrapper)
+
+// inlineSourceMap returns src, the source loaded from file as orig, with its source map inlined.
+// shift is the number of characters put in front of src when it is compiled.
+// A source map that cannot be loaded is removed, rather than failing the compilation.
+func inlineSourceMap(fileSystem fs.FS, file string, orig, src []byte, shift int) []byte {
+	start, end := sourceMapLine(src)
+	var ref string
+	if start < 0 {
+		if ref = sideSourceMap(fileSystem, file); ref == "" {
+			return src
+		}
+		// the comment goes on a line of its own at the end, which moves no position
+		src = append(src[:len(src):len(src)], '\n')
+		start, end = len(src), len(src)
+	} else {
+		ref = strings.TrimSpace(string(src[start+len(sourceMapComment) : end]))
+	}
+	var text string
+	if data, mapFile := loadSourceMap(fileSystem, file, ref); data != nil {
+		shift += firstLineLen(src) - firstLineLen(orig)
+		if m, err := adjustSourceMap(data, path.Dir(file), mapFile, shift); err == nil {
+			text = sourceMapComment + "data:application/json;base64," + base64.StdEncoding.EncodeToString(m)
+		}
+	}
+	out := make([]byte, 0, len(src)-(end-start)+len(text))
+	out = append(out, src[:start]...)
+	out = append(out, text...)
+	return append(out, src[end:]...)
+}
+
+// sourceMapLine returns the position of the source map comment, that is the last line of src
+// that is not empty, or -1 if there is none. This is how the parser of goja finds it.
+func sourceMapLine(src []byte) (int, int) {
+	if !bytes.Contains(src, []byte(sourceMapComment)) {
+		return -1, -1
+	}
+	end := len(src)
+	for end > 0 {
+		start := bytes.LastIndexByte(src[:end], '\n') + 1
+		line := bytes.TrimRight(src[start:end], "\r")
+		if len(line) > 0 {
+			if bytes.HasPrefix(line, []byte(sourceMapComment)) {
+				return start, start + len(line)
+			}
+			break
+		}
+		end = max(start-1, 0)
+	}
+	return -1, -1
+}
+
+// sideSourceMap returns the name of the source map next to the script file, file.js.map
+// for file.js, relative to the script, or "" if there is none.
+func sideSourceMap(fileSystem fs.FS, file string) string {
+	if fileSystem == nil || file == "" {
+		return ""
+	}
+	if fi, err := fs.Stat(fileSystem, CleanPath(file+".map")); err != nil || fi.IsDir() {
+		return ""
+	}
+	return path.Base(file) + ".map"
+}
+
+// loadSourceMap returns the source map ref refers to from the script file,
+// and the name of the file the sources of the map are relative to.
+func loadSourceMap(fileSystem fs.FS, file, ref string) ([]byte, string) {
+	if data, ok := strings.CutPrefix(ref, "data:"); ok {
+		header, payload, _ := strings.Cut(data, ",")
+		if strings.HasSuffix(header, ";base64") {
+			b, err := base64.StdEncoding.DecodeString(payload)
+			if err != nil {
+				return nil, ""
+			}
+			return b, file
+		}
+		s, err := url.PathUnescape(payload)
+		if err != nil {
+			return nil, ""
+		}
+		return []byte(s), file
+	}
+	if fileSystem == nil {
+		return nil, ""
+	}
+	ref = strings.TrimPrefix(ref, "file://")
+	if strings.Contains(ref, "://") {
+		return nil, ""
+	}
+	if !path.IsAbs(ref) {
+		ref = path.Join(path.Dir(file), ref)
+	}
+	ref = CleanPath(ref)
+	b, err := fs.ReadFile(fileSystem, ref)
+	if err != nil {
+		return nil, ""
+	}
+	return b, ref
+}
+
+// adjustSourceMap makes the sources of the source map data, loaded from mapFile, relative to
+// the directory dir of the script and shifts the generated columns of the first line by shift.
+func adjustSourceMap(data []byte, dir, mapFile string, shift int) ([]byte, error) {
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	root, _ := m["sourceRoot"].(string)
+	if sources, ok := m["sources"].([]any); ok {
+		for i, s := range sources {
+			if name, ok := s.(string); ok && !strings.Contains(name, "://") && !path.IsAbs(name) {
+				name = path.Join(path.Dir(mapFile), root, name)
+				if rel, err := filepath.Rel(dir, name); err == nil {
+					name = filepath.ToSlash(rel)
+				}
+				sources[i] = name
+			}
+		}
+		delete(m, "sourceRoot")
+	}
+	if mappings, ok := m["mappings"].(string); ok && shift != 0 {
+		m["mappings"] = shiftMappings(mappings, shift)
+	}
+	return json.Marshal(m)
+}
+
+// shiftMappings shifts the generated columns of the first line of the mappings by shift.
+// The columns of the following segments of a line are relative to the first one,
+// so only the first segment changes.
+func shiftMappings(mappings string, shift int) string {
+	end := strings.IndexAny(mappings, ",;")
+	if end < 0 {
+		end = len(mappings)
+	}
+	if end == 0 {
+		return mappings
+	}
+	col, n, ok := decodeVLQ(mappings[:end])
+	if !ok {
+		return mappings
+	}
+	return encodeVLQ(col+shift) + mappings[n:]
+}
+
+const vlqChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// decodeVLQ decodes the first base64 VLQ value of s, and returns it with the number of characters it takes.
+func decodeVLQ(s string) (int, int, bool) {
+	v, bits := 0, 0
+	for n := 0; n < len(s); n++ {
+		d := strings.IndexByte(vlqChars, s[n])
+		if d < 0 {
+			return 0, 0, false
+		}
+		v += (d & 31) << bits
+		if d&32 == 0 {
+			if v&1 != 0 {
+				return -(v >> 1), n + 1, true
+			}
+			return v >> 1, n + 1, true
+		}
+		bits += 5
+	}
+	return 0, 0, false
+}
+
+func encodeVLQ(v int) string {
+	if v < 0 {
+		v = -v<<1 | 1
+	} else {
+		v <<= 1
+	}
+	var sb strings.Builder
+	for {
+		d := v & 31
+		v >>= 5
+		if v > 0 {
+			d |= 32
+		}
+		sb.WriteByte(vlqChars[d])
+		if v == 0 {
+			return sb.String()
+		}
+	}
+}
+
+func firstLineLen(b []byte) int {
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		return i
+	}
+	return len(b)
+}
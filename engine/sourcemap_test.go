@@ -0,0 +1,95 @@
+package engine
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSourceMap(t *testing.T) {
+	tests := []TestCase{
+		{
+			name: "sourcemap_stack",
+			script: `
+				const { fail } = require("/work/sourcemap/dist/util.js");
+				try {
+					fail("x");
+				} catch (e) {
+					console.println(e.message);
+					console.println(e.stack.match(/at fail \((.*?)\(/)[1]);
+				}
+			`,
+			output: []string{
+				"fail: x",
+				"/work/sourcemap/src/util.ts:2:10",
+			},
+		},
+		{
+			name: "sourcemap_side_by_side",
+			script: `
+				// side.js has no comment, side.js.map is next to it
+				const { fail } = require("/work/sourcemap/dist/side.js");
+				try {
+					fail("x");
+				} catch (e) {
+					console.println(e.stack.match(/at fail \((.*?)\(/)[1]);
+				}
+			`,
+			output: []string{
+				"/work/sourcemap/src/util.ts:2:10",
+			},
+		},
+		{
+			name:   "sourcemap_missing",
+			script: "console.println('no map');\n//# sourceMappingURL=missing.js.map\n",
+			output: []string{
+				"no map",
+			},
+		},
+	}
+	for _, tc := range tests {
+		RunTest(t, tc)
+	}
+}
+
+func TestSourceMapMain(t *testing.T) {
+	conf := Config{
+		Args:   []string{"sourcemap/dist/main.js"},
+		FSTabs: []FSTab{{MountPoint: "/", Source: "../native/root/"}, {MountPoint: "/work", Source: "../test/"}},
+		Env: map[string]any{
+			"PATH": "/lib:/work:/sbin",
+			"PWD":  "/work",
+		},
+		Reader: &bytes.Buffer{},
+		Writer: &bytes.Buffer{},
+	}
+	jr, err := New(conf)
+	if err != nil {
+		t.Fatalf("Failed to create JSRuntime: %v", err)
+	}
+	if code := jr.Main(); code != 1 {
+		t.Fatalf("Expected exit code 1, got %d", code)
+	}
+	output := conf.Writer.(*bytes.Buffer).String()
+	for _, want := range []string{
+		"runtime error: Error: fail: main",
+		"at fail (/work/sourcemap/src/util.ts:2:10(",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, output)
+		}
+	}
+}
+
+func TestVLQ(t *testing.T) {
+	for _, v := range []int{0, 1, -1, 15, 16, -16, 1000, -123456} {
+		s := encodeVLQ(v)
+		got, n, ok := decodeVLQ(s + "A")
+		if !ok || got != v || n != len(s) {
+			t.Errorf("decodeVLQ(encodeVLQ(%d)=%q) = %d, %d, %v", v, s, got, n, ok)
+		}
+	}
+	if got := shiftMappings("aAAA,SAAgB;AACA", 61); got != "0EAAA,SAAgB;AACA" {
+		t.Errorf("shiftMappings: got %q", got)
+	}
+}
@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestErrorWriter(t *testing.T) {
+	tests := []struct {
+		name      string
+		script    string
+		inProcess bool
+		stdout    string
+		stderr    string
+	}{
+		{
+			name: "stderr_write",
+			script: `
+				const process = require("/lib/process");
+				process.stdout.write("data\n");
+				process.stderr.write("oops\n");
+			`,
+			stdout: "data\n",
+			stderr: "oops\n",
+		},
+		{
+			name: "console_error_warn",
+			script: `
+				console.println("data");
+				console.warn("careful");
+				console.error("failed");
+			`,
+			stdout: "data\n",
+			stderr: "WARN  careful\nERROR failed\n",
+		},
+		{
+			name:   "runtime_error",
+			script: `console.println("data"); throw new Error("boom");`,
+			stdout: "data\n",
+			stderr: "runtime error: Error: boom\n",
+		},
+		{
+			name: "exec_child_stderr",
+			script: `
+				const process = require("/lib/process");
+				process.execString("require('/lib/process').stderr.write('child oops\\n'); console.println('child data')");
+			`,
+			stdout: "child data\n",
+			stderr: "child oops\n",
+		},
+		{
+			name: "exec_in_process_child_stderr",
+			script: `
+				const process = require("/lib/process");
+				process.execString("require('/lib/process').stderr.write('child oops\\n'); console.println('child data')");
+			`,
+			inProcess: true,
+			stdout:    "child data\n",
+			stderr:    "child oops\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+			conf := Config{
+				Name:   tt.name,
+				Code:   tt.script,
+				FSTabs: []FSTab{{MountPoint: "/", Source: "../native/root/"}, {MountPoint: "/work", Source: "../test/"}},
+				Env: map[string]any{
+					"PATH": "/lib:/work:/sbin",
+					"PWD":  "/work",
+				},
+				Reader:        &bytes.Buffer{},
+				Writer:        stdout,
+				ErrorWriter:   stderr,
+				ExecBuilder:   testExecBuilder,
+				ExecInProcess: tt.inProcess,
+			}
+			jr, err := New(conf)
+			if err != nil {
+				t.Fatalf("Failed to create JSRuntime: %v", err)
+			}
+			jr.RegisterNativeModule("@jsh/process", jr.Process)
+			jr.Main()
+			if got := stdout.String(); got != tt.stdout {
+				t.Errorf("stdout: expected %q, got %q", tt.stdout, got)
+			}
+			got := stderr.String()
+			if i := strings.Index(got, "\n\tat "); i >= 0 {
+				got = got[:i+1] // the stack frames of the runtime error
+			}
+			if got != tt.stderr {
+				t.Errorf("stderr: expected %q, got %q", tt.stderr, got)
+			}
+		})
+	}
+}
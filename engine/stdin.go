@@ -0,0 +1,340 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja_nodejs/eventloop"
+)
+
+// stdinChunkSize is the maximum size of the chunks delivered by the 'data' events of stdin.
+const stdinChunkSize = 64 * 1024
+
+// stdinStream is the buffered reader behind process.stdin.
+// The blocking reads and the 'data' events share the same buffer,
+// so no input is lost between calls.
+//
+// All the fields except reader are accessed only on the event loop.
+type stdinStream struct {
+	reader   *bufio.Reader
+	encoding string // "utf8", "hex", "base64", "latin1" or "buffer"
+	carry    []byte // the bytes of an incomplete character, kept for the next chunk
+	flowing  bool   // the 'data' events are started
+	paused   bool
+	ended    bool
+	hold     *eventloop.Timer // keeps the event loop alive while flowing
+	pending  []byte           // the chunk read while paused
+	ack      chan struct{}    // the reader waits for it after each chunk
+}
+
+func (jr *JSRuntime) stdinStream() *stdinStream {
+	if jr.stdin == nil {
+		jr.stdin = &stdinStream{
+			reader:   bufio.NewReader(jr.Env.Reader()),
+			encoding: "utf8",
+		}
+	}
+	return jr.stdin
+}
+
+func (jr *JSRuntime) createStdin(vm *goja.Runtime) *goja.Object {
+	stdin := vm.NewObject()
+	s := jr.stdinStream()
+	reader := s.reader
+
+	// read() - read all available data
+	stdin.Set("read", func(call goja.FunctionCall) goja.Value {
+		if s.flowing {
+			return vm.NewGoError(errStdinFlowing)
+		}
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return vm.NewGoError(fmt.Errorf("stdin read error: %w", err))
+		}
+		return vm.ToValue(encodeBytes(s.encoding, data))
+	})
+
+	// readLine() - read a single line
+	stdin.Set("readLine", func(call goja.FunctionCall) goja.Value {
+		if s.flowing {
+			return vm.NewGoError(errStdinFlowing)
+		}
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return vm.NewGoError(fmt.Errorf("stdin readLine error: %w", err))
+		}
+		if err == io.EOF && line == "" {
+			return goja.Null()
+		}
+		return vm.ToValue(trimEOL(line))
+	})
+
+	// readLines() - read all lines as an array
+	stdin.Set("readLines", func(call goja.FunctionCall) goja.Value {
+		if s.flowing {
+			return vm.NewGoError(errStdinFlowing)
+		}
+		lines := []string{}
+		for {
+			line, err := reader.ReadString('\n')
+			if line != "" {
+				lines = append(lines, trimEOL(line))
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return vm.NewGoError(fmt.Errorf("stdin readLines error: %w", err))
+			}
+		}
+		return vm.ToValue(lines)
+	})
+
+	// readBytes(n) - read n bytes
+	stdin.Set("readBytes", func(call goja.FunctionCall) goja.Value {
+		if s.flowing {
+			return vm.NewGoError(errStdinFlowing)
+		}
+		if len(call.Arguments) < 1 {
+			return vm.NewGoError(fmt.Errorf("readBytes requires a number argument"))
+		}
+		n := int(call.Argument(0).ToInteger())
+		if n <= 0 {
+			return vm.NewGoError(fmt.Errorf("readBytes requires a positive number"))
+		}
+		buf := make([]byte, n)
+		bytesRead, err := reader.Read(buf)
+		if err != nil && err != io.EOF {
+			return vm.NewGoError(fmt.Errorf("stdin readBytes error: %w", err))
+		}
+		return vm.ToValue(encodeBytes(s.encoding, buf[:bytesRead]))
+	})
+
+	// setEncoding(encoding) - set the encoding of the data read, null for the raw bytes
+	stdin.Set("setEncoding", func(call goja.FunctionCall) goja.Value {
+		enc, err := stdinEncoding(call.Argument(0))
+		if err != nil {
+			return vm.NewGoError(err)
+		}
+		s.encoding = enc
+		return goja.Undefined()
+	})
+
+	// flow(emitter) - start emitting 'data' and 'end' events on emitter
+	stdin.Set("flow", func(emitter *goja.Object) {
+		jr.flowStdin(vm, emitter)
+	})
+
+	// pause() - stop emitting 'data' events until flow() is called again
+	stdin.Set("pause", func(call goja.FunctionCall) goja.Value {
+		if s.flowing && !s.paused && !s.ended {
+			s.paused = true
+			jr.eventLoop.ClearTimeout(s.hold)
+			s.hold = nil
+		}
+		return goja.Undefined()
+	})
+
+	// isTTY - check if stdin is a terminal
+	stdin.Set("isTTY", func(call goja.FunctionCall) goja.Value {
+		file, ok := jr.Env.Reader().(*os.File)
+		if !ok {
+			return vm.ToValue(false)
+		}
+		stat, err := file.Stat()
+		if err != nil {
+			return vm.ToValue(false)
+		}
+		return vm.ToValue((stat.Mode() & os.ModeCharDevice) != 0)
+	})
+
+	return stdin
+}
+
+var errStdinFlowing = errors.New("stdin is flowing, use the 'data' events")
+
+// flowStdin reads stdin on its own goroutine and emits the chunks as 'data' events
+// of emitter on the event loop, then 'end' or 'error'. The reader waits for each
+// chunk to be emitted before reading the next one, so a slow script does not buffer
+// the whole input. The event loop is kept alive until the end of the input or pause.
+func (jr *JSRuntime) flowStdin(vm *goja.Runtime, emitter *goja.Object) {
+	s := jr.stdinStream()
+	if s.ended {
+		return
+	}
+	if s.hold == nil {
+		s.hold = jr.eventLoop.SetTimeout(func(*goja.Runtime) {}, time.Duration(math.MaxInt64))
+	}
+	if s.flowing {
+		if s.paused {
+			s.paused = false
+			if chunk, ack := s.pending, s.ack; ack != nil {
+				s.pending, s.ack = nil, nil
+				jr.emitStdin(vm, emitter, chunk)
+				close(ack)
+			}
+		}
+		return
+	}
+	s.flowing = true
+
+	loop := jr.eventLoop
+	go func() {
+		for {
+			buf := make([]byte, stdinChunkSize)
+			n, err := s.reader.Read(buf)
+			if n > 0 {
+				ack := make(chan struct{})
+				ok := loop.RunOnLoop(func(vm *goja.Runtime) {
+					if s.paused {
+						s.pending, s.ack = buf[:n], ack
+						return
+					}
+					jr.emitStdin(vm, emitter, buf[:n])
+					close(ack)
+				})
+				if !ok {
+					return
+				}
+				<-ack
+			}
+			if err != nil {
+				loop.RunOnLoop(func(vm *goja.Runtime) {
+					s.ended = true
+					if err == io.EOF {
+						if rest := s.flush(); rest != nil {
+							jr.emitEvent(vm, emitter, "data", vm.ToValue(rest))
+						}
+						jr.emitEvent(vm, emitter, "end")
+					} else {
+						jr.emitEvent(vm, emitter, "error", vm.NewGoError(fmt.Errorf("stdin read error: %w", err)))
+					}
+					if s.hold != nil {
+						loop.ClearTimeout(s.hold)
+						s.hold = nil
+					}
+				})
+				return
+			}
+		}
+	}()
+}
+
+// emitStdin emits chunk as a 'data' event of emitter, decoded by the encoding of stdin.
+func (jr *JSRuntime) emitStdin(vm *goja.Runtime, emitter *goja.Object, chunk []byte) {
+	if data := jr.stdin.decode(chunk); data != nil {
+		jr.emitEvent(vm, emitter, "data", vm.ToValue(data))
+	}
+}
+
+// emitEvent calls emitter.emit(event, ...args) and passes the exception thrown to jr.uncaught.
+func (jr *JSRuntime) emitEvent(vm *goja.Runtime, emitter *goja.Object, event string, args ...goja.Value) {
+	if emit, ok := goja.AssertFunction(emitter.Get("emit")); ok {
+		if _, err := emit(emitter, append([]goja.Value{vm.ToValue(event)}, args...)...); err != nil {
+			jr.uncaught(vm, err)
+		}
+	}
+}
+
+// decode returns the string or the bytes of chunk in the encoding of s.
+// The bytes of a character split between two chunks are kept for the next chunk.
+// It returns nil if there is nothing to emit yet.
+func (s *stdinStream) decode(chunk []byte) any {
+	b := append(s.carry, chunk...)
+	s.carry = nil
+	var keep int
+	switch s.encoding {
+	case "utf8":
+		keep = incompleteRune(b)
+	case "base64":
+		keep = len(b) % 3
+	}
+	if keep > 0 {
+		s.carry = append([]byte(nil), b[len(b)-keep:]...)
+		b = b[:len(b)-keep]
+	}
+	if len(b) == 0 {
+		return nil
+	}
+	return encodeBytes(s.encoding, b)
+}
+
+// flush returns the bytes kept by decode at the end of the input, nil if none.
+func (s *stdinStream) flush() any {
+	if len(s.carry) == 0 {
+		return nil
+	}
+	b := s.carry
+	s.carry = nil
+	return encodeBytes(s.encoding, b)
+}
+
+// incompleteRune returns the number of bytes at the end of b
+// that begin a UTF-8 character but do not complete it.
+func incompleteRune(b []byte) int {
+	for i := 1; i < utf8.UTFMax && i <= len(b); i++ {
+		c := b[len(b)-i]
+		if utf8.RuneStart(c) {
+			if c >= utf8.RuneSelf && !utf8.FullRune(b[len(b)-i:]) {
+				return i
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+func encodeBytes(encoding string, b []byte) any {
+	switch encoding {
+	case "hex":
+		return hex.EncodeToString(b)
+	case "base64":
+		return base64.StdEncoding.EncodeToString(b)
+	case "latin1":
+		r := make([]rune, len(b))
+		for i, c := range b {
+			r[i] = rune(c)
+		}
+		return string(r)
+	case "buffer":
+		return b
+	default:
+		return string(b)
+	}
+}
+
+// stdinEncoding returns the name of the encoding v, "utf8" if undefined
+// and "buffer" if null.
+func stdinEncoding(v goja.Value) (string, error) {
+	if goja.IsUndefined(v) {
+		return "utf8", nil
+	}
+	if goja.IsNull(v) {
+		return "buffer", nil
+	}
+	switch enc := strings.ToLower(v.String()); enc {
+	case "utf8", "utf-8":
+		return "utf8", nil
+	case "latin1", "binary":
+		return "latin1", nil
+	case "hex", "base64", "buffer":
+		return enc, nil
+	default:
+		return "", fmt.Errorf("unknown encoding: %s", v.String())
+	}
+}
+
+func trimEOL(line string) string {
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r")
+}
@@ -0,0 +1,167 @@
+package engine
+
+import (
+	"testing"
+)
+
+func TestLibTest(t *testing.T) {
+	tests := []TestCase{
+		{
+			name: "test_tap",
+			script: `
+				const { describe, it, beforeEach, afterEach, assert, run, tap } = require("/lib/test");
+				const order = [];
+				describe("outer", () => {
+					beforeEach(() => order.push("before outer"));
+					afterEach(() => order.push("after outer"));
+					describe("inner", () => {
+						beforeEach(() => order.push("before inner"));
+						afterEach(() => order.push("after inner"));
+						it("passes", () => order.push("test"));
+					});
+					it("fails", () => assert.deepStrictEqual({ a: [1, 2] }, { a: [1, 3] }));
+					it("rejects", async () => {
+						await assert.rejects(Promise.reject(new TypeError("bad")), TypeError);
+						await Promise.reject(new Error("async failure"));
+					});
+					it("times out", (done) => {}, { timeout: 20 });
+					it.skip("skipped", () => {});
+				});
+				describe("broken", () => {
+					throw new Error("declare failure");
+				});
+				run().then((results) => {
+					console.println(order.join(", "));
+					console.print(tap(results));
+				});
+			`,
+			output: []string{
+				"before outer, before inner, test, after inner, after outer, before outer, after outer, before outer, after outer, before outer, after outer",
+				"TAP version 13",
+				"ok 1 - outer > inner > passes",
+				"not ok 2 - outer > fails",
+				"  ---",
+				`  message: "{\"a\":[1,2]} deepStrictEqual {\"a\":[1,3]}"`,
+				"  operator: deepStrictEqual",
+				`  expected: "{\"a\":[1,3]}"`,
+				`  actual: "{\"a\":[1,2]}"`,
+				"  ...",
+				"not ok 3 - outer > rejects",
+				"  ---",
+				`  message: "async failure"`,
+				"  ...",
+				"not ok 4 - outer > times out",
+				"  ---",
+				`  message: "Timeout of 20ms exceeded"`,
+				"  ...",
+				"ok 5 - outer > skipped # SKIP",
+				"not ok 6 - broken",
+				"  ---",
+				`  message: "declare failure"`,
+				"  ...",
+				"1..6",
+				"# tests 6",
+				"# pass 1",
+				"# fail 4",
+				"# skip 1",
+			},
+		},
+		{
+			name: "test_junit",
+			script: `
+				const { it, assert, file, run, junit } = require("/lib/test");
+				file("/work/a.test.js", () => {
+					it("passes", () => assert.ok(true));
+					it("fails <here>", () => assert.equal(1, 2, "one is not two"));
+					it.skip("skipped");
+				});
+				run().then((results) => {
+					// the first lines, before the stack of the failure
+					const xml = junit(results).replace(/time="[^"]*"/g, 'time="0"');
+					console.println(xml.split("\n").slice(0, 6).join("\n"));
+				});
+			`,
+			output: []string{
+				`<?xml version="1.0" encoding="UTF-8"?>`,
+				`<testsuites name="jsh test" tests="3" failures="1" skipped="1" time="0">`,
+				`  <testsuite name="/work/a.test.js" tests="3" failures="1" skipped="1" time="0">`,
+				`    <testcase classname="/work/a.test.js" name="passes" time="0"/>`,
+				`    <testcase classname="/work/a.test.js" name="fails &lt;here&gt;" time="0">`,
+				`      <failure message="one is not two" type="AssertionError">AssertionError: one is not two`,
+			},
+		},
+		{
+			name: "test_assert",
+			script: `
+				const { assert } = require("/lib/test");
+				const check = (name, fn) => {
+					try {
+						fn();
+						console.println(name, "ok");
+					} catch (e) {
+						console.println(name, e.name + ":", e.message);
+					}
+				};
+				check("equal", () => assert.equal("1", 1));
+				check("strictEqual", () => assert.strictEqual("1", 1));
+				check("deepEqual", () => assert.deepEqual(new Map([[1, {a: 1}]]), new Map([[1, {a: 1}]])));
+				check("throws", () => assert.throws(() => { throw new RangeError("out"); }, /out/));
+				check("throws_class", () => assert.throws(() => { throw new RangeError("out"); }, TypeError));
+				check("match", () => assert.match("hello", /^h/));
+				check("fail", () => assert.fail("boom"));
+			`,
+			output: []string{
+				"equal ok",
+				`strictEqual AssertionError: "1" === 1`,
+				"deepEqual ok",
+				"throws ok",
+				"throws_class AssertionError: The error RangeError: out is not an instance of TypeError",
+				"match ok",
+				"fail AssertionError: boom",
+			},
+		},
+		{
+			name: "test_command_fail",
+			script: `
+				const process = require("/lib/process");
+				const code = process.exec("test", "/work/testing/fail");
+				console.println("exit code:", code);
+			`,
+			output: []string{
+				"TAP version 13",
+				"# /work/testing/fail/fail.test.js",
+				"not ok 1 - fails",
+				"  ---",
+				`  message: "2 === 3"`,
+				"  operator: ===",
+				`  expected: "3"`,
+				`  actual: "2"`,
+				"  ...",
+				"1..1",
+				"# tests 1",
+				"# pass 0",
+				"# fail 1",
+				"# skip 0",
+				"exit code: 1",
+			},
+		},
+		{
+			name: "test_command_invalid_timeout",
+			script: `
+				const process = require("/lib/process");
+				for (const timeout of ["abc", "-5"]) {
+					console.println("exit code:", process.exec("test", "-t", timeout, "/work/testing/fail"));
+				}
+			`,
+			output: []string{
+				"test: invalid timeout 'abc'",
+				"exit code: 2",
+				"test: invalid timeout '-5'",
+				"exit code: 2",
+			},
+		},
+	}
+	for _, tc := range tests {
+		RunTest(t, tc)
+	}
+}
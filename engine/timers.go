@@ -0,0 +1,71 @@
+package engine
+
+import (
+	"github.com/dop251/goja"
+)
+
+// wrapTimers wraps the timer functions of vm, so that the exceptions thrown by their
+// callbacks, which the event loop ignores, are reported as uncaught.
+// It also counts the pending jobs for the limits of the runtime,
+// fail is called with the *LimitError of the limit exceeded.
+func (jr *JSRuntime) wrapTimers(vm *goja.Runtime, fail func(error)) {
+	limits := jr.limits
+	schedule := func(name string, repeat bool) {
+		orig, ok := goja.AssertFunction(vm.Get(name))
+		if !ok {
+			return
+		}
+		vm.Set(name, func(call goja.FunctionCall) goja.Value {
+			fn, ok := goja.AssertFunction(call.Argument(0))
+			if !ok {
+				ret, _ := orig(call.This, call.Arguments...)
+				return ret
+			}
+			if jr.jobs.full() {
+				return goja.Undefined()
+			}
+			var handle any
+			args := append([]goja.Value{vm.ToValue(func(c goja.FunctionCall) goja.Value {
+				if !repeat {
+					jr.jobs.removeTimer(handle)
+				}
+				ret, err := fn(c.This, c.Arguments...)
+				if _, ok := err.(*goja.StackOverflowError); ok && limits.StackDepth > 0 {
+					fail(&LimitError{Limit: LimitStackDepth, Max: limits.StackDepth})
+				} else if err != nil {
+					jr.uncaught(vm, err)
+				}
+				return ret
+			})}, call.Arguments[1:]...)
+			ret, err := orig(call.This, args...)
+			if err != nil {
+				panic(err)
+			}
+			if limits.PendingJobs > 0 {
+				handle = ret.Export()
+				jr.jobs.addTimer(handle)
+			}
+			return ret
+		})
+	}
+	unschedule := func(name string) {
+		orig, ok := goja.AssertFunction(vm.Get(name))
+		if !ok {
+			return
+		}
+		vm.Set(name, func(call goja.FunctionCall) goja.Value {
+			jr.jobs.removeTimer(call.Argument(0).Export())
+			ret, err := orig(call.This, call.Arguments...)
+			if err != nil {
+				panic(err)
+			}
+			return ret
+		})
+	}
+	schedule("setTimeout", false)
+	schedule("setInterval", true)
+	schedule("setImmediate", false)
+	unschedule("clearTimeout")
+	unschedule("clearInterval")
+	unschedule("clearImmediate")
+}
@@ -0,0 +1,1140 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// TypeScript support
+//
+// TypeScript sources run after their types are stripped, like the "strip types" mode of Node.js.
+// Type annotations, interfaces, type aliases and the other type-only constructs are replaced
+// with white space, so the lines and columns in stack traces are the ones of the .ts source.
+// Enums, parameter properties and "import x = require()" are rewritten into JavaScript
+// on their own lines. Namespaces and decorators are not supported.
+
+// isTypeScript reports whether the file name has a TypeScript extension.
+func isTypeScript(name string) bool {
+	switch path.Ext(name) {
+	case ".ts", ".mts", ".cts":
+		return true
+	}
+	return false
+}
+
+// StripTypes returns the JavaScript of the TypeScript source src, loaded from the file named filename.
+func StripTypes(filename string, src []byte) ([]byte, error) {
+	if len(src) > 1 && src[0] == '#' && src[1] == '!' {
+		src = append([]byte("//"), src[2:]...)
+	}
+	s := &tsStripper{src: src, toks: tokenizeWithSubst(src), ctrlClose: -1}
+	s.match = matchBrackets(s.toks)
+	if err := s.strip(); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	slices.SortStableFunc(s.edits, func(a, b esmEdit) int { return a.start - b.start })
+	var out bytes.Buffer
+	pos := 0
+	for _, e := range s.edits {
+		out.Write(src[pos:e.start])
+		out.WriteString(e.text)
+		pos = e.end
+	}
+	out.Write(src[pos:])
+	return out.Bytes(), nil
+}
+
+type tsFrameKind int
+
+const (
+	tsBrace tsFrameKind = iota
+	tsParen
+	tsBracket
+	tsParams
+	tsClass
+)
+
+// states of the variable declarators and parameters, for finding their type annotations
+const (
+	bindNone = iota
+	bindName
+	bindAfter
+	bindInit
+)
+
+type tsFrame struct {
+	kind     tsFrameKind
+	open     int  // index of the opening token
+	pattern  bool // destructuring pattern of a declarator or a parameter
+	ctrl     bool // condition of if, for, while...
+	decl     int  // state of the variable declarators in the frame
+	param    int  // state of the parameter, if kind is tsParams
+	sigStart int  // index of the first token of the function signature, -1 if not a declaration
+	ctor     bool
+	propNext bool     // the next parameter is a parameter property
+	props    []string // parameter properties of the constructor
+}
+
+type tsParamsInfo struct {
+	sigStart int
+	ctor     bool
+}
+
+type tsStripper struct {
+	src   []byte
+	toks  []jsToken
+	match []int // index of the matching bracket of each bracket token, -1 if none
+	edits []esmEdit
+
+	frames       []tsFrame
+	nextParams   *tsParamsInfo // the next "(" opens the parameters of a function
+	nextClass    bool          // the next "{" opens a class body
+	pendingProps []string      // parameter properties to assign in the next "{"
+	ctrlClose    int           // index of the ")" that closed the last control condition
+}
+
+// matchBrackets returns the index of the matching bracket for each bracket token.
+func matchBrackets(toks []jsToken) []int {
+	match := make([]int, len(toks))
+	var stack []int
+	for i, t := range toks {
+		match[i] = -1
+		switch {
+		case t.isPunct("(", "[", "{"):
+			stack = append(stack, i)
+		case t.isPunct(")", "]", "}"):
+			if len(stack) > 0 {
+				open := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				match[open], match[i] = i, open
+			}
+		}
+	}
+	return match
+}
+
+func (s *tsStripper) strip() error {
+	s.frames = []tsFrame{{kind: tsBrace, open: -1, sigStart: -1}}
+	for i := 0; i < len(s.toks); {
+		next, err := s.token(i)
+		if err != nil {
+			return err
+		}
+		i = next
+	}
+	return nil
+}
+
+func (s *tsStripper) top() *tsFrame {
+	return &s.frames[len(s.frames)-1]
+}
+
+// tok returns toks[i], or a zero token if i is out of range.
+func (s *tsStripper) tok(i int) jsToken {
+	if i >= 0 && i < len(s.toks) {
+		return s.toks[i]
+	}
+	return jsToken{kind: tokPunct}
+}
+
+// token handles toks[i] and returns the index of the next token to handle.
+func (s *tsStripper) token(i int) (int, error) {
+	t := s.toks[i]
+	f := s.top()
+	if f.kind == tsClass && s.memberStart(i) {
+		if next, err := s.classMember(i); err != nil || next > i {
+			return next, err
+		}
+	}
+	if f.kind == tsParams {
+		if next, ok := s.param(i); ok {
+			return next, nil
+		}
+	}
+	if f.decl != bindNone {
+		if next, ok := s.declarator(i); ok {
+			return next, nil
+		}
+	}
+	switch {
+	case t.isPunct("(", "[", "{"):
+		s.push(i)
+		return i + 1, nil
+	case t.isPunct(")", "]", "}"):
+		return s.pop(i), nil
+	case t.kind == tokIdent && !s.tok(i-1).isPunct("."):
+		return s.keyword(i)
+	case t.isPunct("<"):
+		return s.typeArguments(i), nil
+	case t.isPunct("!"):
+		// non-null assertion
+		if !t.nl && s.afterOperand(i) && !(s.tok(i+1).isPunct("=") && s.tok(i+1).start == t.end) {
+			s.blank(i, i+1)
+		}
+	}
+	return i + 1, nil
+}
+
+func (s *tsStripper) push(i int) {
+	t := s.toks[i]
+	parent := s.top()
+	fr := tsFrame{kind: tsBrace, open: i, sigStart: -1}
+	if t.isPunct("[") {
+		fr.kind = tsBracket
+	}
+	switch {
+	case parent.decl == bindName || parent.kind == tsParams && parent.param == bindName:
+		fr.pattern = true
+	case t.isPunct("("):
+		fr.kind = tsParen
+		if s.nextParams != nil {
+			fr.kind, fr.sigStart, fr.ctor = tsParams, s.nextParams.sigStart, s.nextParams.ctor
+			s.nextParams = nil
+		} else if s.isParams(i) {
+			fr.kind = tsParams
+		} else if prev := s.tok(i - 1); prev.kind == tokIdent {
+			switch prev.text {
+			case "if", "for", "while", "with", "switch":
+				fr.ctrl = true
+			}
+		}
+		if fr.kind == tsParams {
+			fr.param = bindName
+		}
+	case t.isPunct("{"):
+		if s.nextClass {
+			fr.kind = tsClass
+			s.nextClass = false
+		}
+		if s.pendingProps != nil {
+			s.assignProps(i, s.pendingProps)
+			s.pendingProps = nil
+		}
+	}
+	s.frames = append(s.frames, fr)
+}
+
+func (s *tsStripper) pop(i int) int {
+	if len(s.frames) == 1 {
+		return i + 1
+	}
+	fr := s.frames[len(s.frames)-1]
+	s.frames = s.frames[:len(s.frames)-1]
+	parent := s.top()
+	if fr.pattern {
+		if parent.decl == bindName {
+			parent.decl = bindAfter
+		} else if parent.kind == tsParams && parent.param == bindName {
+			parent.param = bindAfter
+		}
+	}
+	if fr.ctrl {
+		s.ctrlClose = i
+	}
+	if fr.kind == tsParams {
+		return s.afterParams(i, fr)
+	}
+	return i + 1
+}
+
+// afterParams strips the return type after the parameters closed at toks[i],
+// and removes the signatures that have no body.
+func (s *tsStripper) afterParams(i int, fr tsFrame) int {
+	j := i + 1
+	if s.tok(j).isPunct(":") {
+		k := s.skipType(j + 1)
+		s.blank(j, k)
+		j = k
+	}
+	if fr.sigStart >= 0 && !s.tok(j).isPunct("{") {
+		// overload signature or abstract method
+		if s.tok(j).isPunct(";") {
+			j++
+		}
+		s.blankFrom(fr.sigStart, j)
+		return j
+	}
+	if fr.ctor && len(fr.props) > 0 && s.tok(j).isPunct("{") {
+		s.pendingProps = fr.props
+	}
+	return j
+}
+
+// assignProps inserts the assignments of the parameter properties into the constructor body
+// opening at toks[i], after the super() call if there is one.
+func (s *tsStripper) assignProps(i int, props []string) {
+	var sb strings.Builder
+	for _, p := range props {
+		fmt.Fprintf(&sb, " this.%s = %s;", p, p)
+	}
+	at := s.toks[i].end
+	end := s.match[i]
+	for j := i + 1; j < end; j++ {
+		t := s.toks[j]
+		if t.isPunct("(", "[", "{") && s.match[j] > j {
+			j = s.match[j]
+			continue
+		}
+		if t.kind == tokIdent && t.text == "super" && s.tok(j+1).isPunct("(") && s.match[j+1] > 0 {
+			k := s.match[j+1]
+			if s.tok(k + 1).isPunct(";") {
+				k++
+			}
+			at = s.toks[k].end
+			break
+		}
+	}
+	s.edit(at, at, sb.String())
+}
+
+// param handles the tokens of a parameter list; ok is false if toks[i] is handled as usual.
+func (s *tsStripper) param(i int) (int, bool) {
+	f := s.top()
+	t := s.toks[i]
+	switch f.param {
+	case bindName:
+		switch {
+		case t.kind == tokIdent && isParamModifier(t.text) && s.startsBinding(i+1):
+			s.blank(i, i+1)
+			f.propNext = true
+			return i + 1, true
+		case t.kind == tokIdent && t.text == "this" && s.tok(i+1).isPunct(":"):
+			j := s.skipType(i + 2)
+			if s.tok(j).isPunct(",") {
+				j++
+			}
+			s.blank(i, j)
+			return j, true
+		case t.isPunct("."):
+			return i + 1, true
+		case t.kind == tokIdent:
+			if f.propNext && f.ctor {
+				f.props = append(f.props, t.text)
+			}
+			f.propNext = false
+			f.param = bindAfter
+			return i + 1, true
+		}
+	case bindAfter:
+		switch {
+		case t.isPunct("?"):
+			s.blank(i, i+1)
+			return i + 1, true
+		case t.isPunct(":"):
+			j := s.skipType(i + 1)
+			s.blank(i, j)
+			return j, true
+		case t.isPunct("="):
+			f.param = bindInit
+			return i + 1, true
+		}
+	}
+	if t.isPunct(",") {
+		f.param = bindName
+		return i + 1, true
+	}
+	return i, false
+}
+
+// declarator handles the tokens of variable declarators; ok is false if toks[i] is handled as usual.
+func (s *tsStripper) declarator(i int) (int, bool) {
+	f := s.top()
+	t := s.toks[i]
+	switch f.decl {
+	case bindName:
+		if t.kind == tokIdent {
+			f.decl = bindAfter
+			return i + 1, true
+		}
+		if !t.isPunct("{", "[") {
+			f.decl = bindNone
+		}
+	case bindAfter:
+		switch {
+		case t.isPunct("!"):
+			// definite assignment
+			s.blank(i, i+1)
+			return i + 1, true
+		case t.isPunct(":"):
+			j := s.skipType(i + 1)
+			s.blank(i, j)
+			return j, true
+		case t.isPunct("="):
+			f.decl = bindInit
+			return i + 1, true
+		case t.isPunct(","):
+			f.decl = bindName
+			return i + 1, true
+		}
+		f.decl = bindNone
+	case bindInit:
+		switch {
+		case t.isPunct(","):
+			f.decl = bindName
+			return i + 1, true
+		case t.isPunct(";"), t.nl && s.tok(i-1).endsStatement() && !t.continuesExpression():
+			f.decl = bindNone
+		}
+	}
+	return i, false
+}
+
+// keyword handles the identifier toks[i].
+func (s *tsStripper) keyword(i int) (int, error) {
+	t := s.toks[i]
+	next := s.tok(i + 1)
+	switch t.text {
+	case "let", "var", "const":
+		if t.text == "const" && next.text == "enum" && s.tok(i+2).kind == tokIdent && s.tok(i+3).isPunct("{") {
+			s.blank(i, i+1)
+			return s.enumDecl(i + 1)
+		}
+		s.top().decl = bindName
+	case "function":
+		return s.function(i), nil
+	case "class":
+		return s.classHead(i), nil
+	case "as", "satisfies":
+		if !t.nl && s.afterOperand(i) {
+			if j := s.skipType(i + 1); j > i+1 {
+				s.blank(i, j)
+				return j, nil
+			}
+		}
+	}
+	if !s.atStatementStart(i) || s.top().kind != tsBrace || next.kind != tokIdent && next.kind != tokString && !next.isPunct("{", "*", "=") {
+		return i + 1, nil
+	}
+	switch t.text {
+	case "import":
+		return s.importDecl(i), nil
+	case "export":
+		return s.exportDecl(i), nil
+	case "interface":
+		if next.kind == tokIdent {
+			j := i + 2
+			for j < len(s.toks) && !s.toks[j].isPunct("{") {
+				j = s.skipTypeToken(j)
+			}
+			if j < len(s.toks) && s.match[j] > 0 {
+				j = s.match[j] + 1
+			}
+			s.blankFrom(s.declStart(i), j)
+			return j, nil
+		}
+	case "type":
+		if after := s.tok(i + 2); next.kind == tokIdent && after.isPunct("=", "<") && !next.nl {
+			j := i + 2
+			if after.isPunct("<") {
+				if j = s.skipAngle(j, false); j < 0 {
+					return i + 1, nil
+				}
+			}
+			if !s.tok(j).isPunct("=") {
+				return i + 1, nil
+			}
+			j = s.skipType(j + 1)
+			if s.tok(j).isPunct(";") {
+				j++
+			}
+			s.blankFrom(s.declStart(i), j)
+			return j, nil
+		}
+	case "declare":
+		if !next.nl && next.kind == tokIdent {
+			j := s.statementEnd(i + 1)
+			s.blankFrom(s.declStart(i), j)
+			return j, nil
+		}
+	case "abstract":
+		if next.text == "class" {
+			s.blank(i, i+1)
+		}
+	case "enum":
+		if next.kind == tokIdent && s.tok(i+2).isPunct("{") {
+			return s.enumDecl(i)
+		}
+	case "namespace", "module":
+		if !next.nl && (next.kind == tokIdent || next.kind == tokString) {
+			return i, fmt.Errorf("line %d: namespaces are not supported", s.line(i))
+		}
+	}
+	return i + 1, nil
+}
+
+// function handles the function keyword at toks[i] and returns the index of its parameters.
+func (s *tsStripper) function(i int) int {
+	sigStart := -1
+	if start := s.declStart(i); s.atStatementStart(start) && s.top().kind != tsParen {
+		sigStart = start
+	}
+	j := i + 1
+	if s.tok(j).isPunct("*") {
+		j++
+	}
+	if s.tok(j).kind == tokIdent {
+		j++
+	}
+	if s.tok(j).isPunct("<") {
+		if k := s.skipAngle(j, false); k > 0 {
+			s.blank(j, k)
+			j = k
+		}
+	}
+	if s.tok(j).isPunct("(") {
+		s.nextParams = &tsParamsInfo{sigStart: sigStart}
+	}
+	return j
+}
+
+// classHead strips the type parameters and the implements clause of the class at toks[i].
+func (s *tsStripper) classHead(i int) int {
+	j := i + 1
+	if t := s.tok(j); t.kind == tokIdent && t.text != "extends" && t.text != "implements" {
+		j++
+	}
+	if s.tok(j).isPunct("<") {
+		if k := s.skipAngle(j, false); k > 0 {
+			s.blank(j, k)
+			j = k
+		}
+	}
+	if s.tok(j).text == "extends" {
+		for j++; j < len(s.toks); {
+			t := s.toks[j]
+			if t.isPunct("{") || t.text == "implements" {
+				break
+			}
+			if t.isPunct("<") {
+				if k := s.skipAngle(j, false); k > 0 {
+					s.blank(j, k)
+					j = k
+					continue
+				}
+			}
+			if t.isPunct("(", "[") && s.match[j] > j {
+				j = s.match[j]
+			}
+			j++
+		}
+	}
+	if s.tok(j).text == "implements" {
+		k := j + 1
+		for k < len(s.toks) && !s.toks[k].isPunct("{") {
+			k = s.skipTypeToken(k)
+		}
+		s.blank(j, k)
+		j = k
+	}
+	if s.tok(j).isPunct("{") {
+		s.nextClass = true
+	}
+	return j
+}
+
+// memberStart reports whether toks[i] starts a class member.
+func (s *tsStripper) memberStart(i int) bool {
+	t := s.toks[i]
+	if t.isPunct(";", "}") {
+		return false
+	}
+	prev := s.tok(i - 1)
+	if i-1 == s.top().open || prev.isPunct(";", "}") {
+		return true
+	}
+	return t.nl && prev.endsStatement() && !t.continuesExpression()
+}
+
+// classMember handles the class member starting at toks[i].
+func (s *tsStripper) classMember(i int) (int, error) {
+	start := i
+	if s.tok(i).isPunct("[") && s.tok(i+1).kind == tokIdent && s.tok(i+2).isPunct(":") {
+		// index signature
+		j := s.statementEnd(i)
+		s.blank(i, j)
+		return j, nil
+	}
+	remove := false
+	for {
+		t := s.tok(i)
+		if t.kind != tokIdent || !s.isModifier(i) {
+			break
+		}
+		switch t.text {
+		case "public", "private", "protected", "readonly", "override":
+			s.blank(i, i+1)
+		case "abstract", "declare":
+			remove = true
+		}
+		i++
+	}
+	if remove {
+		j := s.statementEnd(start)
+		s.blankFrom(start, j)
+		return j, nil
+	}
+	if s.tok(i).isPunct("*") {
+		i++
+	}
+	name := s.tok(i)
+	switch {
+	case name.isPunct("[") && s.match[i] > i:
+		i = s.match[i] + 1
+	case name.kind == tokIdent || name.kind == tokString || name.kind == tokNumber:
+		i++
+	default:
+		return i, nil
+	}
+	if s.tok(i).isPunct("?", "!") {
+		s.blank(i, i+1)
+		i++
+	}
+	if s.tok(i).isPunct("<") {
+		if k := s.skipAngle(i, false); k > 0 {
+			s.blank(i, k)
+			i = k
+		}
+	}
+	switch {
+	case s.tok(i).isPunct("("):
+		s.nextParams = &tsParamsInfo{sigStart: start, ctor: name.text == "constructor"}
+	case s.tok(i).isPunct(":"):
+		j := s.skipType(i + 1)
+		s.blank(i, j)
+		i = j
+	}
+	return i, nil
+}
+
+// isModifier reports whether the identifier toks[i] is a modifier of a class member, not its name.
+func (s *tsStripper) isModifier(i int) bool {
+	switch s.toks[i].text {
+	case "public", "private", "protected", "readonly", "override", "abstract", "declare",
+		"static", "async", "get", "set", "accessor":
+	default:
+		return false
+	}
+	next := s.tok(i + 1)
+	if next.nl {
+		return false
+	}
+	return next.kind == tokIdent || next.kind == tokString || next.kind == tokNumber || next.isPunct("[", "*")
+}
+
+// importDecl handles the import declaration at toks[i].
+func (s *tsStripper) importDecl(i int) int {
+	next, after := s.tok(i+1), s.tok(i+2)
+	switch {
+	case next.text == "type" && (after.isPunct("{", "*") || after.kind == tokIdent && after.text != "from"):
+		// import type ...
+		j := s.moduleDeclEnd(i)
+		s.blankFrom(i, j)
+		return j
+	case next.kind == tokIdent && after.isPunct("="):
+		// import x = require("x")
+		s.edit(s.toks[i].start, s.toks[i].end, "const")
+		return i + 1
+	}
+	return s.moduleDeclEnd(i)
+}
+
+// exportDecl handles the export declaration at toks[i].
+func (s *tsStripper) exportDecl(i int) int {
+	next, after := s.tok(i+1), s.tok(i+2)
+	switch {
+	case next.text == "type" && after.isPunct("{", "*"):
+		// export type { ... }
+		j := s.moduleDeclEnd(i)
+		s.blankFrom(i, j)
+		return j
+	case next.text == "as" && after.text == "namespace":
+		j := s.statementEnd(i)
+		s.blankFrom(i, j)
+		return j
+	case next.isPunct("="):
+		// export = x
+		s.edit(s.toks[i].start, next.end, "module.exports =")
+		return i + 2
+	case next.isPunct("{", "*"):
+		return s.moduleDeclEnd(i)
+	}
+	return i + 1
+}
+
+// moduleDeclEnd returns the index after the import or export declaration at toks[i],
+// removing the type-only specifiers on the way.
+func (s *tsStripper) moduleDeclEnd(i int) int {
+	for j := i + 1; j < len(s.toks); j++ {
+		t := s.toks[j]
+		switch {
+		case t.kind == tokString:
+			if s.tok(j + 1).isPunct(";") {
+				j++
+			}
+			return j + 1
+		case t.isPunct("{"):
+			end := s.match[j]
+			if end < 0 {
+				return len(s.toks)
+			}
+			s.typeSpecifiers(j+1, end)
+			if s.tok(end+1).text != "from" {
+				if s.tok(end + 1).isPunct(";") {
+					end++
+				}
+				return end + 1
+			}
+			j = end
+		case t.isPunct(";"):
+			return j + 1
+		}
+	}
+	return len(s.toks)
+}
+
+// typeSpecifiers removes the "type Name [as Alias]," specifiers in toks[i:end].
+func (s *tsStripper) typeSpecifiers(i, end int) {
+	for i < end {
+		j := i
+		for j < end && !s.toks[j].isPunct(",") {
+			j++
+		}
+		if s.toks[i].text == "type" && j-i > 1 {
+			if j < end {
+				j++
+			}
+			s.blank(i, j)
+		}
+		i = j + 1
+	}
+}
+
+// enumDecl rewrites the enum declaration at toks[i] into a function building the enum object.
+func (s *tsStripper) enumDecl(i int) (int, error) {
+	name := s.toks[i+1].text
+	open := i + 2
+	end := s.match[open]
+	if end < 0 {
+		return i, fmt.Errorf("line %d: unterminated enum %s", s.line(i), name)
+	}
+	s.edit(s.toks[i].start, s.toks[open].end, fmt.Sprintf(
+		`var %[1]s = (function (%[1]s) { let __jsh_ev = -1; const __jsh_es = (k, v) => { %[1]s[k] = v; if (typeof v !== "string") { %[1]s[v] = k; } return v; };%[2]s`,
+		name, strings.Repeat("\n", bytes.Count(s.src[s.toks[i].start:s.toks[open].end], []byte("\n")))))
+	for j := open + 1; j < end; {
+		m := s.toks[j]
+		if m.isPunct(",") {
+			s.blank(j, j+1)
+			j++
+			continue
+		}
+		key := m.text
+		if m.kind == tokString {
+			key, _ = strconv.Unquote(key)
+		}
+		decl := ""
+		if isJSIdent(key) {
+			decl = "const " + key + " = "
+		}
+		if s.tok(j + 1).isPunct("=") {
+			k := j + 2
+			for k < end && !s.toks[k].isPunct(",") {
+				if s.match[k] > k {
+					k = s.match[k]
+				}
+				k++
+			}
+			s.edit(m.start, s.toks[j+1].end, fmt.Sprintf("%s__jsh_ev = __jsh_es(%s, (", decl, strconv.Quote(key)))
+			s.edit(s.toks[k-1].end, s.toks[k-1].end, "));")
+			j = k
+		} else {
+			s.edit(m.start, m.end, fmt.Sprintf("%s__jsh_ev = __jsh_es(%s, __jsh_ev + 1);", decl, strconv.Quote(key)))
+			j++
+		}
+	}
+	s.edit(s.toks[end].start, s.toks[end].end, fmt.Sprintf("return %[1]s; })(%[1]s || {});", name))
+	return end + 1, nil
+}
+
+// typeArguments strips the type arguments or the type assertion starting at toks[i].
+func (s *tsStripper) typeArguments(i int) int {
+	if s.operandExpected(i) {
+		// <T>expr or <T>(x: T) => x
+		if j := s.skipAngle(i, true); j > 0 {
+			s.blank(i, j)
+			return j
+		}
+		return i + 1
+	}
+	if prev := s.tok(i - 1); prev.kind == tokIdent && !regexpPrecedingKeywords[prev.text] {
+		// f<T>(x), new C<T>()
+		if j := s.skipAngle(i, true); j > 0 {
+			if t := s.tok(j); !t.nl && (t.isPunct("(") || t.kind == tokTemplate) {
+				s.blank(i, j)
+				return j
+			}
+		}
+	}
+	return i + 1
+}
+
+// isParams reports whether the parenthesis at toks[i] opens the parameters of an arrow
+// function or a method, or a catch clause.
+func (s *tsStripper) isParams(i int) bool {
+	end := s.match[i]
+	if end < 0 {
+		return false
+	}
+	if s.isArrow(end + 1) {
+		return true
+	}
+	if s.tok(i-1).text == "catch" {
+		return true
+	}
+	method := s.isMethodName(i - 1)
+	switch after := s.tok(end + 1); {
+	case after.isPunct(":"):
+		k := s.skipType(end + 2)
+		return s.isArrow(k) || method && s.tok(k).isPunct("{")
+	case after.isPunct("{"):
+		return method
+	}
+	return false
+}
+
+// isMethodName reports whether toks[i] is the name of a method in an object literal.
+func (s *tsStripper) isMethodName(i int) bool {
+	t := s.tok(i)
+	if t.kind != tokIdent && t.kind != tokString && t.kind != tokNumber {
+		return false
+	}
+	switch t.text {
+	case "if", "for", "while", "with", "switch", "catch", "function", "return", "typeof":
+		return false
+	}
+	prev := s.tok(i - 1)
+	if prev.kind == tokIdent {
+		switch prev.text {
+		case "get", "set", "async", "static":
+			return true
+		}
+	}
+	return prev.isPunct("{", ",", "*")
+}
+
+// afterTemplate returns the index after the template at toks[i] and its substitutions.
+func (s *tsStripper) afterTemplate(i int) int {
+	end := s.toks[i].end
+	for i++; i < len(s.toks) && s.toks[i].start < end; i++ {
+	}
+	return i
+}
+
+func (s *tsStripper) isArrow(i int) bool {
+	return s.tok(i).isPunct("=") && s.tok(i+1).isPunct(">") && s.toks[i].end == s.toks[i+1].start
+}
+
+// afterOperand reports whether toks[i] follows an operand, for postfix operators.
+func (s *tsStripper) afterOperand(i int) bool {
+	prev := s.tok(i - 1)
+	if i == 0 || !prev.endsStatement() || prev.isPunct("}") && !s.objectLiteralEnd(i-1) || i-1 == s.ctrlClose {
+		return false
+	}
+	return prev.kind != tokIdent || !regexpPrecedingKeywords[prev.text] && prev.text != "else"
+}
+
+// objectLiteralEnd reports whether toks[i] is the "}" of an object literal, not of a block
+// or a function body, like in "{ a: 1 } as P".
+func (s *tsStripper) objectLiteralEnd(i int) bool {
+	open := s.match[i]
+	if open < 0 || s.atStatementStart(open) || s.isArrow(open-2) || !s.operandExpected(open) {
+		return false
+	}
+	prev := s.tok(open - 1)
+	return prev.kind != tokIdent || prev.text != "do" && prev.text != "else"
+}
+
+// operandExpected reports whether an operand is expected at toks[i].
+func (s *tsStripper) operandExpected(i int) bool {
+	if i == 0 {
+		return true
+	}
+	prev := s.toks[i-1]
+	switch prev.kind {
+	case tokIdent:
+		return regexpPrecedingKeywords[prev.text]
+	case tokPunct:
+		if prev.isPunct("+", "-") && s.tok(i-2).isPunct(prev.text) && s.toks[i-2].end == prev.start {
+			return false // x++ < y
+		}
+		return !prev.isPunct(")", "]", "}")
+	}
+	return false
+}
+
+// atStatementStart reports whether toks[i] may start a statement.
+func (s *tsStripper) atStatementStart(i int) bool {
+	if i == 0 {
+		return true
+	}
+	prev := s.toks[i-1]
+	if prev.isPunct(";", "{", "}") {
+		return true
+	}
+	if prev.kind == tokIdent && (prev.text == "export" || prev.text == "default" || prev.text == "declare") {
+		return true
+	}
+	return s.toks[i].nl && prev.endsStatement()
+}
+
+// declStart returns the index of the export, default, declare or async keywords before toks[i].
+func (s *tsStripper) declStart(i int) int {
+	for i > 0 {
+		switch s.toks[i-1].text {
+		case "export", "default", "declare", "async":
+			if s.toks[i-1].kind == tokIdent {
+				i--
+				continue
+			}
+		}
+		break
+	}
+	return i
+}
+
+// statementEnd returns the index after the declaration statement starting at toks[i].
+func (s *tsStripper) statementEnd(i int) int {
+	for j := i; j < len(s.toks); {
+		t := s.toks[j]
+		if j > i && t.nl && s.toks[j-1].endsStatement() && !t.continuesExpression() {
+			return j
+		}
+		switch {
+		case t.isPunct(";"):
+			return j + 1
+		case t.isPunct(")", "]", "}"):
+			return j
+		case t.isPunct("{"):
+			if s.match[j] < 0 {
+				return len(s.toks)
+			}
+			j = s.match[j] + 1
+			if next := s.tok(j); next.nl || !next.isPunct("[", "|", "&", ".") {
+				if next.isPunct(";") {
+					j++
+				}
+				return j
+			}
+			continue
+		case t.isPunct("(", "["):
+			if s.match[j] < 0 {
+				return len(s.toks)
+			}
+			j = s.match[j]
+		}
+		j++
+	}
+	return len(s.toks)
+}
+
+// skipType returns the index of the token after the type starting at toks[i].
+func (s *tsStripper) skipType(i int) int {
+	operand := true
+	extends, cond := 0, 0
+	for i < len(s.toks) {
+		t := s.toks[i]
+		if operand {
+			switch {
+			case t.isPunct("|", "&", "-"):
+				i++
+			case t.isPunct("(", "[", "{"):
+				if s.match[i] < 0 {
+					return len(s.toks)
+				}
+				i = s.match[i] + 1
+				operand = false
+				if t.isPunct("(") && s.isArrow(i) {
+					i += 2
+					operand = true
+				}
+			case t.isPunct("<"):
+				j := s.skipAngle(i, false)
+				if j < 0 {
+					return i
+				}
+				i = j
+			case t.kind == tokIdent:
+				i++
+				switch t.text {
+				case "typeof", "keyof", "readonly", "unique", "infer", "asserts", "new", "abstract":
+				case "import":
+					if s.tok(i).isPunct("(") && s.match[i] > i {
+						i = s.match[i] + 1
+					}
+					operand = false
+				default:
+					operand = false
+				}
+			case t.kind == tokString || t.kind == tokNumber:
+				i++
+				operand = false
+			case t.kind == tokTemplate:
+				i = s.afterTemplate(i)
+				operand = false
+			default:
+				return i
+			}
+			continue
+		}
+		switch {
+		case t.isPunct("|", "&") && !(s.tok(i+1).isPunct(t.text) && s.toks[i+1].start == t.end):
+			operand = true
+		case t.isPunct(".") && !t.nl:
+			operand = true
+		case t.isPunct("[") && !t.nl:
+			if s.match[i] < 0 {
+				return len(s.toks)
+			}
+			i = s.match[i]
+		case t.isPunct("<") && !t.nl:
+			j := s.skipAngle(i, false)
+			if j < 0 {
+				return i
+			}
+			i = j - 1
+		case t.kind == tokIdent && t.text == "extends":
+			operand = true
+			extends++
+		case t.kind == tokIdent && t.text == "is":
+			operand = true
+		case t.isPunct("?") && extends > 0:
+			operand = true
+			extends--
+			cond++
+		case t.isPunct(":") && cond > 0:
+			operand = true
+			cond--
+		default:
+			return i
+		}
+		i++
+	}
+	return i
+}
+
+// skipTypeToken returns the index after the token of a type at toks[i],
+// skipping type arguments and bracket groups as a whole.
+func (s *tsStripper) skipTypeToken(i int) int {
+	t := s.toks[i]
+	if t.isPunct("<") {
+		if j := s.skipAngle(i, false); j > 0 {
+			return j
+		}
+	}
+	if t.isPunct("(", "[") && s.match[i] > i {
+		return s.match[i] + 1
+	}
+	return i + 1
+}
+
+// skipAngle returns the index after the type parameters or arguments starting at toks[i],
+// or -1 if they are not. strict rejects the operators that are not used in types,
+// so that comparisons are not taken for type arguments.
+func (s *tsStripper) skipAngle(i int, strict bool) int {
+	depth := 0
+	for ; i < len(s.toks); i++ {
+		t := s.toks[i]
+		switch {
+		case t.isPunct("<"):
+			depth++
+		case t.isPunct(">"):
+			if s.isArrow(i - 1) {
+				continue
+			}
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		case t.isPunct("(", "[", "{"):
+			if s.match[i] < 0 {
+				return -1
+			}
+			i = s.match[i]
+		case t.isPunct(";", ")", "]", "}"), t.kind == tokRegExp:
+			return -1
+		case strict && t.kind == tokPunct:
+			next := s.tok(i + 1)
+			adjacent := next.start == t.end
+			switch t.text {
+			case "+", "*", "/", "%", "!", "^", "~":
+				return -1
+			case "=":
+				if !next.isPunct(">") || !adjacent {
+					return -1
+				}
+			case "-":
+				if next.kind != tokNumber {
+					return -1
+				}
+			case "&", "|":
+				if next.isPunct(t.text) && adjacent {
+					return -1
+				}
+			}
+		}
+	}
+	return -1
+}
+
+// startsBinding reports whether toks[i] starts a parameter name or a parameter property modifier.
+func (s *tsStripper) startsBinding(i int) bool {
+	t := s.tok(i)
+	return !t.nl && (t.kind == tokIdent || t.isPunct("{", "["))
+}
+
+func isParamModifier(name string) bool {
+	switch name {
+	case "public", "private", "protected", "readonly", "override":
+		return true
+	}
+	return false
+}
+
+func (s *tsStripper) edit(start, end int, text string) {
+	s.edits = append(s.edits, esmEdit{start: start, end: end, text: text})
+}
+
+// blank replaces the tokens toks[i:j] with spaces, keeping the line breaks.
+func (s *tsStripper) blank(i, j int) {
+	if j <= i {
+		return
+	}
+	start, end := s.toks[i].start, s.toks[j-1].end
+	for _, t := range s.toks[i:j] {
+		end = max(end, t.end) // templates end after their substitutions
+	}
+	b := []byte(string(s.src[start:end]))
+	for k, c := range b {
+		if c != '\n' && c != '\r' {
+			b[k] = ' '
+		}
+	}
+	s.edit(start, end, string(b))
+}
+
+// blankFrom blanks toks[i:j], replacing the edits made in it so far.
+func (s *tsStripper) blankFrom(i, j int) {
+	if j <= i {
+		return
+	}
+	start := s.toks[i].start
+	s.edits = slices.DeleteFunc(s.edits, func(e esmEdit) bool { return e.start >= start })
+	s.blank(i, j)
+}
+
+func (s *tsStripper) line(i int) int {
+	return bytes.Count(s.src[:s.toks[i].start], []byte("\n")) + 1
+}
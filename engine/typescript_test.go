@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"testing"
+)
+
+func TestTypeScript(t *testing.T) {
+	tests := []TestCase{
+		{
+			name: "ts_require",
+			script: `
+				const { Hello, Level, sum } = require("/work/ts/lib.ts");
+				console.println(new Hello("Hi").greet("TS"));
+				console.println(Level.Low, Level.High, Level[2]);
+				console.println(sum(1, 2, 3, 4));
+			`,
+			output: []string{
+				"Hi TS from lib.ts!",
+				"1 3 Mid",
+				"10",
+			},
+		},
+		{
+			name: "ts_stack_trace",
+			script: `
+				const { where } = require("/work/ts/lib");
+				console.println(where().match(/at where \((.*?)\(/)[1]);
+			`,
+			output: []string{
+				"/work/ts/lib:20:24",
+			},
+		},
+		{
+			name: "ts_object_assertions.ts",
+			script: `
+				interface P { a: number; b?: string }
+				const o = { a: 1 } as P;
+				const s = { a: 2, b: "x" } satisfies P;
+				const c = ({ a: 3 }) as const;
+				console.println(o.a, s.a, s.b, c.a);
+			`,
+			output: []string{
+				"1 2 x 3",
+			},
+		},
+		{
+			name: "ts_inline.ts",
+			script: `
+				interface Point { x: number; y: number }
+				const p: Point = { x: 3, y: 4 };
+				function length({ x, y }: Point): number {
+					return Math.sqrt(x * x + y * y);
+				}
+				console.println(length(p as Point));
+			`,
+			output: []string{
+				"5",
+			},
+		},
+	}
+	for _, tc := range tests {
+		RunTest(t, tc)
+	}
+}
+
+func TestStripTypes(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{
+			src:  `let x: number = 1;`,
+			want: `let x         = 1;`,
+		},
+		{
+			src:  "type A = string;\nconst a = 1;",
+			want: "                \nconst a = 1;",
+		},
+		{
+			src:  "function f<T>(a: T, b?: string): T {\n  return a!;\n}",
+			want: "function f   (a   , b         )    {\n  return a ;\n}",
+		},
+		{
+			src:  `const v = (x as any).y satisfies number;`,
+			want: `const v = (x       ).y                 ;`,
+		},
+		{
+			src:  `const o = { a: 1 } as P; const s = { a: { b: 2 } } satisfies P;`,
+			want: `const o = { a: 1 }     ; const s = { a: { b: 2 } }            ;`,
+		},
+		{
+			src:  `const c = ({ a: 1 }) as const; f({ a: 1 } as P, [{}] as P[]);`,
+			want: `const c = ({ a: 1 })         ; f({ a: 1 }     , [{}]       );`,
+		},
+		{
+			src:  "if (a) { b(); } !c && d();\ndo { x(); } while (!y);\nconst f = () => { return 1 }",
+			want: "if (a) { b(); } !c && d();\ndo { x(); } while (!y);\nconst f = () => { return 1 }",
+		},
+		{
+			src:  "interface P {\n  x: number;\n}\nexport type { P };",
+			want: "             \n            \n \n                  ",
+		},
+		{
+			src:  `const m = new Map<string, number>(); const c = a < b && c > (d);`,
+			want: `const m = new Map                (); const c = a < b && c > (d);`,
+		},
+		{
+			src:  `class A { constructor(private x: number) { super(); } }`,
+			want: `class A { constructor(        x        ) { super(); this.x = x; } }`,
+		},
+		{
+			src:  "function f(a: string): string;\nfunction f(a: any) { return a; }",
+			want: "                              \nfunction f(a     ) { return a; }",
+		},
+		{
+			src:  `const o = { a: b ? c : d, m(x: number): void {} };`,
+			want: `const o = { a: b ? c : d, m(x        )       {} };`,
+		},
+	}
+	for _, tt := range tests {
+		got, err := StripTypes("test.ts", []byte(tt.src))
+		if err != nil {
+			t.Errorf("StripTypes(%q): %v", tt.src, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("StripTypes(%q)\n got: %q\nwant: %q", tt.src, got, tt.want)
+		}
+	}
+	if _, err := StripTypes("test.ts", []byte("namespace N {}")); err == nil {
+		t.Error("expected an error for namespaces")
+	}
+}
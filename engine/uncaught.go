@@ -0,0 +1,132 @@
+package engine
+
+import (
+	"github.com/dop251/goja"
+)
+
+// The exceptions thrown by the callbacks run from the event loop, and the promises
+// rejected without a handler, are emitted as the 'uncaughtException' and
+// 'unhandledRejection' events of the process object, like Node.js does.
+// Without a listener, the runtime stops with the error and the exit code 1.
+// A callback calling process.exit() stops it with the exit code, like the script does.
+
+// ExitCodeUncaught is the exit code of a script stopped by an uncaught exception.
+const ExitCodeUncaught = 1
+
+// uncaught reports err, thrown by a callback, to the 'uncaughtException' listeners.
+// process.exit() called by the callback stops the runtime with its exit code.
+func (jr *JSRuntime) uncaught(vm *goja.Runtime, err error) {
+	switch e := err.(type) {
+	case *goja.Exception:
+		if !jr.emitProcessEvent(vm, "uncaughtException", errorValue(vm, err), vm.ToValue("uncaughtException")) {
+			jr.fail(vm, err)
+		}
+	case *goja.InterruptedError:
+		// the other interrupts, by the context or the limits, are stopping the runtime already
+		if _, ok := e.Value().(Exit); ok {
+			jr.fail(vm, err)
+		}
+	}
+}
+
+// fail stops the runtime with err, the first exception not handled or process.exit().
+func (jr *JSRuntime) fail(vm *goja.Runtime, err error) {
+	if jr.uncaughtErr == nil {
+		jr.uncaughtErr = err
+	}
+	vm.Interrupt(err)
+	jr.eventLoop.StopNoWait()
+}
+
+// emitProcessEvent emits event with args on the process object, if it has listeners for it.
+// An exception thrown by a listener stops the runtime.
+func (jr *JSRuntime) emitProcessEvent(vm *goja.Runtime, event string, args ...goja.Value) bool {
+	process := jr.processObject(vm)
+	if process == nil {
+		return false
+	}
+	listenerCount, ok := goja.AssertFunction(process.Get("listenerCount"))
+	if !ok {
+		return false
+	}
+	if n, err := listenerCount(process, vm.ToValue(event)); err != nil || n.ToInteger() == 0 {
+		return false
+	}
+	emit, ok := goja.AssertFunction(process.Get("emit"))
+	if !ok {
+		return false
+	}
+	if _, err := emit(process, append([]goja.Value{vm.ToValue(event)}, args...)...); err != nil {
+		if _, ok := err.(*goja.Exception); ok {
+			jr.fail(vm, err)
+		}
+	}
+	return true
+}
+
+// processObject returns the process object of /lib/process, or nil if it is not available.
+func (jr *JSRuntime) processObject(vm *goja.Runtime) *goja.Object {
+	require, ok := goja.AssertFunction(vm.Get("require"))
+	if !ok {
+		return nil
+	}
+	v, err := require(goja.Undefined(), vm.ToValue("/lib/process"))
+	if err != nil {
+		return nil
+	}
+	obj, _ := v.(*goja.Object)
+	return obj
+}
+
+// errorValue returns the value thrown as err.
+func errorValue(vm *goja.Runtime, err error) goja.Value {
+	if ex, ok := err.(*goja.Exception); ok {
+		return ex.Value()
+	}
+	return vm.NewGoError(err)
+}
+
+// trackRejections emits the 'unhandledRejection' events of vm, for the promises that are
+// still rejected without a handler when the jobs pending at the rejection are done.
+func (jr *JSRuntime) trackRejections(vm *goja.Runtime) {
+	setTimeout, _ := goja.AssertFunction(vm.Get("setTimeout"))
+	rejected := []*goja.Promise{}
+	check := vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		promises := rejected
+		rejected = []*goja.Promise{}
+		for _, p := range promises {
+			if p == nil || jr.uncaughtErr != nil {
+				continue
+			}
+			reason := p.Result()
+			if !jr.emitProcessEvent(vm, "unhandledRejection", reason, vm.ToValue(p)) {
+				jr.fail(vm, thrown(vm, reason))
+			}
+		}
+		return goja.Undefined()
+	})
+	vm.SetPromiseRejectionTracker(func(p *goja.Promise, op goja.PromiseRejectionOperation) {
+		switch op {
+		case goja.PromiseRejectionReject:
+			if len(rejected) == 0 && setTimeout != nil {
+				setTimeout(goja.Undefined(), check, vm.ToValue(0))
+			}
+			rejected = append(rejected, p)
+		case goja.PromiseRejectionHandle:
+			for i, r := range rejected {
+				if r == p {
+					rejected[i] = nil
+				}
+			}
+		}
+	})
+}
+
+// thrown returns the exception of throwing v, with the stack of v if it is an Error.
+func thrown(vm *goja.Runtime, v goja.Value) error {
+	throw, _ := goja.AssertFunction(vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		panic(call.Argument(0))
+	}))
+	_, err := throw(goja.Undefined(), v)
+	return err
+}
@@ -0,0 +1,209 @@
+package engine
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestUncaught(t *testing.T) {
+	tests := []TestCase{
+		{
+			name: "uncaught_exception_timer",
+			script: `
+				const process = require("/lib/process");
+				process.on("uncaughtException", (err, origin) => {
+					console.println("caught:", err.message, origin);
+				});
+				setTimeout(() => { throw new Error("boom"); }, 0);
+				setTimeout(() => console.println("still running"), 10);
+			`,
+			output: []string{
+				"caught: boom uncaughtException",
+				"still running",
+			},
+		},
+		{
+			name: "uncaught_exception_main",
+			script: `
+				const process = require("/lib/process");
+				process.on("uncaughtException", (err) => console.println("caught:", err.message));
+				setTimeout(() => console.println("after"), 0);
+				throw new Error("main");
+			`,
+			output: []string{
+				"caught: main",
+				"after",
+			},
+		},
+		{
+			name: "uncaught_exception_event",
+			script: `
+				const process = require("/lib/process");
+				const EventEmitter = require("/lib/events");
+				const ee = new EventEmitter();
+				ee.on("ping", () => { throw new Error("in listener"); });
+				process.on("uncaughtException", (err) => console.println("caught:", err.message));
+				process.dispatchEvent(ee, "ping");
+			`,
+			output: []string{
+				"caught: in listener",
+			},
+		},
+		{
+			name: "uncaught_exception_next_tick",
+			script: `
+				const process = require("/lib/process");
+				process.on("uncaughtException", (err) => console.println("caught:", err));
+				process.nextTick(() => { throw "tick"; });
+			`,
+			output: []string{
+				"caught: tick",
+			},
+		},
+		{
+			name: "unhandled_rejection",
+			script: `
+				const process = require("/lib/process");
+				process.on("unhandledRejection", (reason, promise) => {
+					console.println("unhandled:", reason.message, promise instanceof Promise);
+				});
+				Promise.reject(new Error("nope"));
+				Promise.reject(new Error("handled")).catch(() => {});
+				const late = Promise.reject(new Error("late"));
+				Promise.resolve().then(() => late.catch(() => {}));
+				(async () => { throw new Error("async"); })();
+			`,
+			output: []string{
+				"unhandled: nope true",
+				"unhandled: async true",
+			},
+		},
+	}
+	for _, tc := range tests {
+		RunTest(t, tc)
+	}
+}
+
+func TestUncaughtExit(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		output []string
+	}{
+		{
+			name: "uncaught_timer",
+			script: `
+				function fail() { throw new Error("boom"); }
+				setTimeout(fail, 0);
+				setTimeout(() => console.println("not reached"), 50);
+			`,
+			output: []string{
+				"runtime error: Error: boom",
+				"\tat fail (uncaught_timer:2:29(3))",
+			},
+		},
+		{
+			name: "unhandled_rejection",
+			script: `
+				async function fail() { throw new Error("rejected"); }
+				fail();
+				setTimeout(() => console.println("not reached"), 50);
+			`,
+			output: []string{
+				"runtime error: Error: rejected",
+				"\tat fail (unhandled_rejection:2:35(3))",
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			hooked := false
+			conf := Config{
+				Name:   tc.name,
+				Code:   tc.script,
+				Reader: &bytes.Buffer{},
+				Writer: &bytes.Buffer{},
+			}
+			jr, err := New(conf)
+			if err != nil {
+				t.Fatalf("Failed to create JSRuntime: %v", err)
+			}
+			jr.AddShutdownHook(func() { hooked = true })
+			if code := jr.Main(); code != ExitCodeUncaught {
+				t.Errorf("Expected exit code %d, got %d", ExitCodeUncaught, code)
+			}
+			if !hooked {
+				t.Error("Expected the shutdown hook to run")
+			}
+			lines := strings.Split(conf.Writer.(*bytes.Buffer).String(), "\n")
+			if len(lines) < len(tc.output) {
+				t.Fatalf("Expected at least %d lines, got %q", len(tc.output), lines)
+			}
+			for i, want := range tc.output {
+				if lines[i] != want {
+					t.Errorf("Line %d: expected %q, got %q", i, want, lines[i])
+				}
+			}
+		})
+	}
+}
+
+func TestUncaughtProcessExit(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+	}{
+		{
+			name:   "exit_in_timer",
+			script: `setTimeout(() => { console.println("exiting"); process.exit(3); }, 10);`,
+		},
+		{
+			name:   "exit_in_interval",
+			script: `setInterval(() => { console.println("exiting"); process.exit(3); }, 10);`,
+		},
+		{
+			name:   "exit_in_next_tick",
+			script: `process.nextTick(() => { console.println("exiting"); process.exit(3); });`,
+		},
+		{
+			name: "exit_in_listener",
+			script: `
+				const EventEmitter = require("/lib/events");
+				const ee = new EventEmitter();
+				ee.on("ping", () => { console.println("exiting"); process.exit(3); });
+				process.dispatchEvent(ee, "ping");
+			`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			hooked := false
+			conf := Config{
+				Name: tc.name,
+				Code: `
+					const process = require("/lib/process");
+					setTimeout(() => console.println("not reached"), 1000);
+				` + tc.script,
+				FSTabs: []FSTab{{MountPoint: "/", Source: "../native/root/"}},
+				Reader: &bytes.Buffer{},
+				Writer: &bytes.Buffer{},
+			}
+			jr, err := New(conf)
+			if err != nil {
+				t.Fatalf("Failed to create JSRuntime: %v", err)
+			}
+			jr.RegisterNativeModule("@jsh/process", jr.Process)
+			jr.AddShutdownHook(func() { hooked = true })
+			if code := jr.Main(); code != 3 {
+				t.Errorf("Expected exit code 3, got %d", code)
+			}
+			if !hooked {
+				t.Error("Expected the shutdown hook to run")
+			}
+			if got := conf.Writer.(*bytes.Buffer).String(); got != "exiting\n" {
+				t.Errorf("Unexpected output %q", got)
+			}
+		})
+	}
+}
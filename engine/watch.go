@@ -0,0 +1,173 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"sort"
+	"sync"
+	"time"
+)
+
+// WatchInterval is how often the watch mode checks the files loaded by the script.
+var WatchInterval = 500 * time.Millisecond
+
+// watchSet is the files loaded by a script in watch mode,
+// with the modification time and the size they had when loaded.
+type watchSet struct {
+	mu    sync.Mutex
+	files map[string]watchStamp
+}
+
+type watchStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func newWatchSet() *watchSet {
+	return &watchSet{files: map[string]watchStamp{}}
+}
+
+// add records file of fileSystem, unless it is already recorded.
+func (ws *watchSet) add(fileSystem fs.FS, file string) {
+	fi, err := fs.Stat(fileSystem, file)
+	if err != nil {
+		return
+	}
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if _, ok := ws.files[file]; !ok {
+		ws.files[file] = watchStamp{modTime: fi.ModTime(), size: fi.Size()}
+	}
+}
+
+// changed returns a file modified or removed since it was recorded,
+// and records its current state so that it is reported once per change.
+func (ws *watchSet) changed(fileSystem fs.FS) (string, bool) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	files := make([]string, 0, len(ws.files))
+	for file := range ws.files {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		var stamp watchStamp
+		if fi, err := fs.Stat(fileSystem, file); err == nil {
+			stamp = watchStamp{modTime: fi.ModTime(), size: fi.Size()}
+		}
+		if old := ws.files[file]; !old.modTime.Equal(stamp.modTime) || old.size != stamp.size {
+			ws.files[file] = stamp
+			return file, true
+		}
+	}
+	return "", false
+}
+
+// wait returns the first file that changes, checked every interval, or "" when ctx is done.
+func (ws *watchSet) wait(ctx context.Context, fileSystem fs.FS, interval time.Duration) string {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ""
+		case <-ticker.C:
+			if file, ok := ws.changed(fileSystem); ok {
+				return file
+			}
+		}
+	}
+}
+
+// Watch runs the script like Main, and runs it again whenever one of the files it has loaded,
+// the script itself and the modules it requires, changes. A script that is still running
+// is stopped first, like a canceled RunContext, so its shutdown hooks run.
+// A script that ends is run again on the next change. Watch returns when ctx is done,
+// with the exit code of the last run.
+func (jr *JSRuntime) Watch(ctx context.Context) int {
+	// every run starts with the variables of the first one
+	vars := map[string]any{}
+	for _, k := range jr.Env.Keys() {
+		vars[k] = jr.Env.Get(k)
+	}
+	ew := jr.Env.ErrorWriter()
+	interval := WatchInterval
+	cur, code := jr, 0
+	for {
+		if cur.watched == nil {
+			cur.watched = newWatchSet()
+			if cur.file != nil {
+				cur.watched.add(cur.Env.Filesystem(), cur.file.file)
+			}
+		}
+		runCtx, cancel := context.WithCancel(ctx)
+		changes := make(chan string, 1)
+		go func(cur *JSRuntime) {
+			if file := cur.watched.wait(runCtx, cur.Env.Filesystem(), interval); file != "" {
+				changes <- file
+				cancel()
+			}
+		}(cur)
+		err := cur.RunContext(runCtx)
+		var file string
+		select {
+		case file = <-changes:
+		default:
+			if ctx.Err() != nil {
+				cancel()
+				return cur.ExitCode()
+			}
+			code = cur.exitStatus(err)
+			fmt.Fprintf(ew, "watch: %s exited with code %d, waiting for changes\n", cur.Name, code)
+			select {
+			case file = <-changes:
+			case <-ctx.Done():
+				cancel()
+				return code
+			}
+		}
+		cancel()
+		fmt.Fprintf(ew, "watch: %s changed, restarting %s\n", file, cur.Name)
+		next, err := cur.restart(vars)
+		for err != nil {
+			fmt.Fprintln(ew, "watch:", err.Error())
+			if cur.watched.wait(ctx, cur.Env.Filesystem(), interval) == "" {
+				return code
+			}
+			next, err = cur.restart(vars)
+		}
+		cur = next
+	}
+}
+
+// restart builds the runtime that runs the script of jr again, with the variables vars
+// and the native modules of jr.
+func (jr *JSRuntime) restart(vars map[string]any) (*JSRuntime, error) {
+	env := NewEnv(
+		WithFilesystem(jr.Env.Filesystem()),
+		WithReader(jr.Env.Reader()),
+		WithWriter(jr.Env.Writer()),
+		WithErrorWriter(jr.Env.ErrorWriter()),
+		WithExecBuilder(jr.Env.ExecBuilder()),
+	)
+	for k, v := range vars {
+		env.Set(k, v)
+	}
+	next, err := newJSRuntime(jr.conf, env)
+	if err != nil {
+		return nil, err
+	}
+	// the files of jr are still watched if the script fails to load them again
+	next.watched = newWatchSet()
+	jr.watched.mu.Lock()
+	for file, stamp := range jr.watched.files {
+		next.watched.files[file] = stamp
+	}
+	jr.watched.mu.Unlock()
+	if next.file != nil {
+		next.watched.add(env.Filesystem(), next.file.file)
+	}
+	jr.inheritModules(next)
+	return next, nil
+}
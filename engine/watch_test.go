@@ -0,0 +1,153 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer that the test reads while the script writes to it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// waitOutput waits for the output of buf to contain want.
+func waitOutput(t *testing.T, buf *syncBuffer, want string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(buf.String(), want) {
+		if time.Now().After(deadline) {
+			t.Fatalf("output does not contain %q:\n%s", want, buf.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// writeFile writes the file with a modification time later than the previous one.
+func writeFile(t *testing.T, name string, content string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(name, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	defer func(d time.Duration) { WatchInterval = d }(WatchInterval)
+	WatchInterval = 20 * time.Millisecond
+
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour)
+	writeFile(t, filepath.Join(dir, "main.js"), `
+		const process = require("/lib/process");
+		const lib = require("./lib.js");
+		process.addShutdownHook(() => console.println("shutdown", lib.version));
+		console.println("run", lib.version, process.env.get("RUN"));
+		process.env.set("RUN", "changed");
+		if (lib.serve) {
+			setInterval(() => {}, 1000);
+		}
+	`, start)
+	writeFile(t, filepath.Join(dir, "lib.js"), `module.exports = { version: 1, serve: true };`, start)
+
+	stdout, stderr := &syncBuffer{}, &syncBuffer{}
+	jr, err := New(Config{
+		Args:   []string{"/work/main.js"},
+		FSTabs: []FSTab{{MountPoint: "/", Source: "../native/root/"}, {MountPoint: "/work", Source: dir}},
+		Env: map[string]any{
+			"PATH": "/lib:/work:/sbin",
+			"PWD":  "/work",
+			"RUN":  "first",
+		},
+		Reader:      &bytes.Buffer{},
+		Writer:      stdout,
+		ErrorWriter: stderr,
+		ExecBuilder: testExecBuilder,
+		Watch:       true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jr.RegisterNativeModule("@jsh/process", jr.Process)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan int)
+	go func() {
+		done <- jr.Watch(ctx)
+	}()
+
+	waitOutput(t, stdout, "run 1 first\n")
+	// the change of a required module stops the running script
+	writeFile(t, filepath.Join(dir, "lib.js"), `module.exports = { version: 2, serve: false };`, start.Add(time.Minute))
+	waitOutput(t, stdout, "run 1 first\nshutdown 1\nrun 2 first\nshutdown 2\n")
+	waitOutput(t, stderr, "watch: /work/lib.js changed, restarting /work/main.js\n")
+	waitOutput(t, stderr, "watch: /work/main.js exited with code 0, waiting for changes\n")
+
+	// the script that has ended runs again on the next change
+	writeFile(t, filepath.Join(dir, "lib.js"), `module.exports = { version: 3, serve: true };`, start.Add(2*time.Minute))
+	waitOutput(t, stdout, "shutdown 2\nrun 3 first\n")
+
+	cancel()
+	select {
+	case code := <-done:
+		if code != ExitCodeCanceled {
+			t.Errorf("expected exit code %d, got %d", ExitCodeCanceled, code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch did not return")
+	}
+	if got, want := stdout.String(), "run 1 first\nshutdown 1\nrun 2 first\nshutdown 2\nrun 3 first\nshutdown 3\n"; got != want {
+		t.Errorf("expected output %q, got %q", want, got)
+	}
+}
+
+func TestWatchSet(t *testing.T) {
+	dir := t.TempDir()
+	fileSystem := NewFS()
+	if err := fileSystem.Mount("/work", os.DirFS(dir)); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, "a.js")
+	start := time.Now().Add(-time.Hour)
+	writeFile(t, name, "1", start)
+
+	ws := newWatchSet()
+	ws.add(fileSystem, "/work/a.js")
+	ws.add(fileSystem, "/work/missing.js")
+	if file, ok := ws.changed(fileSystem); ok {
+		t.Fatalf("unexpected change of %s", file)
+	}
+	writeFile(t, name, "2", start.Add(time.Second))
+	if file, ok := ws.changed(fileSystem); !ok || file != "/work/a.js" {
+		t.Fatalf("expected the change of /work/a.js, got %q %v", file, ok)
+	}
+	// a change is reported once
+	if file, ok := ws.changed(fileSystem); ok {
+		t.Fatalf("unexpected change of %s", file)
+	}
+	if err := os.Remove(name); err != nil {
+		t.Fatal(err)
+	}
+	if file, ok := ws.changed(fileSystem); !ok || file != "/work/a.js" {
+		t.Fatalf("expected the removal of /work/a.js, got %q %v", file, ok)
+	}
+}
@@ -0,0 +1,291 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja_nodejs/eventloop"
+)
+
+// Worker is the native module @jsh/worker, which runs scripts in worker runtimes.
+// A worker is a JSRuntime with its own event loop on its own goroutine.
+// It shares the mounted filesystem and the output of the runtime that starts it,
+// and exchanges the messages with it as copies made by cloneValue.
+func (jr *JSRuntime) Worker(vm *goja.Runtime, module *goja.Object) {
+	exports := module.Get("exports").(*goja.Object)
+	exports.Set("isMainThread", jr.worker == nil)
+	exports.Set("start", func(emitter *goja.Object, filename string, options *goja.Object) goja.Value {
+		w, err := jr.startWorker(vm, emitter, filename, options)
+		if err != nil {
+			return vm.NewGoError(err)
+		}
+		return vm.ToValue(w)
+	})
+	if jr.worker == nil {
+		exports.Set("parentPort", goja.Null())
+		exports.Set("workerData", goja.Null())
+		exports.Set("threadId", 0)
+		return
+	}
+	exports.Set("parentPort", &ParentPort{vm: vm, w: jr.worker})
+	exports.Set("workerData", restoreValue(vm, jr.worker.data))
+	exports.Set("threadId", jr.worker.id)
+}
+
+var workerIDs struct {
+	sync.Mutex
+	last int
+}
+
+// workerLink connects a worker to the runtime that started it.
+type workerLink struct {
+	id     int
+	data   any // the clone of workerData
+	parent *JSRuntime
+	child  *JSRuntime
+	handle *WorkerHandle
+
+	mu      sync.Mutex
+	started bool  // the messages to the worker are delivered to port
+	queue   []any // the messages to the worker before it is started
+	port    *goja.Object
+}
+
+// WorkerHandle is the Worker in the runtime that started it.
+// The methods are called on the event loop of that runtime.
+type WorkerHandle struct {
+	vm      *goja.Runtime
+	w       *workerLink
+	emitter *goja.Object
+	cancel  context.CancelFunc
+	hold    *eventloop.Timer // keeps the event loop alive until the worker exits
+	exited  bool
+}
+
+func (jr *JSRuntime) startWorker(vm *goja.Runtime, emitter *goja.Object, filename string, options *goja.Object) (*WorkerHandle, error) {
+	var data any = cloneUndefined{}
+	var argv []string
+	eval := false
+	if options != nil {
+		var err error
+		if data, err = cloneValue(vm, options.Get("workerData")); err != nil {
+			return nil, err
+		}
+		if v := options.Get("argv"); v != nil && !goja.IsUndefined(v) && !goja.IsNull(v) {
+			if err := vm.ExportTo(v, &argv); err != nil {
+				return nil, fmt.Errorf("worker argv: %w", err)
+			}
+		}
+		if v := options.Get("eval"); v != nil {
+			eval = v.ToBoolean()
+		}
+	}
+
+	env := NewEnv(
+		WithFilesystem(jr.Env.Filesystem()),
+		WithReader(strings.NewReader("")),
+		WithWriter(jr.Env.Writer()),
+		WithErrorWriter(jr.Env.ErrorWriter()),
+		WithExecBuilder(jr.Env.ExecBuilder()),
+	)
+	for _, k := range jr.Env.Keys() {
+		env.Set(k, jr.Env.Get(k))
+	}
+	conf := Config{
+		Name:          "worker",
+		Args:          argv,
+		ExecInProcess: jr.execInProcess,
+		Limits:        jr.limits,
+		Clock:         jr.clock,
+	}
+	if eval {
+		conf.Code = filename
+	} else {
+		if strings.HasPrefix(filename, "./") || strings.HasPrefix(filename, "../") {
+			if pwd, ok := env.Get("PWD").(string); ok {
+				filename = path.Join(pwd, filename)
+			}
+		}
+		conf.Args = append([]string{filename}, argv...)
+	}
+	child, err := newJSRuntime(conf, env)
+	if err != nil {
+		return nil, err
+	}
+	jr.inheritModules(child)
+
+	workerIDs.Lock()
+	workerIDs.last++
+	id := workerIDs.last
+	workerIDs.Unlock()
+
+	// the worker stops with the run of the parent, like on process.exit() or its timeout
+	parentCtx := jr.runCtx
+	if parentCtx == nil {
+		parentCtx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(parentCtx)
+	w := &workerLink{id: id, data: data, parent: jr, child: child}
+	h := &WorkerHandle{vm: vm, w: w, emitter: emitter, cancel: cancel}
+	w.handle = h
+	child.worker = w
+	h.Ref()
+
+	go func() {
+		defer cancel()
+		err := child.RunContext(ctx)
+		var failure any
+		code := child.ExitCode()
+		if ex, ok := err.(*goja.Exception); ok {
+			failure = exceptionClone(ex)
+			code = ExitCodeUncaught
+		} else if ctx.Err() == nil {
+			code = child.exitStatus(err)
+		}
+		jr.eventLoop.RunOnLoop(func(vm *goja.Runtime) {
+			h.exited = true
+			h.Unref()
+			if failure != nil {
+				jr.emitEvent(vm, emitter, "error", restoreValue(vm, failure))
+			}
+			jr.emitEvent(vm, emitter, "exit", vm.ToValue(code))
+		})
+	}()
+	return h, nil
+}
+
+// exceptionClone returns the clone of the value thrown by ex.
+func exceptionClone(ex *goja.Exception) any {
+	obj, ok := ex.Value().(*goja.Object)
+	if !ok || obj.Get("message") == nil {
+		return &cloneError{name: "Error", message: ex.Value().String(), stack: ex.String()}
+	}
+	ret := &cloneError{name: obj.Get("name").String(), message: obj.Get("message").String()}
+	if stack := obj.Get("stack"); stack != nil && !goja.IsUndefined(stack) {
+		ret.stack = stack.String()
+	}
+	return ret
+}
+
+// PostMessage sends the copy of value to the worker.
+// The messages wait until the worker listens to its parentPort.
+func (h *WorkerHandle) PostMessage(value goja.Value) goja.Value {
+	msg, err := cloneValue(h.vm, value)
+	if err != nil {
+		return h.vm.NewGoError(err)
+	}
+	h.w.mu.Lock()
+	defer h.w.mu.Unlock()
+	if !h.w.started {
+		h.w.queue = append(h.w.queue, msg)
+		return goja.Undefined()
+	}
+	h.w.deliver(msg)
+	return goja.Undefined()
+}
+
+// deliver emits msg as a 'message' event of the parentPort of the worker.
+// The caller holds w.mu.
+func (w *workerLink) deliver(msg any) {
+	port := w.port
+	w.child.runOnLoop(func(vm *goja.Runtime) {
+		w.child.emitEvent(vm, port, "message", restoreValue(vm, msg))
+	})
+}
+
+// Terminate stops the worker as soon as possible.
+// The 'exit' event follows with the exit code ExitCodeCanceled.
+func (h *WorkerHandle) Terminate() {
+	h.cancel()
+}
+
+// Ref keeps the runtime alive until the worker exits, which is the default.
+func (h *WorkerHandle) Ref() {
+	if h.hold == nil && !h.exited {
+		h.hold = h.w.parent.eventLoop.SetTimeout(func(*goja.Runtime) {}, time.Duration(math.MaxInt64))
+	}
+}
+
+// Unref lets the runtime end while the worker is still running.
+func (h *WorkerHandle) Unref() {
+	if h.hold != nil {
+		h.w.parent.eventLoop.ClearTimeout(h.hold)
+		h.hold = nil
+	}
+}
+
+// ThreadId returns the id of the worker.
+func (h *WorkerHandle) ThreadId() int {
+	return h.w.id
+}
+
+// ParentPort is the parentPort of a worker, the methods are called on its event loop.
+type ParentPort struct {
+	vm   *goja.Runtime
+	w    *workerLink
+	hold *eventloop.Timer // keeps the worker alive while it listens to the messages
+}
+
+// PostMessage sends the copy of value to the Worker in the parent runtime.
+func (p *ParentPort) PostMessage(value goja.Value) goja.Value {
+	msg, err := cloneValue(p.vm, value)
+	if err != nil {
+		return p.vm.NewGoError(err)
+	}
+	parent, emitter := p.w.parent, p.w.handle.emitter
+	parent.runOnLoop(func(vm *goja.Runtime) {
+		if !p.w.handle.exited {
+			parent.emitEvent(vm, emitter, "message", restoreValue(vm, msg))
+		}
+	})
+	return goja.Undefined()
+}
+
+// Start delivers the messages to the worker as the 'message' events of emitter,
+// the ones posted before first, and keeps the worker alive until Close.
+func (p *ParentPort) Start(emitter *goja.Object) {
+	if p.hold == nil {
+		p.hold = p.w.child.eventLoop.SetTimeout(func(*goja.Runtime) {}, time.Duration(math.MaxInt64))
+	}
+	p.w.mu.Lock()
+	defer p.w.mu.Unlock()
+	if p.w.started {
+		return
+	}
+	p.w.started, p.w.port = true, emitter
+	for _, msg := range p.w.queue {
+		p.w.deliver(msg)
+	}
+	p.w.queue = nil
+}
+
+// Close lets the worker end when it has nothing else to do.
+// The messages that arrive later are still delivered while it runs.
+func (p *ParentPort) Close() {
+	if p.hold != nil {
+		p.w.child.eventLoop.ClearTimeout(p.hold)
+		p.hold = nil
+	}
+}
+
+// inheritModules registers the native modules and the file loaders of jr to the child runtime,
+// the modules bound to a runtime are bound to the child.
+func (jr *JSRuntime) inheritModules(child *JSRuntime) {
+	for ext, loader := range jr.fileLoaders {
+		child.RegisterFileLoader(ext, loader)
+	}
+	for name, loader := range jr.nativeModules {
+		child.RegisterNativeModule(name, loader)
+	}
+	// the process module belongs to the runtime that requires it
+	child.RegisterNativeModule("@jsh/process", child.Process)
+	if _, ok := jr.nativeModules["@jsh/worker"]; ok {
+		child.RegisterNativeModule("@jsh/worker", child.Worker)
+	}
+}
@@ -0,0 +1,189 @@
+package engine
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+func TestWorker(t *testing.T) {
+	withWorker := func(jr *JSRuntime) {
+		jr.RegisterNativeModule("@jsh/worker", jr.Worker)
+	}
+	tests := []TestCase{
+		{
+			name: "worker_echo",
+			script: `
+				const { Worker, isMainThread } = require("/lib/worker");
+				const w = new Worker("./worker/echo.js", { workerData: { name: "echo" } });
+				w.on("message", (reply) => {
+					console.println("from:", reply.from, "main:", reply.isMainThread, "msg:", JSON.stringify(reply.msg));
+					w.postMessage("close");
+				});
+				w.on("exit", (code) => console.println("exit:", code));
+				w.postMessage({ n: 1, list: [1, "two", null], nested: { ok: true } });
+				console.println("main:", isMainThread);
+			`,
+			output: []string{
+				"main: true",
+				`from: echo main: false msg: {"n":1,"list":[1,"two",null],"nested":{"ok":true}}`,
+				"exit: 0",
+			},
+			preTest: withWorker,
+		},
+		{
+			name: "worker_eval_structured_clone",
+			script: `
+				const { Worker } = require("/lib/worker");
+				const w = new Worker(` + "`" + `
+					const { parentPort } = require("/lib/worker");
+					parentPort.once("message", (v) => parentPort.postMessage(v));
+				` + "`" + `, { eval: true });
+				const obj = {
+					date: new Date(86400000),
+					map: new Map([["a", 1]]),
+					set: new Set([1, 2]),
+					bytes: new Uint8Array([1, 2, 3]),
+					re: /ab+c/gi,
+					err: new TypeError("bad"),
+					big: 12345678901234567890n,
+					undef: undefined,
+				};
+				obj.self = obj;
+				w.on("message", (v) => {
+					console.println("self:", v.self === v);
+					console.println("date:", v.date instanceof Date, v.date.getTime());
+					console.println("map:", v.map instanceof Map, v.map.get("a"));
+					console.println("set:", v.set instanceof Set, v.set.has(2));
+					console.println("bytes:", v.bytes instanceof Uint8Array, Array.from(v.bytes).join(","));
+					console.println("re:", v.re instanceof RegExp, v.re.source, v.re.flags);
+					console.println("err:", v.err instanceof TypeError, v.err.message);
+					console.println("big:", typeof v.big, String(v.big));
+					console.println("undef:", "undef" in v, typeof v.undef);
+				});
+				w.on("exit", (code) => console.println("exit:", code));
+				w.postMessage(obj);
+			`,
+			output: []string{
+				"self: true",
+				"date: true 86400000",
+				"map: true 1",
+				"set: true true",
+				"bytes: true 1,2,3",
+				"re: true ab+c gi",
+				"err: true bad",
+				"big: bigint 12345678901234567890",
+				"undef: true undefined",
+				"exit: 0",
+			},
+			preTest: withWorker,
+		},
+		{
+			name: "worker_data_clone_error",
+			script: `
+				const { Worker } = require("/lib/worker");
+				const w = new Worker("1", { eval: true });
+				try {
+					w.postMessage({ fn: () => 1 });
+				} catch (e) {
+					console.println(e.message);
+				}
+				w.on("exit", (code) => console.println("exit:", code));
+			`,
+			output: []string{
+				"DataCloneError: function could not be cloned",
+				"exit: 0",
+			},
+			preTest: withWorker,
+		},
+		{
+			name: "worker_error",
+			script: `
+				const { Worker } = require("/lib/worker");
+				const w = new Worker("setTimeout(() => { throw new RangeError('worker failed'); }, 0)", { eval: true });
+				w.on("error", (err) => console.println("error:", err instanceof RangeError, err.message));
+				w.on("exit", (code) => console.println("exit:", code));
+			`,
+			output: []string{
+				"error: true worker failed",
+				"exit: 1",
+			},
+			preTest: withWorker,
+		},
+		{
+			name: "worker_terminate",
+			script: `
+				const { Worker } = require("/lib/worker");
+				const w = new Worker(` + "`" + `
+					const { parentPort } = require("/lib/worker");
+					parentPort.postMessage("ready");
+					while (true) {}
+				` + "`" + `, { eval: true });
+				w.on("message", (msg) => {
+					console.println("message:", msg);
+					w.terminate().then((code) => console.println("terminated:", code));
+				});
+			`,
+			output: []string{
+				"message: ready",
+				"terminated: 130",
+			},
+			preTest: withWorker,
+		},
+		{
+			name: "worker_exit_code",
+			script: `
+				const { Worker } = require("/lib/worker");
+				const w = new Worker("require('/lib/process').exit(7)", { eval: true });
+				w.on("exit", (code) => console.println("exit:", code));
+			`,
+			output: []string{
+				"exit: 7",
+			},
+			preTest: withWorker,
+		},
+	}
+	for _, tc := range tests {
+		RunTest(t, tc)
+	}
+}
+
+func TestWorkerParentExit(t *testing.T) {
+	stopped := make(chan struct{})
+	conf := Config{
+		Name: "worker_parent_exit",
+		Code: `
+			const process = require("/lib/process");
+			const { Worker } = require("/lib/worker");
+			const w = new Worker(` + "`" + `
+				const process = require("/lib/process");
+				process.addShutdownHook(() => require("@test/stopped")());
+				setInterval(() => {}, 10);
+				require("/lib/worker").parentPort.postMessage("started");
+			` + "`" + `, { eval: true });
+			w.on("message", () => process.exit(2));
+		`,
+		FSTabs: []FSTab{{MountPoint: "/", Source: "../native/root/"}},
+		Reader: &bytes.Buffer{},
+		Writer: &bytes.Buffer{},
+	}
+	jr, err := New(conf)
+	if err != nil {
+		t.Fatalf("Failed to create JSRuntime: %v", err)
+	}
+	jr.RegisterNativeModule("@jsh/process", jr.Process)
+	jr.RegisterNativeModule("@jsh/worker", jr.Worker)
+	jr.RegisterNativeModule("@test/stopped", func(vm *goja.Runtime, module *goja.Object) {
+		module.Set("exports", func() { close(stopped) })
+	})
+	if code := jr.Main(); code != 2 {
+		t.Errorf("Expected exit code 2, got %d", code)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The worker kept running after the parent exited")
+	}
+}
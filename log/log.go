@@ -12,52 +12,109 @@ import (
 	"github.com/dop251/goja"
 )
 
-var defaultWriter io.Writer = io.Discard
+// Console writes the console output of a single runtime.
+type Console struct {
+	w  io.Writer
+	ew io.Writer // the writer of console.warn and console.error
+}
+
+// NewConsole returns a Console writing to w, nil w discards the output.
+func NewConsole(w io.Writer) *Console {
+	return NewConsoleWriters(w, w)
+}
+
+// NewConsoleWriters returns a Console writing to w,
+// and the warnings and the errors to ew.
+// nil w or ew discards the output.
+func NewConsoleWriters(w, ew io.Writer) *Console {
+	if w == nil {
+		w = io.Discard
+	}
+	if ew == nil {
+		ew = io.Discard
+	}
+	return &Console{w: w, ew: ew}
+}
+
+// consoleSymbol keeps the Console of a runtime on its global object.
+var consoleSymbol = goja.NewSymbol("jsh.console")
 
+// SetConsole builds the console object for vm that writes to w,
+// and binds the Console to vm so that ConsoleOf(vm) returns it.
 func SetConsole(vm *goja.Runtime, w io.Writer) *goja.Object {
-	defaultWriter = w
+	return SetConsoleWriters(vm, w, w)
+}
+
+// SetConsoleWriters is SetConsole that writes console.warn and console.error to ew.
+func SetConsoleWriters(vm *goja.Runtime, w, ew io.Writer) *goja.Object {
+	c := NewConsoleWriters(w, ew)
+	vm.GlobalObject().DefineDataPropertySymbol(consoleSymbol, vm.ToValue(c),
+		goja.FLAG_FALSE, goja.FLAG_TRUE, goja.FLAG_FALSE)
 
 	con := vm.NewObject()
-	con.Set("log", makeConsoleLog(slog.LevelInfo))
-	con.Set("debug", makeConsoleLog(slog.LevelDebug))
-	con.Set("info", makeConsoleLog(slog.LevelInfo))
-	con.Set("warn", makeConsoleLog(slog.LevelWarn))
-	con.Set("error", makeConsoleLog(slog.LevelError))
-	con.Set("println", doPrintln)
-	con.Set("print", doPrint)
-	con.Set("printf", doPrintf)
+	con.Set("log", c.makeConsoleLog(slog.LevelInfo))
+	con.Set("debug", c.makeConsoleLog(slog.LevelDebug))
+	con.Set("info", c.makeConsoleLog(slog.LevelInfo))
+	con.Set("warn", c.makeConsoleLog(slog.LevelWarn))
+	con.Set("error", c.makeConsoleLog(slog.LevelError))
+	con.Set("println", c.doPrintln)
+	con.Set("print", c.doPrint)
+	con.Set("printf", c.doPrintf)
 	return con
 }
 
-func Println(args ...interface{}) {
-	fmt.Fprintln(defaultWriter, args...)
+// ConsoleOf returns the Console bound to vm by SetConsole.
+// If there is none, the returned Console discards the output.
+func ConsoleOf(vm *goja.Runtime) *Console {
+	if v := vm.GlobalObject().GetSymbol(consoleSymbol); v != nil {
+		if c, ok := v.Export().(*Console); ok {
+			return c
+		}
+	}
+	return NewConsole(nil)
 }
 
-func Print(args ...interface{}) {
-	fmt.Fprint(defaultWriter, args...)
+func (c *Console) Writer() io.Writer {
+	return c.w
 }
 
-func Printf(format string, args ...interface{}) {
-	fmt.Fprintf(defaultWriter, format, args...)
+func (c *Console) ErrorWriter() io.Writer {
+	return c.ew
 }
 
-func Log(level slog.Level, args ...interface{}) {
+func (c *Console) Println(args ...interface{}) {
+	fmt.Fprintln(c.w, args...)
+}
+
+func (c *Console) Print(args ...interface{}) {
+	fmt.Fprint(c.w, args...)
+}
+
+func (c *Console) Printf(format string, args ...interface{}) {
+	fmt.Fprintf(c.w, format, args...)
+}
+
+func (c *Console) Log(level slog.Level, args ...interface{}) {
 	strLevel := level.String()
 	strLevel = strLevel + strings.Repeat(" ", 5-len(strLevel))
-	fmt.Fprintln(defaultWriter, strLevel, fmt.Sprint(args...))
+	w := c.w
+	if level >= slog.LevelWarn {
+		w = c.ew
+	}
+	fmt.Fprintln(w, strLevel, fmt.Sprint(args...))
 }
 
-func doPrint(call goja.FunctionCall) goja.Value {
-	Print(argsValues(call)...)
+func (c *Console) doPrint(call goja.FunctionCall) goja.Value {
+	c.Print(argsValues(call)...)
 	return goja.Undefined()
 }
 
-func doPrintln(call goja.FunctionCall) goja.Value {
-	Println(argsValues(call)...)
+func (c *Console) doPrintln(call goja.FunctionCall) goja.Value {
+	c.Println(argsValues(call)...)
 	return goja.Undefined()
 }
 
-func doPrintf(call goja.FunctionCall) goja.Value {
+func (c *Console) doPrintf(call goja.FunctionCall) goja.Value {
 	if len(call.Arguments) == 0 {
 		return goja.Undefined()
 	}
@@ -66,13 +123,13 @@ func doPrintf(call goja.FunctionCall) goja.Value {
 	for i := 1; i < len(call.Arguments); i++ {
 		args[i-1] = valueToPrintable(call.Arguments[i])
 	}
-	Printf(format, args...)
+	c.Printf(format, args...)
 	return goja.Undefined()
 }
 
-func makeConsoleLog(level slog.Level) func(call goja.FunctionCall) goja.Value {
+func (c *Console) makeConsoleLog(level slog.Level) func(call goja.FunctionCall) goja.Value {
 	return func(call goja.FunctionCall) goja.Value {
-		Log(level, argsValues(call)...)
+		c.Log(level, argsValues(call)...)
 		return goja.Undefined()
 	}
 }
@@ -13,9 +13,9 @@ import (
 
 func TestPrint(t *testing.T) {
 	buf := &bytes.Buffer{}
-	defaultWriter = buf
+	c := NewConsole(buf)
 
-	Print("hello", "world")
+	c.Print("hello", "world")
 	output := buf.String()
 	if output != "helloworld" {
 		t.Errorf("expected 'helloworld', got '%s'", output)
@@ -24,9 +24,9 @@ func TestPrint(t *testing.T) {
 
 func TestPrintln(t *testing.T) {
 	buf := &bytes.Buffer{}
-	defaultWriter = buf
+	c := NewConsole(buf)
 
-	Println("hello", "world")
+	c.Println("hello", "world")
 	output := buf.String()
 	if output != "hello world\n" {
 		t.Errorf("expected 'hello world\\n', got '%s'", output)
@@ -69,9 +69,9 @@ func TestLog(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			buf := &bytes.Buffer{}
-			defaultWriter = buf
+			c := NewConsole(buf)
 
-			Log(tt.level, tt.args...)
+			c.Log(tt.level, tt.args...)
 			output := buf.String()
 			if !strings.Contains(output, tt.contains) {
 				t.Errorf("expected output to contain '%s', got '%s'", tt.contains, output)
@@ -98,6 +98,26 @@ func TestSetConsole(t *testing.T) {
 	}
 }
 
+func TestSetConsoleWriters(t *testing.T) {
+	vm := goja.New()
+	out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+
+	vm.Set("console", SetConsoleWriters(vm, out, errOut))
+	_, err := vm.RunString(`console.log("data"); console.warn("careful"); console.error("failed")`)
+	if err != nil {
+		t.Fatalf("failed to run console: %v", err)
+	}
+	if got := out.String(); got != "INFO  data\n" {
+		t.Errorf("expected 'INFO  data\\n', got %q", got)
+	}
+	if got := errOut.String(); got != "WARN  careful\nERROR failed\n" {
+		t.Errorf("expected warnings and errors, got %q", got)
+	}
+	if ConsoleOf(vm).ErrorWriter() != errOut {
+		t.Error("ConsoleOf(vm).ErrorWriter() is not the error writer")
+	}
+}
+
 func TestConsoleLog(t *testing.T) {
 	vm := goja.New()
 	buf := &bytes.Buffer{}
@@ -310,40 +330,40 @@ func TestConsoleLogArray(t *testing.T) {
 	}
 }
 
-func TestDefaultWriter(t *testing.T) {
-	// Save original defaultWriter
-	originalWriter := defaultWriter
-	defer func() { defaultWriter = originalWriter }()
-
-	// Test that defaultWriter can be changed
+func TestConsoleOf(t *testing.T) {
+	// Each runtime keeps its own console writer
 	buf1 := &bytes.Buffer{}
-	defaultWriter = buf1
-	Print("test1")
+	vm1 := goja.New()
+	vm1.Set("console", SetConsole(vm1, buf1))
+
+	buf2 := &bytes.Buffer{}
+	vm2 := goja.New()
+	vm2.Set("console", SetConsole(vm2, buf2))
+
+	ConsoleOf(vm1).Print("test1")
+	if _, err := vm2.RunString(`console.print("test2")`); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
 
 	if buf1.String() != "test1" {
 		t.Errorf("expected 'test1', got '%s'", buf1.String())
 	}
-
-	// Change writer again
-	buf2 := &bytes.Buffer{}
-	defaultWriter = buf2
-	Print("test2")
-
 	if buf2.String() != "test2" {
 		t.Errorf("expected 'test2', got '%s'", buf2.String())
 	}
 
-	// buf1 should not have changed
-	if buf1.String() != "test1" {
-		t.Errorf("expected buf1 to still be 'test1', got '%s'", buf1.String())
+	// A runtime without console discards the output
+	ConsoleOf(goja.New()).Print("test3")
+	if buf1.String() != "test1" || buf2.String() != "test2" {
+		t.Errorf("unexpected output: %q, %q", buf1.String(), buf2.String())
 	}
 }
 
 func TestPrintf(t *testing.T) {
 	buf := &bytes.Buffer{}
-	defaultWriter = buf
+	c := NewConsole(buf)
 
-	Printf("Hello %s, number: %d", "World", 42)
+	c.Printf("Hello %s, number: %d", "World", 42)
 	output := buf.String()
 	expected := "Hello World, number: 42"
 	if output != expected {
@@ -504,9 +524,6 @@ func TestAnyToPrintableGojaObjectNoToString(t *testing.T) {
 }
 
 func TestAnyToPrintableTimeType(t *testing.T) {
-	buf := &bytes.Buffer{}
-	defaultWriter = buf
-
 	// Test with Go time.Time directly
 	now := time.Now()
 	result := anyToPrintable(now)
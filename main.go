@@ -4,9 +4,12 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/OutOfBedlam/jsh/engine"
 	"github.com/OutOfBedlam/jsh/native"
+	"github.com/OutOfBedlam/jsh/native/readline"
 )
 
 // JSH options:
@@ -16,11 +19,30 @@ import (
 //     ex: jsh script.js arg1 arg2
 //  3. no args : start interactive shell
 //     ex: jsh
+//  4. -watch script file : execute script file again whenever the files it has loaded change
+//     ex: jsh -watch server.js
+//  5. -cache script file : keep the transpiled TypeScript and ES module sources on disk for the next runs
+//     ex: jsh -cache app.ts
 func main() {
 	var fstabs engine.FSTabs
 	src := flag.String("c", "", "command to execute")
 	scf := flag.String("s", "", "configured file to start from")
 	flag.Var(&fstabs, "v", "volume to mount (format: /mountpoint=source)")
+	cpuProfile := flag.String("cpuprofile", "", "write cpu profile of the script to file")
+	memProfile := flag.String("memprofile", "", "write memory profile to file when the script ends")
+	watch := flag.Bool("watch", false, "run the script again when the files it has loaded change")
+	cache := flag.Bool("cache", false, "keep the transpiled TypeScript and ES module sources in the cache directory of the preferences")
+	cacheSize := flag.Int("cache-size", engine.DefaultCacheSize, "maximum number of sources kept in the cache directory")
+	clock := flag.String("clock", "", "start a manual clock at the time (RFC 3339), advanced by process.advanceClock()")
+	var limits engine.Limits
+	flag.DurationVar(&limits.WallTime, "max-time", 0, "maximum run time of the script")
+	flag.IntVar(&limits.StackDepth, "max-stack", 0, "maximum call stack depth")
+	flag.Uint64Var(&limits.HeapGrowth, "max-heap", 0, "maximum heap growth in bytes")
+	flag.IntVar(&limits.PendingJobs, "max-jobs", 0, "maximum number of pending timers and event loop jobs")
+	var hostEnv engine.HostEnv
+	flag.BoolVar(&hostEnv.Import, "host-env", false, "import the environment variables of the host")
+	flag.Var(&hostEnv.Allow, "env-allow", "patterns of the host environment variables to import (e.g. LANG,AWS_*)")
+	flag.Var(&hostEnv.Deny, "env-deny", "patterns of the host environment variables not to import")
 	flag.Parse()
 
 	conf := engine.Config{}
@@ -41,6 +63,22 @@ func main() {
 			"HOME": "/work",
 			"PWD":  "/work",
 		}
+		conf.CPUProfile = *cpuProfile
+		conf.MemProfile = *memProfile
+		conf.Watch = *watch
+		if *clock != "" {
+			t, err := time.Parse(time.RFC3339, *clock)
+			if err != nil {
+				fmt.Println("Error parsing clock:", err.Error())
+				os.Exit(1)
+			}
+			conf.Clock = engine.NewManualClock(t)
+		}
+		conf.Limits = limits
+		conf.HostEnv = hostEnv
+	}
+	if *cache {
+		engine.SetCacheDir(filepath.Join(readline.PrefDir(), "cache"), *cacheSize)
 	}
 	native.ConfigureRoot(&conf)
 	engine, err := engine.New(conf)
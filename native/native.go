@@ -7,6 +7,7 @@ import (
 	"github.com/OutOfBedlam/jsh/engine"
 	"github.com/OutOfBedlam/jsh/native/http"
 	"github.com/OutOfBedlam/jsh/native/mqtt"
+	"github.com/OutOfBedlam/jsh/native/pkg"
 	"github.com/OutOfBedlam/jsh/native/readline"
 	"github.com/OutOfBedlam/jsh/native/shell"
 	"github.com/OutOfBedlam/jsh/native/ws"
@@ -31,9 +32,12 @@ func ConfigureRoot(c *engine.Config) {
 
 func Enable(n *engine.JSRuntime) {
 	n.RegisterNativeModule("@jsh/process", n.Process)
+	n.RegisterNativeModule("@jsh/worker", n.Worker)
 	n.RegisterNativeModule("@jsh/shell", shell.Module)
 	n.RegisterNativeModule("@jsh/readline", readline.Module)
 	n.RegisterNativeModule("@jsh/http", http.Module)
 	n.RegisterNativeModule("@jsh/ws", ws.Module)
 	n.RegisterNativeModule("@jsh/mqtt", mqtt.Module)
+	n.RegisterNativeModule("@jsh/pkg", pkg.Module)
+	n.RegisterFileLoader(".txt", engine.TextLoader)
 }
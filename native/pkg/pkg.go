@@ -0,0 +1,475 @@
+package pkg
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// LockFile is the name of the lock file that Install writes next to the node_modules directory.
+const LockFile = "pkg-lock.json"
+
+func Module(rt *goja.Runtime, module *goja.Object) {
+	// Export native functions
+	m := module.Get("exports").(*goja.Object)
+	m.Set("install", Install)
+}
+
+// FS is the filesystem the packages are installed into,
+// like the mounted filesystem of process.env.filesystem().
+type FS interface {
+	fs.ReadDirFS
+	Mkdir(name string) error
+	WriteFile(name string, data []byte) error
+	Remove(name string) error
+	Rmdir(name string) error
+}
+
+// Options are the directories of Install, absolute paths of its FS.
+type Options struct {
+	Dir   string // the node_modules directory the packages are installed into
+	Cache string // the directory of the tarballs and the package directories the dependencies are resolved from
+	Lock  string // the lock file, the LockFile next to Dir if empty
+}
+
+// Package is a package installed by Install.
+type Package struct {
+	Name     string
+	Version  string
+	Path     string // the directory the package is installed into
+	Resolved string // the tarball or the directory the package is installed from
+}
+
+// Lock is the content of the lock file, the packages installed in the node_modules directory.
+type Lock struct {
+	LockfileVersion int                  `json:"lockfileVersion"`
+	Packages        map[string]LockEntry `json:"packages"` // by the path relative to the directory of the lock file
+}
+
+type LockEntry struct {
+	Version      string            `json:"version"`
+	Resolved     string            `json:"resolved,omitempty"`
+	Integrity    string            `json:"integrity,omitempty"` // the sha512 of the tarball, like npm
+	Dependencies map[string]string `json:"dependencies,omitempty"`
+}
+
+// manifest is the part of package.json that Install reads.
+type manifest struct {
+	Name         string            `json:"name"`
+	Version      string            `json:"version"`
+	Dependencies map[string]string `json:"dependencies"`
+}
+
+// Install installs the packages of sources, npm-packed tarballs (.tgz) or package directories,
+// into the node_modules directory opts.Dir, replacing the installed ones. The dependencies
+// of the packages are resolved from opts.Cache, to the highest version in their ranges,
+// unless an installed one is in the range. Without sources, it installs the dependencies
+// of the package.json next to opts.Dir. The installed packages are recorded in the lock file.
+func Install(fsys FS, sources []string, opts Options) ([]Package, error) {
+	if opts.Dir == "" {
+		return nil, errors.New("no node_modules directory")
+	}
+	opts.Dir = path.Clean(opts.Dir)
+	root := path.Dir(opts.Dir)
+	if opts.Lock == "" {
+		opts.Lock = path.Join(root, LockFile)
+	}
+	in := &installer{fsys: fsys, opts: opts, root: root, lock: &Lock{LockfileVersion: 1, Packages: map[string]LockEntry{}}}
+	if b, err := fs.ReadFile(fsys, opts.Lock); err == nil {
+		if err := json.Unmarshal(b, in.lock); err != nil {
+			return nil, fmt.Errorf("%s: %w", opts.Lock, err)
+		}
+		if in.lock.Packages == nil {
+			in.lock.Packages = map[string]LockEntry{}
+		}
+	}
+
+	if len(sources) == 0 {
+		b, err := fs.ReadFile(fsys, path.Join(root, "package.json"))
+		if err != nil {
+			return nil, err
+		}
+		var m manifest
+		if err := json.Unmarshal(b, &m); err != nil {
+			return nil, fmt.Errorf("%s: %w", path.Join(root, "package.json"), err)
+		}
+		for _, name := range sortedKeys(m.Dependencies) {
+			if err := in.installDependency(name, m.Dependencies[name], root); err != nil {
+				return in.installed, err
+			}
+		}
+	}
+	for _, s := range sources {
+		src, err := readSource(fsys, s)
+		if err != nil {
+			return in.installed, err
+		}
+		if err := in.install(src, opts.Dir); err != nil {
+			return in.installed, err
+		}
+	}
+	return in.installed, in.writeLock()
+}
+
+type installer struct {
+	fsys      FS
+	opts      Options
+	root      string // the directory of the node_modules directory
+	lock      *Lock
+	cache     map[string][]*source // the packages of the cache by name, read when a dependency is resolved
+	installed []Package
+}
+
+// install installs src into the node_modules directory modules, and then its dependencies.
+func (in *installer) install(src *source, modules string) error {
+	dst := path.Join(modules, src.manifest.Name)
+	if src.dir && (dst == src.path || strings.HasPrefix(dst, src.path+"/") || strings.HasPrefix(src.path, dst+"/")) {
+		return fmt.Errorf("%s: can not be installed into %s", src.path, dst)
+	}
+	if err := removeAll(in.fsys, dst); err != nil {
+		return fmt.Errorf("%s: %w", dst, err)
+	}
+	if err := src.extract(in.fsys, dst); err != nil {
+		return fmt.Errorf("%s: %w", src.path, err)
+	}
+	key := in.lockKey(dst)
+	for k := range in.lock.Packages {
+		if k == key || strings.HasPrefix(k, key+"/") {
+			delete(in.lock.Packages, k)
+		}
+	}
+	in.lock.Packages[key] = LockEntry{
+		Version:      src.manifest.Version,
+		Resolved:     src.path,
+		Integrity:    src.integrity,
+		Dependencies: src.manifest.Dependencies,
+	}
+	in.installed = append(in.installed, Package{
+		Name:     src.manifest.Name,
+		Version:  src.manifest.Version,
+		Path:     dst,
+		Resolved: src.path,
+	})
+	for _, name := range sortedKeys(src.manifest.Dependencies) {
+		if err := in.installDependency(name, src.manifest.Dependencies[name], dst); err != nil {
+			return fmt.Errorf("%s@%s: %w", src.manifest.Name, src.manifest.Version, err)
+		}
+	}
+	return nil
+}
+
+// installDependency installs the dependency name of the package in the directory parent,
+// unless the one that require() finds from parent is in the range spec.
+// It is installed into the node_modules directory, or into the one of parent
+// if another version is there.
+func (in *installer) installDependency(name, spec, parent string) error {
+	rng, err := ParseRange(spec)
+	if err != nil {
+		return fmt.Errorf("dependency %s: unsupported version %q", name, spec)
+	}
+	for dir := parent; ; dir = path.Dir(dir) {
+		if path.Base(dir) == "node_modules" {
+			continue
+		}
+		p := path.Join(dir, "node_modules", name)
+		if m, ok := readManifest(in.fsys, p); ok {
+			if v, err := ParseVersion(m.Version); err == nil && rng.Match(v) {
+				in.lockInstalled(p, m)
+				return nil
+			}
+			break
+		}
+		if dir == in.root || dir == "/" {
+			break
+		}
+	}
+	src, err := in.resolve(name, spec, rng)
+	if err != nil {
+		return err
+	}
+	modules := in.opts.Dir
+	if _, ok := readManifest(in.fsys, path.Join(modules, name)); ok && parent != in.root {
+		modules = path.Join(parent, "node_modules")
+	}
+	return in.install(src, modules)
+}
+
+// resolve returns the highest version of the package name in the cache that is in rng, parsed from spec.
+func (in *installer) resolve(name, spec string, rng Range) (*source, error) {
+	if in.cache == nil {
+		in.cache = map[string][]*source{}
+		entries, _ := in.fsys.ReadDir(in.opts.Cache)
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			// the files that are not packages are ignored
+			if src, err := readSource(in.fsys, path.Join(in.opts.Cache, entry.Name())); err == nil {
+				in.cache[src.manifest.Name] = append(in.cache[src.manifest.Name], src)
+			}
+		}
+	}
+	var ret *source
+	var best Version
+	for _, src := range in.cache[name] {
+		v, err := ParseVersion(src.manifest.Version)
+		if err != nil || !rng.Match(v) {
+			continue
+		}
+		if ret == nil || v.Compare(best) > 0 {
+			ret, best = src, v
+		}
+	}
+	if ret == nil {
+		return nil, fmt.Errorf("dependency %s: no version in the range %q in the cache %s", name, spec, in.opts.Cache)
+	}
+	return ret, nil
+}
+
+// lockInstalled records the package installed in the directory p, if the lock file lacks it.
+func (in *installer) lockInstalled(p string, m *manifest) {
+	key := in.lockKey(p)
+	if _, ok := in.lock.Packages[key]; !ok {
+		in.lock.Packages[key] = LockEntry{Version: m.Version, Dependencies: m.Dependencies}
+	}
+}
+
+func (in *installer) lockKey(p string) string {
+	return strings.TrimPrefix(p, strings.TrimSuffix(in.root, "/")+"/")
+}
+
+// writeLock writes the lock file, without the packages that are not installed anymore.
+func (in *installer) writeLock() error {
+	for key := range in.lock.Packages {
+		if _, ok := readManifest(in.fsys, path.Join(in.root, key)); !ok {
+			delete(in.lock.Packages, key)
+		}
+	}
+	b, err := json.MarshalIndent(in.lock, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := in.fsys.WriteFile(in.opts.Lock, append(b, '\n')); err != nil {
+		return fmt.Errorf("%s: %w", in.opts.Lock, err)
+	}
+	return nil
+}
+
+// source is a package to install, a tarball or a directory.
+type source struct {
+	path      string
+	dir       bool
+	manifest  manifest
+	integrity string        // of the tarball
+	files     []tarballFile // of the tarball
+}
+
+type tarballFile struct {
+	name string // relative to the package
+	data []byte
+}
+
+// readSource reads the package.json of the tarball or the directory p.
+func readSource(fsys FS, p string) (*source, error) {
+	p = path.Clean(p)
+	fi, err := fs.Stat(fsys, p)
+	if err != nil {
+		return nil, err
+	}
+	src := &source{path: p, dir: fi.IsDir()}
+	var b []byte
+	if src.dir {
+		if b, err = fs.ReadFile(fsys, path.Join(p, "package.json")); err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+	} else {
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return nil, err
+		}
+		if src.files, err = readTarball(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		for _, f := range src.files {
+			if f.name == "package.json" {
+				b = f.data
+			}
+		}
+		if b == nil {
+			return nil, fmt.Errorf("%s: no package.json", p)
+		}
+		sum := sha512.Sum512(data)
+		src.integrity = "sha512-" + base64.StdEncoding.EncodeToString(sum[:])
+	}
+	if err := json.Unmarshal(b, &src.manifest); err != nil {
+		return nil, fmt.Errorf("%s: package.json: %w", p, err)
+	}
+	if !validName(src.manifest.Name) {
+		return nil, fmt.Errorf("%s: invalid package name %q", p, src.manifest.Name)
+	}
+	if _, err := ParseVersion(src.manifest.Version); err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	return src, nil
+}
+
+// validName reports whether name is a package name, like "pkg" or "@scope/pkg",
+// that does not leave the node_modules directory.
+func validName(name string) bool {
+	parts := strings.Split(name, "/")
+	if len(parts) > 2 || (len(parts) == 2 && !strings.HasPrefix(name, "@")) {
+		return false
+	}
+	for _, p := range parts {
+		if p == "" || p == "@" || strings.HasPrefix(strings.TrimPrefix(p, "@"), ".") {
+			return false
+		}
+	}
+	return true
+}
+
+// readTarball reads the regular files of the tar archive data, gzipped or not.
+// The files of npm-packed tarballs are in a "package" directory, the first
+// directory of the names is removed.
+func readTarball(data []byte) ([]tarballFile, error) {
+	var r io.Reader = bytes.NewReader(data)
+	if len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	var ret []tarballFile
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return ret, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		// cleaned as an absolute path, the names do not leave the package
+		_, name, ok := strings.Cut(strings.TrimPrefix(path.Clean("/"+hdr.Name), "/"), "/")
+		if !ok || !fs.ValidPath(name) {
+			continue
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, tarballFile{name: name, data: b})
+	}
+}
+
+// extract writes the files of the package into the directory dst,
+// the node_modules and the .git of a directory are skipped.
+func (src *source) extract(fsys FS, dst string) error {
+	if err := fsys.Mkdir(dst); err != nil {
+		return err
+	}
+	if !src.dir {
+		for _, f := range src.files {
+			p := path.Join(dst, f.name)
+			if err := fsys.Mkdir(path.Dir(p)); err != nil {
+				return err
+			}
+			if err := fsys.WriteFile(p, f.data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fs.WalkDir(fsys, src.path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if isDotEntry(d) {
+			return fs.SkipDir
+		}
+		target := path.Join(dst, strings.TrimPrefix(p, src.path))
+		switch {
+		case d.IsDir():
+			if p != src.path && (d.Name() == "node_modules" || d.Name() == ".git") {
+				return fs.SkipDir
+			}
+			return fsys.Mkdir(target)
+		case d.Type().IsRegular():
+			b, err := fs.ReadFile(fsys, p)
+			if err != nil {
+				return err
+			}
+			return fsys.WriteFile(target, b)
+		}
+		return nil
+	})
+}
+
+// readManifest reads the package.json of the installed package in the directory p.
+func readManifest(fsys FS, p string) (*manifest, bool) {
+	b, err := fs.ReadFile(fsys, path.Join(p, "package.json"))
+	if err != nil {
+		return nil, false
+	}
+	m := &manifest{}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, false
+	}
+	return m, true
+}
+
+// removeAll removes the file or the directory p with its content, if it exists.
+func removeAll(fsys FS, p string) error {
+	fi, err := fs.Stat(fsys, p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fsys.Remove(p)
+	}
+	entries, err := fsys.ReadDir(p)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if isDotEntry(entry) {
+			continue
+		}
+		if err := removeAll(fsys, path.Join(p, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return fsys.Rmdir(p)
+}
+
+// isDotEntry reports whether entry is the "." or the ".." that the mounted filesystem lists.
+func isDotEntry(entry fs.DirEntry) bool {
+	return entry.Name() == "." || entry.Name() == ".."
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,257 @@
+package pkg
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/OutOfBedlam/jsh/engine"
+	"github.com/dop251/goja"
+)
+
+func TestRange(t *testing.T) {
+	tests := []struct {
+		rng     string
+		version string
+		match   bool
+	}{
+		{"1.2.3", "1.2.3", true},
+		{"1.2.3", "1.2.4", false},
+		{"=v1.2.3", "1.2.3", true},
+		{"^1.2.3", "1.9.0", true},
+		{"^1.2.3", "2.0.0", false},
+		{"^1.2.3", "1.2.2", false},
+		{"^0.2.3", "0.2.9", true},
+		{"^0.2.3", "0.3.0", false},
+		{"^0.0.3", "0.0.4", false},
+		{"^1.x", "1.0.0", true},
+		{"~1.2.3", "1.2.9", true},
+		{"~1.2.3", "1.3.0", false},
+		{"~1", "1.9.9", true},
+		{"1.x", "1.5.0", true},
+		{"1.x", "2.0.0", false},
+		{"1.2", "1.2.7", true},
+		{"*", "3.1.4", true},
+		{"", "0.0.1", true},
+		{"latest", "9.9.9", true},
+		{">=1.0.0 <2.0.0", "1.5.0", true},
+		{">=1.0.0 <2.0.0", "2.0.0", false},
+		{">= 1.0.0 < 2", "1.99.0", true},
+		{">1.2", "1.2.9", false},
+		{">1.2", "1.3.0", true},
+		{"<=1.2", "1.2.9", true},
+		{"<=1.2", "1.3.0", false},
+		{"1.0.0 - 1.4", "1.4.5", true},
+		{"1.0.0 - 1.4", "1.5.0", false},
+		{"^1.0.0 || ^3.0.0", "3.2.0", true},
+		{"^1.0.0 || ^3.0.0", "2.2.0", false},
+		{"^1.0.0", "1.3.0-beta.1", false},
+		{"^1.3.0-beta.1", "1.3.0-beta.2", true},
+		{"^1.3.0-beta.1", "1.3.0-alpha", false},
+		{"^1.3.0-beta.1", "1.4.0-beta.1", false},
+	}
+	for _, tc := range tests {
+		rng, err := ParseRange(tc.rng)
+		if err != nil {
+			t.Errorf("ParseRange(%q): %v", tc.rng, err)
+			continue
+		}
+		v, err := ParseVersion(tc.version)
+		if err != nil {
+			t.Errorf("ParseVersion(%q): %v", tc.version, err)
+			continue
+		}
+		if got := rng.Match(v); got != tc.match {
+			t.Errorf("%q.Match(%q) = %v, want %v", tc.rng, tc.version, got, tc.match)
+		}
+	}
+	for _, s := range []string{"1.2.3.4", "a.b.c", "^x-beta", ">>1.0.0"} {
+		if _, err := ParseRange(s); err == nil {
+			t.Errorf("ParseRange(%q) expected an error", s)
+		}
+	}
+}
+
+// writeTarball writes the files into the npm-packed tarball file, in its "package" directory.
+func writeTarball(t *testing.T, file string, files map[string]string) {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	zw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(zw)
+	for name, content := range files {
+		hdr := &tar.Header{Name: "package/" + name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the names that leave the package are ignored
+	evil := "module.exports = 'evil';"
+	tw.WriteHeader(&tar.Header{Name: "package/../../evil.js", Mode: 0644, Size: int64(len(evil)), Typeflag: tar.TypeReg})
+	tw.Write([]byte(evil))
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// run runs the command args, or the script if it is not empty, with /work in the directory work.
+func run(t *testing.T, work string, script string, args ...string) (string, int) {
+	t.Helper()
+	out := &bytes.Buffer{}
+	conf := engine.Config{
+		Name: "pkg_test",
+		Code: script,
+		Args: args,
+		FSTabs: []engine.FSTab{
+			{MountPoint: "/", Source: "../root/"},
+			{MountPoint: "/work", Source: work},
+			{MountPoint: "/test", Source: "../../test/"},
+		},
+		Env: map[string]any{
+			"PATH": "/sbin:/lib:/work",
+			"PWD":  "/work",
+		},
+		Reader: &bytes.Buffer{},
+		Writer: out,
+	}
+	jr, err := engine.New(conf)
+	if err != nil {
+		t.Fatalf("Failed to create JSRuntime: %v", err)
+	}
+	jr.RegisterNativeModule("@jsh/process", jr.Process)
+	jr.RegisterNativeModule("@jsh/pkg", Module)
+	code := 0
+	if err := jr.Run(); err != nil {
+		// process.exit() of the command
+		ie, ok := err.(*goja.InterruptedError)
+		if !ok {
+			t.Fatalf("Unexpected error: %v\n%s", err, out.String())
+		}
+		exit, ok := ie.Value().(engine.Exit)
+		if !ok {
+			t.Fatalf("Unexpected error: %v\n%s", err, out.String())
+		}
+		code = exit.Code
+	}
+	return out.String(), code
+}
+
+func TestInstall(t *testing.T) {
+	work := t.TempDir()
+	cache := filepath.Join(work, ".pkg-cache")
+	for _, version := range []string{"1.2.0", "2.0.0", "1.3.0-beta.1", "0.9.0"} {
+		writeTarball(t, filepath.Join(cache, "dep-a-"+version+".tgz"), map[string]string{
+			"package.json": `{"name": "dep-a", "version": "` + version + `"}`,
+			"index.js":     `module.exports = "dep-a@` + version + `";`,
+		})
+	}
+	writeFiles(t, filepath.Join(cache, "dep-b"), map[string]string{
+		"package.json":        `{"name": "dep-b", "version": "1.0.0", "dependencies": {"dep-a": "^2.0.0"}}`,
+		"index.js":            `module.exports = "dep-b with " + require("dep-a");`,
+		"node_modules/x/a.js": `not copied`,
+		".git/HEAD":           `not copied`,
+		"lib/nested/deep.js":  `module.exports = "deep";`,
+		"README.md":           `# dep-b`,
+	})
+	// the files of the cache that are not packages are ignored
+	writeFiles(t, cache, map[string]string{
+		"notes.txt": `not a package`,
+	})
+	writeTarball(t, filepath.Join(work, "dist", "app-lib-1.0.0.tgz"), map[string]string{
+		"package.json": `{"name": "app-lib", "version": "1.0.0", "main": "lib/index.js",
+			"dependencies": {"dep-a": "^1.0.0", "dep-b": "1.x"}}`,
+		"lib/index.js": `module.exports = [require("dep-a"), require("dep-b"), require("dep-b/lib/nested/deep")];`,
+	})
+	writeTarball(t, filepath.Join(work, "dist", "app-broken-1.0.0.tgz"), map[string]string{
+		"package.json": `{"name": "app-broken", "version": "1.0.0", "dependencies": {"nothing": "^1.0.0"}}`,
+	})
+
+	out, code := run(t, work, "", "pkg", "install", "dist/app-lib-1.0.0.tgz", "/test/node_modules/optparse")
+	expect := []string{
+		"added app-lib@1.0.0 /work/node_modules/app-lib",
+		"added dep-a@1.2.0 /work/node_modules/dep-a",
+		"added dep-b@1.0.0 /work/node_modules/dep-b",
+		"added dep-a@2.0.0 /work/node_modules/dep-b/node_modules/dep-a",
+		"added optparse@1.0.5 /work/node_modules/optparse",
+		"5 packages installed",
+		"",
+	}
+	if code != 0 || out != strings.Join(expect, "\n") {
+		t.Fatalf("install exited with %d:\n%s", code, out)
+	}
+	for _, name := range []string{"evil.js", "node_modules/evil.js", "node_modules/dep-b/node_modules/x", "node_modules/dep-b/.git"} {
+		if _, err := os.Stat(filepath.Join(work, filepath.FromSlash(name))); err == nil {
+			t.Errorf("%s should not be installed", name)
+		}
+	}
+
+	out, code = run(t, work, `
+		const app = require("app-lib");
+		const optparse = require("optparse");
+		console.println(app.join(", "));
+		console.println(typeof optparse.OptionParser);
+		const lock = JSON.parse(require("/lib/fs").readFileSync("/work/pkg-lock.json", "utf8"));
+		for (const [key, entry] of Object.entries(lock.packages)) {
+			console.println(key, entry.version, entry.resolved, entry.integrity ? entry.integrity.slice(0, 7) : "-");
+		}
+	`)
+	expect = []string{
+		"dep-a@1.2.0, dep-b with dep-a@2.0.0, deep",
+		"function",
+		"node_modules/app-lib 1.0.0 /work/dist/app-lib-1.0.0.tgz sha512-",
+		"node_modules/dep-a 1.2.0 /work/.pkg-cache/dep-a-1.2.0.tgz sha512-",
+		"node_modules/dep-b 1.0.0 /work/.pkg-cache/dep-b -",
+		"node_modules/dep-b/node_modules/dep-a 2.0.0 /work/.pkg-cache/dep-a-2.0.0.tgz sha512-",
+		"node_modules/optparse 1.0.5 /test/node_modules/optparse -",
+		"",
+	}
+	if code != 0 || out != strings.Join(expect, "\n") {
+		t.Fatalf("require exited with %d:\n%s", code, out)
+	}
+
+	// the dependencies of package.json, with the installed ones in their ranges kept
+	writeFiles(t, work, map[string]string{
+		"package.json": `{"name": "work", "dependencies": {"dep-a": "~1.2.0", "dep-b": "^1.0.0"}}`,
+	})
+	out, code = run(t, work, "", "pkg", "install")
+	if code != 0 || out != "0 packages installed\n" {
+		t.Fatalf("install of package.json exited with %d:\n%s", code, out)
+	}
+
+	out, code = run(t, work, "", "pkg", "install", "-c", "/work/.pkg-cache", "dist/app-broken-1.0.0.tgz")
+	if code != 1 || out != "pkg: app-broken@1.0.0: dependency nothing: no version in the range \"^1.0.0\" in the cache /work/.pkg-cache\n" {
+		t.Fatalf("broken install exited with %d:\n%s", code, out)
+	}
+	out, code = run(t, work, "", "pkg", "install", "dist/no-such.tgz")
+	if code != 1 || !strings.HasPrefix(out, "pkg: ") {
+		t.Fatalf("missing install exited with %d:\n%s", code, out)
+	}
+}
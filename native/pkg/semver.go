@@ -0,0 +1,305 @@
+package pkg
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a semantic version, like "1.2.3" or "1.0.0-beta.1".
+type Version struct {
+	Major, Minor, Patch int
+	Pre                 string // the prerelease, without the "-"
+}
+
+// ParseVersion parses the version s, a leading "v" or "=" is allowed.
+func ParseVersion(s string) (Version, error) {
+	v, n, err := parsePartial(s)
+	if err != nil {
+		return Version{}, err
+	}
+	if n < 3 {
+		return Version{}, fmt.Errorf("invalid version %q", s)
+	}
+	return v, nil
+}
+
+// parsePartial parses the version s that may lack the minor and the patch numbers,
+// or have "x", "X" or "*" for them, like the versions of the ranges.
+// It returns the number of the parts given, 0 for "*".
+func parsePartial(s string) (Version, int, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimLeft(s, "=v")
+	var v Version
+	if i := strings.Index(s, "+"); i >= 0 {
+		s = s[:i] // the build metadata does not count
+	}
+	if i := strings.Index(s, "-"); i >= 0 {
+		v.Pre = s[i+1:]
+		s = s[:i]
+	}
+	if s == "" {
+		return v, 0, nil
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return Version{}, 0, fmt.Errorf("invalid version %q", s)
+	}
+	nums := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, p := range parts {
+		if p == "x" || p == "X" || p == "*" {
+			if v.Pre != "" {
+				return Version{}, 0, fmt.Errorf("invalid version %q", s)
+			}
+			return v, i, nil
+		}
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return Version{}, 0, fmt.Errorf("invalid version %q", s)
+		}
+		*nums[i] = n
+	}
+	if v.Pre != "" && len(parts) < 3 {
+		return Version{}, 0, fmt.Errorf("invalid version %q", s)
+	}
+	return v, len(parts), nil
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Pre != "" {
+		s += "-" + v.Pre
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 as v is lower than, equal to or higher than o.
+// A prerelease is lower than its release.
+func (v Version) Compare(o Version) int {
+	for _, d := range []int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		if d < 0 {
+			return -1
+		} else if d > 0 {
+			return 1
+		}
+	}
+	switch {
+	case v.Pre == o.Pre:
+		return 0
+	case v.Pre == "":
+		return 1
+	case o.Pre == "":
+		return -1
+	}
+	return comparePre(v.Pre, o.Pre)
+}
+
+// comparePre compares the prereleases by their dot separated identifiers,
+// numerically if they are numbers.
+func comparePre(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				if an < bn {
+					return -1
+				}
+				return 1
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	}
+	return 0
+}
+
+// comparator is a primitive of a range, like ">=1.2.0".
+type comparator struct {
+	op string // one of ">=", ">", "<", "<=" and "="
+	v  Version
+}
+
+func (c comparator) test(v Version) bool {
+	d := v.Compare(c.v)
+	switch c.op {
+	case ">=":
+		return d >= 0
+	case ">":
+		return d > 0
+	case "<":
+		return d < 0
+	case "<=":
+		return d <= 0
+	}
+	return d == 0
+}
+
+// Range is a range of versions like the ones of the dependencies of package.json,
+// e.g. "^1.2.0", "~1.2", "1.x", ">=1.0.0 <2.0.0", "1.0.0 - 1.4.0" or "^1.0.0 || ^2.0.0".
+type Range struct {
+	sets [][]comparator // the versions in any of the sets, that satisfy all of its comparators
+}
+
+// ParseRange parses the range s. The empty range, "*" and "latest" match any release.
+func ParseRange(s string) (Range, error) {
+	var r Range
+	for _, set := range strings.Split(s, "||") {
+		set = strings.TrimSpace(set)
+		if set == "latest" {
+			set = ""
+		}
+		var cs []comparator
+		if lo, hi, ok := strings.Cut(set, " - "); ok {
+			from, err := expand(">=", lo)
+			if err != nil {
+				return Range{}, err
+			}
+			to, err := expand("<=", hi)
+			if err != nil {
+				return Range{}, err
+			}
+			cs = append(from, to...)
+		} else {
+			for _, f := range strings.Fields(joinOperators(set)) {
+				i := strings.IndexFunc(f, func(r rune) bool { return !strings.ContainsRune("<>=^~", r) })
+				if i < 0 {
+					return Range{}, fmt.Errorf("invalid range %q", s)
+				}
+				c, err := expand(f[:i], f[i:])
+				if err != nil {
+					return Range{}, err
+				}
+				cs = append(cs, c...)
+			}
+		}
+		r.sets = append(r.sets, cs)
+	}
+	return r, nil
+}
+
+// joinOperators removes the spaces after the operators, like ">= 1.2.0".
+func joinOperators(s string) string {
+	for _, op := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+		for strings.Contains(s, op+" ") {
+			s = strings.ReplaceAll(s, op+" ", op)
+		}
+	}
+	return s
+}
+
+// expand returns the comparators of the operator op and the partial version s.
+func expand(op, s string) ([]comparator, error) {
+	v, n, err := parsePartial(s)
+	if err != nil {
+		return nil, err
+	}
+	// the version next to the given parts, like 1.3.0 for 1.2
+	next := func(n int) Version {
+		switch n {
+		case 1:
+			return Version{Major: v.Major + 1}
+		case 2:
+			return Version{Major: v.Major, Minor: v.Minor + 1}
+		}
+		return Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch + 1}
+	}
+	lower := Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch, Pre: v.Pre}
+	if n == 0 {
+		switch op {
+		case "<", ">":
+			// nothing is lower or higher than any version
+			return []comparator{{op: "<", v: withPre(Version{})}}, nil
+		}
+		return nil, nil
+	}
+	switch op {
+	case "^":
+		// the changes that do not modify the left-most non-zero part
+		switch {
+		case v.Major > 0 || n == 1:
+			return []comparator{{">=", lower}, {"<", withPre(next(1))}}, nil
+		case v.Minor > 0 || n == 2:
+			return []comparator{{">=", lower}, {"<", withPre(next(2))}}, nil
+		}
+		return []comparator{{">=", lower}, {"<", withPre(next(3))}}, nil
+	case "~":
+		// the patches, or the minor versions if only the major is given
+		if n == 1 {
+			return []comparator{{">=", lower}, {"<", withPre(next(1))}}, nil
+		}
+		return []comparator{{">=", lower}, {"<", withPre(next(2))}}, nil
+	case ">=":
+		return []comparator{{">=", lower}}, nil
+	case ">":
+		if n < 3 {
+			return []comparator{{">=", next(n)}}, nil
+		}
+		return []comparator{{">", lower}}, nil
+	case "<":
+		if n < 3 {
+			lower = withPre(lower)
+		}
+		return []comparator{{"<", lower}}, nil
+	case "<=":
+		if n < 3 {
+			return []comparator{{"<", withPre(next(n))}}, nil
+		}
+		return []comparator{{"<=", lower}}, nil
+	case "", "=":
+		if n < 3 {
+			return []comparator{{">=", lower}, {"<", withPre(next(n))}}, nil
+		}
+		return []comparator{{"=", lower}}, nil
+	}
+	return nil, fmt.Errorf("invalid operator %q", op)
+}
+
+// withPre returns v with the lowest prerelease, so that the ranges below v exclude
+// the prereleases of v.
+func withPre(v Version) Version {
+	v.Pre = "0"
+	return v
+}
+
+// Match reports whether the version v is in the range.
+// A prerelease matches only the ranges with a prerelease of the same version, like npm.
+func (r Range) Match(v Version) bool {
+	for _, set := range r.sets {
+		if matchSet(set, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSet(set []comparator, v Version) bool {
+	for _, c := range set {
+		if !c.test(v) {
+			return false
+		}
+	}
+	if v.Pre == "" {
+		return true
+	}
+	for _, c := range set {
+		if c.v.Pre != "" && c.v.Pre != "0" && c.v.Major == v.Major && c.v.Minor == v.Minor && c.v.Patch == v.Patch {
+			return true
+		}
+	}
+	return false
+}
@@ -82,10 +82,11 @@ class EventEmitter {
             try {
                 listener.apply(this, args);
             } catch (err) {
-                // If there's an error listener, emit error event
+                // If there's an error listener, emit error event,
+                // otherwise it is an uncaught exception
                 if (event !== 'error' && this._events['error']) {
                     this.emit('error', err);
-                } else if (event === 'error') {
+                } else {
                     throw err;
                 }
             }
@@ -116,5 +117,7 @@ class EventEmitter {
     }
 }
 
+EventEmitter.EventEmitter = EventEmitter;
+
 module.exports = EventEmitter;
 
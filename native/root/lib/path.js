@@ -0,0 +1,195 @@
+'use strict';
+
+/**
+ * path module - Node.js path module compatible interface for jsh
+ *
+ * The paths of jsh are the POSIX paths of its virtual filesystem,
+ * the relative paths are resolved from the current directory, PWD.
+ */
+
+const process = require('/lib/process');
+
+const sep = '/';
+const delimiter = ':';
+
+function assertPath(p) {
+    if (typeof p !== 'string') {
+        throw new TypeError(`The "path" argument must be of type string. Received ${typeof p}`);
+    }
+}
+
+function cwd() {
+    return process.env.get("PWD") || process.cwd();
+}
+
+// normalizeSegments resolves "." and ".." of the segments of a path
+function normalizeSegments(p, allowAboveRoot) {
+    const ret = [];
+    for (const seg of p.split('/')) {
+        if (seg === '' || seg === '.') {
+            continue;
+        }
+        if (seg === '..') {
+            if (ret.length > 0 && ret[ret.length - 1] !== '..') {
+                ret.pop();
+            } else if (allowAboveRoot) {
+                ret.push('..');
+            }
+            continue;
+        }
+        ret.push(seg);
+    }
+    return ret.join('/');
+}
+
+function normalize(p) {
+    assertPath(p);
+    if (p.length === 0) {
+        return '.';
+    }
+    const absolute = isAbsolute(p);
+    const trailingSep = p.endsWith('/');
+    let ret = normalizeSegments(p, !absolute);
+    if (ret.length === 0) {
+        return absolute ? '/' : (trailingSep ? './' : '.');
+    }
+    if (trailingSep) {
+        ret += '/';
+    }
+    return absolute ? '/' + ret : ret;
+}
+
+function isAbsolute(p) {
+    assertPath(p);
+    return p.startsWith('/');
+}
+
+function join(...paths) {
+    const parts = [];
+    for (const p of paths) {
+        assertPath(p);
+        if (p.length > 0) {
+            parts.push(p);
+        }
+    }
+    if (parts.length === 0) {
+        return '.';
+    }
+    return normalize(parts.join('/'));
+}
+
+function resolve(...paths) {
+    let ret = '';
+    for (let i = paths.length - 1; i >= 0 && !ret.startsWith('/'); i--) {
+        assertPath(paths[i]);
+        if (paths[i].length > 0) {
+            ret = ret.length > 0 ? paths[i] + '/' + ret : paths[i];
+        }
+    }
+    if (!ret.startsWith('/')) {
+        ret = cwd() + '/' + ret;
+    }
+    return '/' + normalizeSegments(ret, false);
+}
+
+function relative(from, to) {
+    assertPath(from);
+    assertPath(to);
+    const fromParts = resolve(from).split('/').filter(s => s);
+    const toParts = resolve(to).split('/').filter(s => s);
+    let i = 0;
+    while (i < fromParts.length && i < toParts.length && fromParts[i] === toParts[i]) {
+        i++;
+    }
+    return fromParts.slice(i).map(() => '..').concat(toParts.slice(i)).join('/');
+}
+
+function dirname(p) {
+    assertPath(p);
+    if (p.length === 0) {
+        return '.';
+    }
+    let end = p.length;
+    while (end > 1 && p[end - 1] === '/') {
+        end--;
+    }
+    const idx = p.lastIndexOf('/', end - 1);
+    if (idx < 0) {
+        return '.';
+    }
+    if (idx === 0) {
+        return '/';
+    }
+    let ret = p.slice(0, idx);
+    while (ret.length > 1 && ret.endsWith('/')) {
+        ret = ret.slice(0, -1);
+    }
+    return ret;
+}
+
+function basename(p, ext) {
+    assertPath(p);
+    let end = p.length;
+    while (end > 0 && p[end - 1] === '/') {
+        end--;
+    }
+    let ret = p.slice(p.lastIndexOf('/', end - 1) + 1, end);
+    if (ext !== undefined && ret !== ext && ret.endsWith(ext)) {
+        ret = ret.slice(0, ret.length - ext.length);
+    }
+    return ret;
+}
+
+function extname(p) {
+    const base = basename(p);
+    const idx = base.lastIndexOf('.');
+    if (idx <= 0) {
+        return '';
+    }
+    return base.slice(idx);
+}
+
+function parse(p) {
+    assertPath(p);
+    const root = p.startsWith('/') ? '/' : '';
+    const base = basename(p);
+    const ext = extname(p);
+    let dir = dirname(p);
+    if (dir === '.' && !p.startsWith('.')) {
+        dir = '';
+    }
+    return {
+        root,
+        dir,
+        base,
+        ext,
+        name: ext ? base.slice(0, base.length - ext.length) : base,
+    };
+}
+
+function format(obj) {
+    const dir = obj.dir || obj.root || '';
+    const base = obj.base || ((obj.name || '') + (obj.ext || ''));
+    if (!dir) {
+        return base;
+    }
+    return dir === obj.root ? dir + base : dir + sep + base;
+}
+
+const path = {
+    sep,
+    delimiter,
+    normalize,
+    isAbsolute,
+    join,
+    resolve,
+    relative,
+    dirname,
+    basename,
+    extname,
+    parse,
+    format,
+};
+path.posix = path;
+
+module.exports = path;
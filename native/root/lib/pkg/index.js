@@ -0,0 +1,30 @@
+'use strict';
+
+const _pkg = require('@jsh/pkg');
+const process = require('/lib/process');
+const path = require('/lib/path');
+
+const defaults = {
+    dir: '/work/node_modules',
+    cache: '/work/.pkg-cache',
+};
+
+// install(sources[, options]) installs the packages of the npm-packed tarballs
+// or the package directories sources, and their dependencies from the cache.
+//  - sources: string[], the dependencies of the package.json next to options.dir if empty
+//  - options.dir: the node_modules directory (default: /work/node_modules)
+//  - options.cache: the directory of the packages of the dependencies (default: $PKG_CACHE or /work/.pkg-cache)
+//  - options.lock: the lock file (default: pkg-lock.json next to options.dir)
+// returns the installed packages, [{ name, version, path, resolved }]
+function install(sources, options = {}) {
+    return _pkg.install(process.env.filesystem(), (sources || []).map((s) => path.resolve(s)), {
+        dir: path.resolve(options.dir || defaults.dir),
+        cache: path.resolve(options.cache || process.env.get('PKG_CACHE') || defaults.cache),
+        lock: options.lock ? path.resolve(options.lock) : '',
+    });
+}
+
+module.exports = {
+    defaults,
+    install,
+};
@@ -18,7 +18,160 @@ class Process extends EventEmitter {
             }
         }
     }
+
+    // the listeners of the signal events, like 'SIGINT', receive the signals of the process
+    on(event, listener) {
+        super.on(event, listener);
+        if (isSignal(event)) {
+            _process.watchSignal(this, event);
+        }
+        return this;
+    }
+
+    removeListener(event, listener) {
+        super.removeListener(event, listener);
+        if (isSignal(event) && this.listenerCount(event) === 0) {
+            _process.unwatchSignal(event);
+        }
+        return this;
+    }
+
+    removeAllListeners(event) {
+        const events = event === undefined ? this.eventNames() : [event];
+        super.removeAllListeners(event);
+        for (const name of events) {
+            if (isSignal(name)) {
+                _process.unwatchSignal(name);
+            }
+        }
+        return this;
+    }
+}
+
+// Stdin reads process.stdin by the blocking methods, like readLine(),
+// or by the 'data' and 'end' events, which start when the first 'data' listener is added.
+class Stdin extends EventEmitter {
+    constructor(stdin) {
+        super();
+        this._stdin = stdin;
+        for (const key of Object.keys(stdin)) {
+            if (!(key in this)) {
+                this[key] = stdin[key];
+            }
+        }
+    }
+
+    on(event, listener) {
+        super.on(event, listener);
+        if (event === 'data') {
+            this.resume();
+        }
+        return this;
+    }
+
+    setEncoding(encoding) {
+        this._stdin.setEncoding(encoding);
+        return this;
+    }
+
+    resume() {
+        this._stdin.flow(this);
+        return this;
+    }
+
+    pause() {
+        this._stdin.pause();
+        return this;
+    }
+
+    // lines returns an async iterator over the lines of stdin, without the line terminators.
+    // The input is paused while no line is requested by next().
+    lines() {
+        const stdin = this;
+        const lines = [];
+        const waiting = [];
+        let partial = '';
+        let ended = false;
+        let failure = null;
+
+        const settle = () => {
+            while (waiting.length > 0 && (lines.length > 0 || ended || failure)) {
+                const { resolve, reject } = waiting.shift();
+                if (lines.length > 0) {
+                    resolve({ value: lines.shift(), done: false });
+                } else if (failure) {
+                    reject(failure);
+                } else {
+                    resolve({ value: undefined, done: true });
+                }
+            }
+            if (waiting.length === 0 && !ended) {
+                stdin.pause();
+            }
+        };
+        const onData = (chunk) => {
+            const parts = (partial + chunk).split('\n');
+            partial = parts.pop();
+            for (const line of parts) {
+                lines.push(line.endsWith('\r') ? line.slice(0, -1) : line);
+            }
+            settle();
+        };
+        const onEnd = () => {
+            if (partial !== '') {
+                lines.push(partial.endsWith('\r') ? partial.slice(0, -1) : partial);
+                partial = '';
+            }
+            ended = true;
+            cleanup();
+            settle();
+        };
+        const onError = (err) => {
+            failure = err;
+            cleanup();
+            settle();
+        };
+        const cleanup = () => {
+            stdin.removeListener('data', onData);
+            stdin.removeListener('end', onEnd);
+            stdin.removeListener('error', onError);
+        };
+
+        this.setEncoding('utf8');
+        this.on('end', onEnd);
+        this.on('error', onError);
+        this.on('data', onData);
+        return {
+            next() {
+                return new Promise((resolve, reject) => {
+                    waiting.push({ resolve, reject });
+                    if (lines.length === 0 && !ended && !failure) {
+                        stdin.resume();
+                    }
+                    settle();
+                });
+            },
+            return() {
+                ended = true;
+                cleanup();
+                stdin.pause();
+                return Promise.resolve({ value: undefined, done: true });
+            },
+            [Symbol.asyncIterator]() {
+                return this;
+            },
+        };
+    }
+
+    [Symbol.asyncIterator]() {
+        return this.lines();
+    }
+}
+
+function isSignal(event) {
+    return typeof event === 'string' && Object.prototype.hasOwnProperty.call(_process.signals, event);
 }
 
 const p = new Process();
+p.stdin = new Stdin(_process.stdin);
 module.exports = p;
\ No newline at end of file
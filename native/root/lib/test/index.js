@@ -0,0 +1,620 @@
+'use strict';
+
+/**
+ * test module - a test runner for jsh scripts
+ *
+ * The tests are declared by describe() and it(), then run by run(),
+ * which returns the results that tap() and junit() report.
+ * The command "jsh test" declares the tests of the *.test.js files and runs them.
+ */
+
+class AssertionError extends Error {
+    constructor(options) {
+        super(options.message);
+        this.name = 'AssertionError';
+        this.actual = options.actual;
+        this.expected = options.expected;
+        this.operator = options.operator;
+    }
+}
+
+function inspect(value) {
+    if (typeof value === 'string') {
+        return JSON.stringify(value);
+    }
+    if (typeof value === 'function') {
+        return `[Function ${value.name || 'anonymous'}]`;
+    }
+    if (typeof value === 'bigint') {
+        return `${value}n`;
+    }
+    if (value instanceof Error) {
+        return `${value.name}: ${value.message}`;
+    }
+    try {
+        const s = JSON.stringify(value);
+        return s === undefined ? String(value) : s;
+    } catch (e) {
+        return String(value);
+    }
+}
+
+function fail(actual, expected, message, operator) {
+    if (message instanceof Error) {
+        throw message;
+    }
+    throw new AssertionError({
+        message: message || `${inspect(actual)} ${operator} ${inspect(expected)}`,
+        actual,
+        expected,
+        operator,
+    });
+}
+
+function isDeepEqual(a, b, strict, seen) {
+    if (strict ? Object.is(a, b) : (a == b || (a !== a && b !== b))) {
+        return true;
+    }
+    if (typeof a !== 'object' || typeof b !== 'object' || a === null || b === null) {
+        return false;
+    }
+    if (strict && Object.getPrototypeOf(a) !== Object.getPrototypeOf(b)) {
+        return false;
+    }
+    if (a instanceof Date && b instanceof Date) {
+        return a.getTime() === b.getTime();
+    }
+    if (a instanceof RegExp && b instanceof RegExp) {
+        return a.source === b.source && a.flags === b.flags;
+    }
+    seen = seen || [];
+    for (const [x, y] of seen) {
+        if (x === a && y === b) {
+            return true;
+        }
+    }
+    seen.push([a, b]);
+    if (a instanceof Map && b instanceof Map) {
+        if (a.size !== b.size) {
+            return false;
+        }
+        for (const [k, v] of a) {
+            if (!b.has(k) || !isDeepEqual(v, b.get(k), strict, seen)) {
+                return false;
+            }
+        }
+        return true;
+    }
+    if (a instanceof Set && b instanceof Set) {
+        if (a.size !== b.size) {
+            return false;
+        }
+        for (const v of a) {
+            if (!b.has(v)) {
+                return false;
+            }
+        }
+        return true;
+    }
+    if (Array.isArray(a) !== Array.isArray(b)) {
+        return false;
+    }
+    const keysA = Object.keys(a);
+    const keysB = Object.keys(b);
+    if (keysA.length !== keysB.length) {
+        return false;
+    }
+    for (const key of keysA) {
+        if (!Object.prototype.hasOwnProperty.call(b, key) || !isDeepEqual(a[key], b[key], strict, seen)) {
+            return false;
+        }
+    }
+    return true;
+}
+
+// matchesError checks the error thrown against the expected of throws() and rejects(),
+// which is a constructor, a RegExp of the message, a validation function or an object of properties.
+function matchesError(err, expected, message) {
+    if (expected === undefined) {
+        return;
+    }
+    if (expected instanceof RegExp) {
+        if (!expected.test(String(err && err.message !== undefined ? err.message : err))) {
+            fail(err, expected, message || `The error ${inspect(err)} does not match ${expected}`, 'throws');
+        }
+    } else if (typeof expected === 'function') {
+        if (expected === Error || expected.prototype instanceof Error) {
+            if (!(err instanceof expected)) {
+                fail(err, expected, message || `The error ${inspect(err)} is not an instance of ${expected.name}`, 'throws');
+            }
+        } else if (expected(err) !== true) {
+            fail(err, expected, message || `The error ${inspect(err)} is not valid`, 'throws');
+        }
+    } else if (typeof expected === 'object' && expected !== null) {
+        for (const key of Object.keys(expected)) {
+            const want = expected[key];
+            const got = err ? err[key] : undefined;
+            if (want instanceof RegExp ? !want.test(String(got)) : !isDeepEqual(got, want, true)) {
+                fail(err, expected, message || `The error ${key} ${inspect(got)} is not ${inspect(want)}`, 'throws');
+            }
+        }
+    }
+}
+
+function assert(value, message) {
+    if (!value) {
+        fail(value, true, message || `${inspect(value)} == true`, '==');
+    }
+}
+
+assert.AssertionError = AssertionError;
+assert.ok = assert;
+
+assert.fail = function (message) {
+    fail(undefined, undefined, message || 'Failed', 'fail');
+};
+
+assert.equal = function (actual, expected, message) {
+    if (!(actual == expected || (actual !== actual && expected !== expected))) {
+        fail(actual, expected, message, '==');
+    }
+};
+
+assert.notEqual = function (actual, expected, message) {
+    if (actual == expected || (actual !== actual && expected !== expected)) {
+        fail(actual, expected, message, '!=');
+    }
+};
+
+assert.strictEqual = function (actual, expected, message) {
+    if (!Object.is(actual, expected)) {
+        fail(actual, expected, message, '===');
+    }
+};
+
+assert.notStrictEqual = function (actual, expected, message) {
+    if (Object.is(actual, expected)) {
+        fail(actual, expected, message, '!==');
+    }
+};
+
+assert.deepEqual = function (actual, expected, message) {
+    if (!isDeepEqual(actual, expected, false)) {
+        fail(actual, expected, message, 'deepEqual');
+    }
+};
+
+assert.notDeepEqual = function (actual, expected, message) {
+    if (isDeepEqual(actual, expected, false)) {
+        fail(actual, expected, message, 'notDeepEqual');
+    }
+};
+
+assert.deepStrictEqual = function (actual, expected, message) {
+    if (!isDeepEqual(actual, expected, true)) {
+        fail(actual, expected, message, 'deepStrictEqual');
+    }
+};
+
+assert.notDeepStrictEqual = function (actual, expected, message) {
+    if (isDeepEqual(actual, expected, true)) {
+        fail(actual, expected, message, 'notDeepStrictEqual');
+    }
+};
+
+assert.match = function (string, regexp, message) {
+    if (!regexp.test(string)) {
+        fail(string, regexp, message, 'match');
+    }
+};
+
+assert.doesNotMatch = function (string, regexp, message) {
+    if (regexp.test(string)) {
+        fail(string, regexp, message, 'doesNotMatch');
+    }
+};
+
+assert.throws = function (fn, expected, message) {
+    if (typeof expected === 'string') {
+        message = expected;
+        expected = undefined;
+    }
+    try {
+        fn();
+    } catch (err) {
+        matchesError(err, expected, message);
+        return;
+    }
+    fail(undefined, expected, message || 'Missing expected exception', 'throws');
+};
+
+assert.doesNotThrow = function (fn, message) {
+    try {
+        fn();
+    } catch (err) {
+        fail(err, undefined, message || `Got unwanted exception: ${inspect(err)}`, 'doesNotThrow');
+    }
+};
+
+assert.rejects = async function (promiseOrFn, expected, message) {
+    if (typeof expected === 'string') {
+        message = expected;
+        expected = undefined;
+    }
+    try {
+        await (typeof promiseOrFn === 'function' ? promiseOrFn() : promiseOrFn);
+    } catch (err) {
+        matchesError(err, expected, message);
+        return;
+    }
+    fail(undefined, expected, message || 'Missing expected rejection', 'rejects');
+};
+
+assert.doesNotReject = async function (promiseOrFn, message) {
+    try {
+        await (typeof promiseOrFn === 'function' ? promiseOrFn() : promiseOrFn);
+    } catch (err) {
+        fail(err, undefined, message || `Got unwanted rejection: ${inspect(err)}`, 'doesNotReject');
+    }
+};
+
+// Suite is a group of tests declared by describe(), or the tests of a file.
+class Suite {
+    constructor(name, parent, options) {
+        this.name = name;
+        this.parent = parent;
+        this.skip = !!(options.skip || (parent && parent.skip));
+        this.file = options.file || (parent ? parent.file : undefined);
+        this.children = []; // Suite or Test
+        this.beforeEach = [];
+        this.afterEach = [];
+        this.error = undefined;
+    }
+
+    titles() {
+        const ret = this.parent ? this.parent.titles() : [];
+        if (this.parent && !this.isFile) {
+            ret.push(this.name);
+        }
+        return ret;
+    }
+}
+
+class Test {
+    constructor(name, fn, suite, options) {
+        this.name = name;
+        this.fn = fn;
+        this.suite = suite;
+        this.skip = !!(options.skip || suite.skip || !fn);
+        this.timeout = options.timeout;
+    }
+}
+
+const root = new Suite('', undefined, {});
+let current = root;
+
+function declare(suite, fn) {
+    const prev = current;
+    current = suite;
+    try {
+        if (fn) {
+            fn();
+        }
+    } catch (err) {
+        suite.error = err;
+    } finally {
+        current = prev;
+    }
+    return suite;
+}
+
+function describe(name, fn, options) {
+    const suite = new Suite(name, current, options || {});
+    current.children.push(suite);
+    return declare(suite, fn);
+}
+
+describe.skip = function (name, fn) {
+    return describe(name, fn, { skip: true });
+};
+
+function it(name, fn, options) {
+    if (typeof fn === 'object' && fn !== null) {
+        [fn, options] = [options, fn];
+    }
+    const t = new Test(name, fn, current, options || {});
+    current.children.push(t);
+    return t;
+}
+
+it.skip = function (name, fn) {
+    return it(name, fn, { skip: true });
+};
+
+function beforeEach(fn) {
+    current.beforeEach.push(fn);
+}
+
+function afterEach(fn) {
+    current.afterEach.push(fn);
+}
+
+// file declares the tests of the file by calling fn, like describe() does.
+// The failure of fn, like a syntax error of the file, is reported as a failed test.
+function file(name, fn) {
+    const suite = new Suite(name, root, { file: name });
+    suite.isFile = true;
+    root.children.push(suite);
+    return declare(suite, fn);
+}
+
+// call calls fn and waits for it: the promise it returns, or the callback done
+// if it declares a parameter. It fails if that takes longer than timeout milliseconds.
+function call(fn, ctx, timeout) {
+    return new Promise((resolve, reject) => {
+        let timer;
+        const settle = (err) => {
+            if (timer !== undefined) {
+                clearTimeout(timer);
+            }
+            if (err) {
+                reject(err);
+            } else {
+                resolve();
+            }
+        };
+        if (timeout > 0) {
+            timer = setTimeout(() => {
+                timer = undefined;
+                reject(new Error(`Timeout of ${timeout}ms exceeded`));
+            }, timeout);
+        }
+        try {
+            if (fn.length > 0) {
+                fn.call(ctx, (err) => settle(err));
+            } else {
+                const ret = fn.call(ctx);
+                if (ret && typeof ret.then === 'function') {
+                    ret.then(() => settle(), (err) => settle(err || new Error('Promise rejected')));
+                } else {
+                    settle();
+                }
+            }
+        } catch (err) {
+            settle(err);
+        }
+    });
+}
+
+function hooks(suite, name) {
+    const ret = [];
+    for (let s = suite; s; s = s.parent) {
+        ret.unshift(s[name]);
+    }
+    return ret;
+}
+
+async function runTest(t, options, results) {
+    const result = {
+        name: t.name,
+        titles: t.suite.titles(),
+        file: t.suite.file,
+        status: 'pass',
+        duration: 0,
+    };
+    results.push(result);
+    if (t.skip) {
+        result.status = 'skip';
+        return;
+    }
+    const timeout = t.timeout !== undefined ? t.timeout : options.timeout;
+    const ctx = {};
+    const start = Date.now();
+    try {
+        for (const fns of hooks(t.suite, 'beforeEach')) {
+            for (const fn of fns) {
+                await call(fn, ctx, timeout);
+            }
+        }
+        await call(t.fn, ctx, timeout);
+    } catch (err) {
+        result.status = 'fail';
+        result.error = err;
+    }
+    for (const fns of hooks(t.suite, 'afterEach').reverse()) {
+        for (const fn of fns) {
+            try {
+                await call(fn, ctx, timeout);
+            } catch (err) {
+                if (result.status !== 'fail') {
+                    result.status = 'fail';
+                    result.error = err;
+                }
+            }
+        }
+    }
+    result.duration = Date.now() - start;
+}
+
+async function runSuite(suite, options, results) {
+    if (suite.error !== undefined) {
+        results.push({
+            name: suite.isFile ? 'load' : suite.name,
+            titles: suite.isFile ? [] : suite.parent.titles(),
+            file: suite.file,
+            status: 'fail',
+            error: suite.error,
+            duration: 0,
+        });
+    }
+    for (const child of suite.children) {
+        if (child instanceof Suite) {
+            await runSuite(child, options, results);
+        } else {
+            await runTest(child, options, results);
+        }
+    }
+}
+
+/**
+ * Run the tests declared so far.
+ * @param {object} options - Options (timeout: milliseconds of each test and hook, 5000 by default)
+ * @returns {Promise<object>} The results: { tests: [...], pass, fail, skip, duration }
+ */
+async function run(options) {
+    options = Object.assign({ timeout: 5000 }, options);
+    const tests = [];
+    const start = Date.now();
+    await runSuite(root, options, tests);
+    return {
+        tests,
+        pass: tests.filter((r) => r.status === 'pass').length,
+        fail: tests.filter((r) => r.status === 'fail').length,
+        skip: tests.filter((r) => r.status === 'skip').length,
+        duration: Date.now() - start,
+    };
+}
+
+// reset forgets the tests declared so far.
+function reset() {
+    root.children = [];
+    root.beforeEach = [];
+    root.afterEach = [];
+    current = root;
+}
+
+function fullName(r) {
+    return r.titles.concat([r.name]).join(' > ');
+}
+
+function errorMessage(err) {
+    if (err instanceof Error) {
+        return err.message;
+    }
+    return String(err);
+}
+
+function errorStack(err) {
+    if (err instanceof Error && err.stack) {
+        return String(err.stack);
+    }
+    return errorMessage(err);
+}
+
+function yamlString(s) {
+    return JSON.stringify(String(s));
+}
+
+/**
+ * Report the results in the Test Anything Protocol, version 13.
+ * @param {object} results - The results of run()
+ * @returns {string} The report
+ */
+function tap(results) {
+    const lines = ['TAP version 13'];
+    let file;
+    results.tests.forEach((r, i) => {
+        if (r.file !== file) {
+            file = r.file;
+            if (file !== undefined) {
+                lines.push(`# ${file}`);
+            }
+        }
+        const name = fullName(r).replace(/#/g, '\\#');
+        if (r.status === 'skip') {
+            lines.push(`ok ${i + 1} - ${name} # SKIP`);
+        } else if (r.status === 'pass') {
+            lines.push(`ok ${i + 1} - ${name}`);
+        } else {
+            lines.push(`not ok ${i + 1} - ${name}`);
+            lines.push('  ---');
+            lines.push(`  message: ${yamlString(errorMessage(r.error))}`);
+            if (r.error && r.error.operator !== undefined) {
+                lines.push(`  operator: ${r.error.operator}`);
+                lines.push(`  expected: ${yamlString(inspect(r.error.expected))}`);
+                lines.push(`  actual: ${yamlString(inspect(r.error.actual))}`);
+            }
+            lines.push('  ...');
+        }
+    });
+    lines.push(`1..${results.tests.length}`);
+    lines.push(`# tests ${results.tests.length}`);
+    lines.push(`# pass ${results.pass}`);
+    lines.push(`# fail ${results.fail}`);
+    lines.push(`# skip ${results.skip}`);
+    return lines.join('\n') + '\n';
+}
+
+function xmlEscape(s) {
+    return String(s)
+        .replace(/&/g, '&amp;')
+        .replace(/</g, '&lt;')
+        .replace(/>/g, '&gt;')
+        .replace(/"/g, '&quot;')
+        .replace(/'/g, '&apos;');
+}
+
+function seconds(ms) {
+    return (ms / 1000).toFixed(3);
+}
+
+/**
+ * Report the results in the JUnit XML format, a testsuite for each file.
+ * @param {object} results - The results of run()
+ * @param {object} options - Options (name: the name of the testsuites, "jsh test" by default)
+ * @returns {string} The report
+ */
+function junit(results, options) {
+    const name = (options && options.name) || 'jsh test';
+    const suites = [];
+    for (const r of results.tests) {
+        const file = r.file !== undefined ? r.file : name;
+        let suite = suites.find((s) => s.name === file);
+        if (!suite) {
+            suite = { name: file, tests: [] };
+            suites.push(suite);
+        }
+        suite.tests.push(r);
+    }
+    const lines = ['<?xml version="1.0" encoding="UTF-8"?>'];
+    lines.push(`<testsuites name="${xmlEscape(name)}" tests="${results.tests.length}" failures="${results.fail}" skipped="${results.skip}" time="${seconds(results.duration)}">`);
+    for (const suite of suites) {
+        const failures = suite.tests.filter((r) => r.status === 'fail').length;
+        const skipped = suite.tests.filter((r) => r.status === 'skip').length;
+        const time = suite.tests.reduce((sum, r) => sum + r.duration, 0);
+        lines.push(`  <testsuite name="${xmlEscape(suite.name)}" tests="${suite.tests.length}" failures="${failures}" skipped="${skipped}" time="${seconds(time)}">`);
+        for (const r of suite.tests) {
+            const attrs = `classname="${xmlEscape([suite.name].concat(r.titles).join('.'))}" name="${xmlEscape(r.name)}" time="${seconds(r.duration)}"`;
+            if (r.status === 'pass') {
+                lines.push(`    <testcase ${attrs}/>`);
+            } else if (r.status === 'skip') {
+                lines.push(`    <testcase ${attrs}>`);
+                lines.push('      <skipped/>');
+                lines.push('    </testcase>');
+            } else {
+                const type = r.error && r.error.name ? r.error.name : 'Error';
+                lines.push(`    <testcase ${attrs}>`);
+                lines.push(`      <failure message="${xmlEscape(errorMessage(r.error))}" type="${xmlEscape(type)}">${xmlEscape(errorStack(r.error))}</failure>`);
+                lines.push('    </testcase>');
+            }
+        }
+        lines.push('  </testsuite>');
+    }
+    lines.push('</testsuites>');
+    return lines.join('\n') + '\n';
+}
+
+module.exports = {
+    describe,
+    it,
+    test: it,
+    beforeEach,
+    afterEach,
+    assert,
+    AssertionError,
+    file,
+    run,
+    reset,
+    tap,
+    junit,
+};
@@ -0,0 +1,101 @@
+'use strict';
+
+const EventEmitter = require('/lib/events');
+const _worker = require('@jsh/worker');
+
+// Worker runs a script in a separate runtime with its own event loop.
+// It emits 'message' for the messages posted by the worker,
+// 'error' for the exception that stopped it, and 'exit' with its exit code.
+class Worker extends EventEmitter {
+    constructor(filename, options) {
+        super();
+        const handle = _worker.start(this, filename, options || {});
+        if (handle instanceof Error) {
+            throw handle;
+        }
+        this._handle = handle;
+        this.threadId = handle.threadId();
+        this.once('exit', () => {
+            this._exited = true;
+        });
+    }
+
+    postMessage(value) {
+        const err = this._handle.postMessage(value);
+        if (err instanceof Error) {
+            throw err;
+        }
+    }
+
+    // terminate stops the worker, the returned promise resolves with its exit code.
+    terminate() {
+        if (this._exited) {
+            return Promise.resolve(undefined);
+        }
+        const exited = new Promise((resolve) => this.once('exit', resolve));
+        this._handle.terminate();
+        return exited;
+    }
+
+    ref() {
+        this._handle.ref();
+        return this;
+    }
+
+    unref() {
+        this._handle.unref();
+        return this;
+    }
+}
+
+// ParentPort is the port of a worker to the Worker that started it.
+// The worker keeps running while it listens to the 'message' events.
+class ParentPort extends EventEmitter {
+    constructor(port) {
+        super();
+        this._port = port;
+    }
+
+    on(event, listener) {
+        super.on(event, listener);
+        if (event === 'message') {
+            this._port.start(this);
+        }
+        return this;
+    }
+
+    removeListener(event, listener) {
+        super.removeListener(event, listener);
+        if (event === 'message' && this.listenerCount('message') === 0) {
+            this._port.close();
+        }
+        return this;
+    }
+
+    removeAllListeners(event) {
+        super.removeAllListeners(event);
+        if (this.listenerCount('message') === 0) {
+            this._port.close();
+        }
+        return this;
+    }
+
+    postMessage(value) {
+        const err = this._port.postMessage(value);
+        if (err instanceof Error) {
+            throw err;
+        }
+    }
+
+    close() {
+        this._port.close();
+    }
+}
+
+module.exports = {
+    Worker,
+    isMainThread: _worker.isMainThread,
+    parentPort: _worker.parentPort ? new ParentPort(_worker.parentPort) : null,
+    workerData: _worker.workerData,
+    threadId: _worker.threadId,
+};
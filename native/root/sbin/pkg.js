@@ -0,0 +1,48 @@
+(() => {
+    const process = require("/lib/process");
+    const { parseArgs } = require("/lib/util/parseArgs");
+    const pkg = require("/lib/pkg");
+
+    const { values, positionals } = parseArgs(process.argv.slice(2), {
+        options: {
+            dir: { type: 'string', short: 'd', default: pkg.defaults.dir },
+            cache: { type: 'string', short: 'c' },
+            lock: { type: 'string', short: 'l' },
+            help: { type: 'boolean', short: 'h', default: false }
+        },
+        strict: false,
+        allowPositionals: true
+    });
+
+    const [command, ...sources] = positionals;
+    if (values.help || command === undefined) {
+        console.println("Usage: pkg install [options] [<file.tgz|dir>...]");
+        console.println("");
+        console.println("Installs the packages of the npm-packed tarballs or the directories,");
+        console.println("or the dependencies of package.json, with their dependencies from the cache.");
+        console.println("");
+        console.println("Options:");
+        console.println(`  -d, --dir <dir>     node_modules directory (default: ${pkg.defaults.dir})`);
+        console.println(`  -c, --cache <dir>   directory of the packages of the dependencies (default: $PKG_CACHE or ${pkg.defaults.cache})`);
+        console.println("  -l, --lock <file>   lock file (default: pkg-lock.json next to the node_modules directory)");
+        if (!values.help) {
+            process.exit(2);
+        }
+        return;
+    }
+    if (command !== "install" && command !== "i") {
+        console.println(`pkg: unknown command '${command}'`);
+        process.exit(2);
+    }
+
+    try {
+        const installed = pkg.install(sources, values);
+        for (const p of installed) {
+            console.println(`added ${p.name}@${p.version} ${p.path}`);
+        }
+        console.println(`${installed.length} package${installed.length === 1 ? "" : "s"} installed`);
+    } catch (e) {
+        console.println(`pkg: ${e.message}`);
+        process.exit(1);
+    }
+})()
@@ -0,0 +1,89 @@
+(() => {
+    const process = require("/lib/process");
+    const fs = require("/lib/fs");
+    const { parseArgs } = require("/lib/util/parseArgs");
+    const test = require("/lib/test");
+
+    const { values, positionals } = parseArgs(process.argv.slice(2), {
+        options: {
+            reporter: { type: 'string', short: 'r', default: 'tap' },
+            output: { type: 'string', short: 'o' },
+            timeout: { type: 'string', short: 't', default: '5000' },
+            help: { type: 'boolean', short: 'h', default: false }
+        },
+        strict: false,
+        allowPositionals: true
+    });
+
+    if (values.help) {
+        console.println("Usage: test [options] [paths...]");
+        console.println("");
+        console.println("Runs the tests of the *.test.js files in the paths, the current directory by default.");
+        console.println("");
+        console.println("Options:");
+        console.println("  -r, --reporter <tap|junit>  Report format (default: tap)");
+        console.println("  -o, --output <file>         Write the report to the file");
+        console.println("  -t, --timeout <ms>          Timeout of each test (default: 5000)");
+        return;
+    }
+    if (values.reporter !== 'tap' && values.reporter !== 'junit') {
+        console.println(`test: unknown reporter '${values.reporter}'`);
+        process.exit(2);
+    }
+    // 0 runs the tests without timeout
+    if (!/^\d+$/.test(values.timeout)) {
+        console.println(`test: invalid timeout '${values.timeout}'`);
+        process.exit(2);
+    }
+    const timeout = parseInt(values.timeout, 10);
+
+    const isTestFile = (name) => /\.test\.(js|mjs|cjs|ts|mts|cts)$/.test(name);
+
+    // find the test files in dir and its subdirectories, except node_modules
+    function findTests(dir, found) {
+        const entries = fs.readdirSync(dir, { withFileTypes: true })
+            .sort((a, b) => a.name < b.name ? -1 : a.name > b.name ? 1 : 0);
+        for (const entry of entries) {
+            const path = dir + (dir.endsWith("/") ? "" : "/") + entry.name;
+            if (entry.isDirectory()) {
+                if (entry.name !== "node_modules" && !entry.name.startsWith(".")) {
+                    findTests(path, found);
+                }
+            } else if (isTestFile(entry.name)) {
+                found.push(path);
+            }
+        }
+        return found;
+    }
+
+    const cwd = process.cwd();
+    const files = [];
+    for (let p of positionals.length > 0 ? positionals : [cwd]) {
+        if (!p.startsWith("/")) {
+            p = cwd + (cwd.endsWith("/") ? "" : "/") + p;
+        }
+        if (!fs.existsSync(p)) {
+            console.println(`test: ${p}: no such file or directory`);
+            process.exit(2);
+        }
+        if (fs.statSync(p).isDirectory()) {
+            findTests(p, files);
+        } else {
+            files.push(p);
+        }
+    }
+
+    for (const file of files) {
+        test.file(file, () => require(file));
+    }
+
+    test.run({ timeout }).then((results) => {
+        const report = values.reporter === 'junit' ? test.junit(results) : test.tap(results);
+        if (values.output) {
+            fs.writeFileSync(values.output, report);
+        } else {
+            console.print(report);
+        }
+        process.exit(results.fail > 0 ? 1 : 0);
+    });
+})()
@@ -72,7 +72,8 @@ func (sh *Shell) Run(call goja.FunctionCall) goja.Value {
 		Candidates: sh.getCompletionCandidates,
 	})
 	ctx := context.Background()
-	log.Println(banner)
+	console := log.ConsoleOf(sh.rt)
+	console.Println(banner)
 	for {
 		var line string
 		var forHistory string
@@ -80,7 +81,7 @@ func (sh *Shell) Run(call goja.FunctionCall) goja.Value {
 			if err == readline.CtrlC || err == io.EOF {
 				return sh.rt.ToValue(0)
 			}
-			log.Printf("Error input: %v\n", err)
+			console.Printf("Error input: %v\n", err)
 			return sh.rt.ToValue(1)
 		} else {
 			forHistory = strings.Join(input, "\n")
@@ -145,7 +146,7 @@ func (sh *Shell) process(line string) (int, bool) {
 			exitCode := -1
 			switch v := returnValue.Export().(type) {
 			default:
-				log.Print(returnValue.String())
+				log.ConsoleOf(sh.rt).Print(returnValue.String())
 			case int64:
 				exitCode = int(v)
 			}
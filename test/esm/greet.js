@@ -0,0 +1,18 @@
+import multiply, { PI } from "./math.mjs";
+import * as math from "./math.mjs";
+import legacy, { hello } from "./legacy.cjs";
+
+export function greet(name) {
+    return hello(name);
+}
+
+export function area(r) {
+    return multiply(PI, multiply(r, r));
+}
+
+export function count() {
+    math.increment();
+    return math.counter;
+}
+
+export { legacy as default };
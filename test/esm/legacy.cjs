@@ -0,0 +1,6 @@
+module.exports = {
+    name: "legacy",
+    hello: function (name) {
+        return `Hello ${name} from legacy.cjs!`;
+    },
+};
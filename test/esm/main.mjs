@@ -0,0 +1,6 @@
+#!/usr/bin/env jsh
+import { greet, area } from "./greet.js";
+import { argv } from "/lib/process";
+
+console.println(greet(argv.slice(2).join(" ")));
+console.println("area:", area(2));
@@ -0,0 +1,11 @@
+export const PI = 3.14;
+
+export let counter = 0;
+
+export function increment() {
+    counter++;
+}
+
+export default function multiply(a, b) {
+    return a * b;
+}
@@ -0,0 +1,30 @@
+const exp = require('exp');
+const feature = require('exp/feature');
+const str = require('exp/utils/str');
+const pkg = require('exp/package.json');
+const scoped = require('@scope/pkg');
+const config = require('#config');
+
+console.println(exp.name);
+console.println(feature.name, feature.helper, feature.dep);
+console.println(str.name);
+console.println(pkg.name);
+console.println(scoped.name);
+console.println(config.name);
+// the subpaths not exported, or excluded by null, throw, and hide their files
+for (const name of ['exp/utils/private/secret', 'exp/lib/utils/private/secret', 'exp/legacy', 'exp/legacy.js']) {
+    try {
+        require(name);
+        console.println(name, 'loaded');
+    } catch (e) {
+        console.println(e.name, e.code, e.message);
+    }
+}
+for (const name of ['#util/util', '#missing']) {
+    try {
+        require(name);
+        console.println(name, 'loaded');
+    } catch (e) {
+        console.println(name, 'not found');
+    }
+}
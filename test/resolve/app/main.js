@@ -0,0 +1,17 @@
+const mod = require('./sub/dir/mod');
+const util = require('../shared/util');
+const config = require('./config');
+const local = require('local');
+const withmain = require('withmain');
+const nomain = require('nomain');
+const dirmain = require('dirmain');
+const EventEmitter = require('../../../lib/events');
+
+console.println(mod.name, mod.parent);
+console.println(util.name);
+console.println(config.name, config.port);
+console.println(local.name);
+console.println(withmain.name, withmain.inner);
+console.println(nomain.name);
+console.println(dirmain.name);
+console.println(typeof EventEmitter);
@@ -0,0 +1 @@
+module.exports = { name: 'sub/dir/mod', parent: require('../../../shared/util').name };
@@ -0,0 +1,2 @@
+"use strict";const u=require("./util.js");u.fail("main");
+//# sourceMappingURL=main.js.map
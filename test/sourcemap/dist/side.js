@@ -0,0 +1 @@
+"use strict";function fail(m){throw new Error(`fail: ${m}`)}exports.fail=fail;
@@ -0,0 +1,2 @@
+"use strict";function fail(m){throw new Error(`fail: ${m}`)}exports.fail=fail;
+//# sourceMappingURL=util.js.map
@@ -0,0 +1,3 @@
+import { fail } from "./util";
+
+fail("main");
@@ -0,0 +1,3 @@
+export function fail(msg: string): never {
+    throw new Error(`fail: ${msg}`);
+}
@@ -0,0 +1,5 @@
+const { it, assert } = require('/lib/test');
+
+it('fails', () => {
+    assert.strictEqual(1 + 1, 3);
+});
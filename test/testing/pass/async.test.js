@@ -0,0 +1,12 @@
+const { describe, it, assert } = require('/lib/test');
+
+describe('async', () => {
+    it('awaits a promise', async () => {
+        const value = await new Promise((resolve) => setTimeout(() => resolve(42), 10));
+        assert.equal(value, 42);
+    });
+
+    it('calls done', (done) => {
+        setTimeout(done, 10);
+    });
+});
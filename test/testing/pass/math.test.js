@@ -0,0 +1,19 @@
+const { describe, it, beforeEach, assert } = require('/lib/test');
+
+describe('math', () => {
+    let values;
+
+    beforeEach(() => {
+        values = [1, 2, 3];
+    });
+
+    it('adds', () => {
+        assert.strictEqual(values.reduce((a, b) => a + b, 0), 6);
+    });
+
+    it('copies', () => {
+        assert.deepStrictEqual(values.slice(), [1, 2, 3]);
+    });
+
+    it.skip('divides by zero');
+});
@@ -0,0 +1,22 @@
+export interface Greeter {
+    greet(name: string): string;
+}
+
+export enum Level { Low = 1, Mid, High }
+
+export class Hello implements Greeter {
+    constructor(private readonly prefix: string = "Hello") {}
+
+    greet(name: string): string {
+        return `${this.prefix} ${name} from lib.ts!`;
+    }
+}
+
+export function sum(...nums: number[]): number {
+    return nums.reduce((a: number, b: number): number => a + b, 0);
+}
+
+export function where(): string {
+    const err: Error = new Error("here");
+    return err.stack as string;
+}
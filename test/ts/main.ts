@@ -0,0 +1,9 @@
+#!/usr/bin/env jsh
+import { Hello, Level, sum } from "./lib.js";
+import { argv } from "/lib/process";
+
+const args: string[] = argv.slice(2);
+const hello = new Hello();
+console.println(hello.greet(args.join(" ")));
+console.println("level:", Level.High, Level[Level.Mid]);
+console.println("sum:", sum(1, 2, 3));
@@ -0,0 +1,9 @@
+const { parentPort, workerData, isMainThread } = require('/lib/worker');
+
+parentPort.on('message', (msg) => {
+    if (msg === 'close') {
+        parentPort.close();
+        return;
+    }
+    parentPort.postMessage({ from: workerData.name, isMainThread, msg });
+});